@@ -3,12 +3,21 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/opensourceways/argus-worker/pkg/server" // 替换为你的实际 module 名称
+	"github.com/opensourceways/argus-worker/pkg/worker"
 )
 
 // Run 启动应用
 func Run() error {
+	// 加载转换服务的配置
+	config, err := worker.LoadConfig(os.Getenv(worker.ConfigEnv))
+	if err != nil {
+		return err
+	}
+	server.Config = config
+
 	// 启动工作池
 	server.StartWorkerPool()
 	log.Println("Worker 池已启动")
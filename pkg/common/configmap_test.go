@@ -2,7 +2,6 @@ package common
 
 import (
 	"context"
-	"sync"
 	"testing"
 
 	corev1 "k8s.io/api/core/v1"
@@ -12,15 +11,8 @@ import (
 
 // TestGetConfigMap 测试 GetConfigMap 函数
 func TestGetConfigMap(t *testing.T) {
-	// 保存原始的 kubeClient 和 once
-	originalKubeClient := kubeClient
-	originalOnce := once
-
 	// 确保在测试结束后恢复原始状态
-	defer func() {
-		kubeClient = originalKubeClient
-		once = originalOnce
-	}()
+	defer Reset()
 
 	// 创建一个假的 Kubernetes 客户端
 	fakeClientset := fake.NewSimpleClientset()
@@ -43,14 +35,12 @@ func TestGetConfigMap(t *testing.T) {
 		t.Fatalf("Failed to create test configmap: %v", err)
 	}
 
-	// 替换全局 kubeClient 以使用假客户端进行测试
-	kubeClient = &KubeClient{
+	// 缓存假客户端，GetKubeClient("") 返回它而不是连接集群
+	Reset()
+	kubeClients[""] = &KubeClient{
 		Clientset: fakeClientset,
 	}
 
-	// 重置 once 以确保下次调用 GetKubeClient 时使用我们的假客户端
-	once = sync.Once{}
-
 	// 测试正常情况
 	configMap, err := GetConfigMap("", "default", "test-configmap")
 	if err != nil {
@@ -93,15 +83,8 @@ func TestGetConfigMap(t *testing.T) {
 
 // TestListConfigMaps 测试 ListConfigMaps 函数
 func TestListConfigMaps(t *testing.T) {
-	// 保存原始的 kubeClient 和 once
-	originalKubeClient := kubeClient
-	originalOnce := once
-
 	// 确保在测试结束后恢复原始状态
-	defer func() {
-		kubeClient = originalKubeClient
-		once = originalOnce
-	}()
+	defer Reset()
 
 	// 创建一个假的 Kubernetes 客户端
 	fakeClientset := fake.NewSimpleClientset()
@@ -138,14 +121,12 @@ func TestListConfigMaps(t *testing.T) {
 		t.Fatalf("Failed to create test configmap 2: %v", err)
 	}
 
-	// 替换全局 kubeClient 以使用假客户端进行测试
-	kubeClient = &KubeClient{
+	// 缓存假客户端，GetKubeClient("") 返回它而不是连接集群
+	Reset()
+	kubeClients[""] = &KubeClient{
 		Clientset: fakeClientset,
 	}
 
-	// 重置 once 以确保下次调用 GetKubeClient 时使用我们的假客户端
-	once = sync.Once{}
-
 	// 测试列出 ConfigMap
 	configMaps, err := ListConfigMaps("", "default")
 	if err != nil {
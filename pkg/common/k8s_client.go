@@ -5,35 +5,40 @@ import (
 	"os"
 	"sync"
 
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+// kubeClients 按 kubeconfig 路径缓存客户端，不同路径的调用互不影响，创建失败时不缓存，之后的调用会重新创建
 var (
-	kubeClient *KubeClient
-	once       sync.Once
+	kubeClientsMu sync.Mutex
+	kubeClients   = make(map[string]*KubeClient)
 )
 
 // KubeClient 封装了Kubernetes客户端的结构体
 type KubeClient struct {
 	Clientset kubernetes.Interface
+	// ArgoClientset 用于操作 Argo Workflow 资源
+	ArgoClientset versioned.Interface
 }
 
-// GetKubeClient 获取Kubernetes客户端单例实例
+// GetKubeClient 获取 kubeconfigPath 对应的 Kubernetes 客户端，同一路径返回同一个实例
 // 如果kubeconfigPath为空，则尝试从环境变量或默认位置获取
 func GetKubeClient(kubeconfigPath string) (*KubeClient, error) {
-	var err error
-
-	once.Do(func() {
-		kubeClient, err = newKubeClient(kubeconfigPath)
-	})
+	kubeClientsMu.Lock()
+	defer kubeClientsMu.Unlock()
 
+	if client, ok := kubeClients[kubeconfigPath]; ok {
+		return client, nil
+	}
+	client, err := newKubeClient(kubeconfigPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
-
-	return kubeClient, nil
+	kubeClients[kubeconfigPath] = client
+	return client, nil
 }
 
 // newKubeClient 创建新的Kubernetes客户端实例
@@ -78,8 +83,15 @@ func newKubeClient(kubeconfigPath string) (*KubeClient, error) {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
+	// 创建 Argo clientset
+	argoClientset, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create argo clientset: %w", err)
+	}
+
 	return &KubeClient{
-		Clientset: clientset,
+		Clientset:     clientset,
+		ArgoClientset: argoClientset,
 	}, nil
 }
 
@@ -88,8 +100,9 @@ func (kc *KubeClient) GetClientset() kubernetes.Interface {
 	return kc.Clientset
 }
 
-// Reset 重置单例实例（主要用于测试）
+// Reset 清空缓存的客户端（主要用于测试）
 func Reset() {
-	once = sync.Once{}
-	kubeClient = nil
+	kubeClientsMu.Lock()
+	defer kubeClientsMu.Unlock()
+	kubeClients = make(map[string]*KubeClient)
 }
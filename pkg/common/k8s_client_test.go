@@ -274,3 +274,50 @@ users:
 		t.Error("GetClientset() returned nil, want not nil")
 	}
 }
+
+// TestGetKubeClientPerPath 测试不同 kubeconfig 路径的客户端分别缓存，创建失败不影响其他路径和之后的重试
+func TestGetKubeClientPerPath(t *testing.T) {
+	tempDir := t.TempDir()
+	kubeconfigPath := filepath.Join(tempDir, "kubeconfig")
+	kubeconfigContent := `apiVersion: v1
+clusters:
+- cluster:
+    server: https://test-server
+  name: test-cluster
+contexts:
+- context:
+    cluster: test-cluster
+    user: test-user
+  name: test-context
+current-context: test-context
+kind: Config
+users:
+- name: test-user
+  user:
+    token: test-token`
+
+	Reset()
+	defer Reset()
+
+	// 第一次调用使用不存在的路径，失败后不能影响其他路径
+	missing := filepath.Join(tempDir, "missing")
+	if _, err := GetKubeClient(missing); err == nil {
+		t.Fatal("GetKubeClient() with missing kubeconfig error = nil, want error")
+	}
+	if err := os.WriteFile(kubeconfigPath, []byte(kubeconfigContent), 0644); err != nil {
+		t.Fatalf("Failed to create temp kubeconfig file: %v", err)
+	}
+	client, err := GetKubeClient(kubeconfigPath)
+	if err != nil || client == nil {
+		t.Fatalf("GetKubeClient() = %v, %v, want client", client, err)
+	}
+
+	// 失败不缓存，文件创建后同一路径可以重新创建客户端
+	if err := os.WriteFile(missing, []byte(kubeconfigContent), 0644); err != nil {
+		t.Fatalf("Failed to create temp kubeconfig file: %v", err)
+	}
+	retried, err := GetKubeClient(missing)
+	if err != nil || retried == nil || retried == client {
+		t.Errorf("GetKubeClient() after the file is created = %v, %v, want a new client", retried, err)
+	}
+}
@@ -0,0 +1,216 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
+	"github.com/argoproj/argo-workflows/v3/workflow/packer"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+// 转换后的 workflow 通过注解记录 workflow 级别的 concurrency 组，组名中可以引用 workflow 参数
+const (
+	ConcurrencyGroupAnnotation = "argus.openeuler.org/concurrency-group"
+	CancelInProgressAnnotation = "argus.openeuler.org/cancel-in-progress"
+	// ConcurrencyGroupLabel 的值是参数替换后组名的哈希，用于查找同组的 workflow
+	ConcurrencyGroupLabel = "argus.openeuler.org/concurrency-group"
+)
+
+// completedLabel 是 Argo 为 workflow 设置的完成状态标签
+const completedLabel = "workflows.argoproj.io/completed"
+
+// workflowParameterPattern 匹配 workflow 参数引用，例如 {{workflow.parameters.github-ref}}
+var workflowParameterPattern = regexp.MustCompile(`\{\{\s*workflow\.parameters\.([-\w.]+)\s*\}\}`)
+
+// SubmitWorkflow 在 namespace 中创建 workflow。设置了 concurrency 组的 workflow 会添加组标签，
+// cancel-in-progress 为 true 时先终止同组中仍在运行的旧 workflow
+func SubmitWorkflow(ctx context.Context, client versioned.Interface, namespace string, wf *wfv1.Workflow) (*wfv1.Workflow, error) {
+	wf = wf.DeepCopy()
+	if group, ok := wf.Annotations[ConcurrencyGroupAnnotation]; ok {
+		label := concurrencyLabel(resolveWorkflowParameters(group, wf.Spec.Arguments.Parameters))
+		if wf.Labels == nil {
+			wf.Labels = make(map[string]string)
+		}
+		wf.Labels[ConcurrencyGroupLabel] = label
+
+		if wf.Annotations[CancelInProgressAnnotation] == "true" {
+			if err := cancelInProgress(ctx, client, namespace, label); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	created, err := client.ArgoprojV1alpha1().Workflows(namespace).Create(ctx, wf, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workflow in namespace %s: %w", namespace, err)
+	}
+	return created, nil
+}
+
+// cancelInProgress 终止 concurrency 组中所有未完成的 workflow
+func cancelInProgress(ctx context.Context, client versioned.Interface, namespace, label string) error {
+	workflows := client.ArgoprojV1alpha1().Workflows(namespace)
+	list, err := workflows.List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s!=true", ConcurrencyGroupLabel, label, completedLabel),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list workflows in namespace %s: %w", namespace, err)
+	}
+
+	patch := []byte(fmt.Sprintf(`{"spec":{"shutdown":%q}}`, wfv1.ShutdownStrategyTerminate))
+	for _, wf := range list.Items {
+		if wf.Spec.Shutdown != "" {
+			continue
+		}
+		_, err := workflows.Patch(ctx, wf.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to terminate workflow %s: %w", wf.Name, err)
+		}
+	}
+	return nil
+}
+
+// resolveWorkflowParameters 将 s 中的 workflow 参数引用替换为提交时的参数值
+func resolveWorkflowParameters(s string, params []wfv1.Parameter) string {
+	values := make(map[string]string, len(params))
+	for _, param := range params {
+		switch {
+		case param.Value != nil:
+			values[param.Name] = param.Value.String()
+		case param.Default != nil:
+			values[param.Name] = param.Default.String()
+		}
+	}
+	return workflowParameterPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		return values[workflowParameterPattern.FindStringSubmatch(ref)[1]]
+	})
+}
+
+// concurrencyLabel 返回 concurrency 组的标签值，组名可能包含标签中不允许的字符
+func concurrencyLabel(group string) string {
+	sum := sha256.Sum256([]byte(group))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ApprovalSuffix 是转换后 workflow 中审批节点名的后缀，部署到需要审批的环境的 job 在节点 <job>-approval 通过后执行
+const ApprovalSuffix = "-approval"
+
+// ApprovalEnvironmentsParameter 是审批节点的输入参数，值为 job 部署的环境名的 JSON 数组，用于按环境确定审批人
+const ApprovalEnvironmentsParameter = "environments"
+
+// ErrApprovalForbidden 表示审批人无权审批等待审批的节点
+var ErrApprovalForbidden = errors.New("approver is not allowed to resolve the approval")
+
+// ResolveApproval 审批 workflow 中等待审批的 suspend 节点：approve 为 true 时节点成功，之后的 job 继续执行；
+// 否则节点失败，依赖它的 job 不再执行。审批人和审批意见记录在节点的 message 中。
+// allowed 判断审批人能否审批部署到给定环境的 job，job 为空时处理审批人可以审批的所有等待审批的节点，返回处理的节点名。
+// workflow 更新冲突时重新读取后重试，节点状态卸载到数据库的 workflow 不能审批
+func ResolveApproval(ctx context.Context, client versioned.Interface, namespace, name, job string, approve bool, approver, message string, allowed func(environments []string) bool) ([]string, error) {
+	if approver == "" {
+		return nil, fmt.Errorf("approver of workflow %s is empty", name)
+	}
+	phase, verdict := wfv1.NodeSucceeded, "approved"
+	if !approve {
+		phase, verdict = wfv1.NodeFailed, "rejected"
+	}
+	message = strings.TrimSpace(message)
+	if message != "" {
+		message = fmt.Sprintf("%s by %s: %s", verdict, approver, message)
+	} else {
+		message = fmt.Sprintf("%s by %s", verdict, approver)
+	}
+
+	workflows := client.ArgoprojV1alpha1().Workflows(namespace)
+	var resolved []string
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		wf, err := workflows.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get workflow %s: %w", name, err)
+		}
+		if wf.Status.IsOffloadNodeStatus() {
+			return fmt.Errorf("node status of workflow %s is offloaded, resolve the approval with argo resume or argo stop", name)
+		}
+		if err := packer.DecompressWorkflow(wf); err != nil {
+			return fmt.Errorf("failed to decompress nodes of workflow %s: %w", name, err)
+		}
+
+		resolved, err = resolveApprovalNodes(wf, job, phase, message, allowed)
+		if err != nil {
+			return err
+		}
+		if err := packer.CompressWorkflowIfNeeded(wf); err != nil {
+			return fmt.Errorf("failed to compress nodes of workflow %s: %w", name, err)
+		}
+		_, err = workflows.Update(ctx, wf, metav1.UpdateOptions{})
+		if err != nil && !apierrors.IsConflict(err) {
+			return fmt.Errorf("failed to update approval of workflow %s: %w", name, err)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// resolveApprovalNodes 将 wf 中等待审批且审批人可以审批的节点设置为 phase，返回处理的节点名
+func resolveApprovalNodes(wf *wfv1.Workflow, job string, phase wfv1.NodePhase, message string, allowed func(environments []string) bool) ([]string, error) {
+	finishedAt := metav1.Now()
+	var resolved []string
+	forbidden := false
+	for id, node := range wf.Status.Nodes {
+		environments, ok := approvalEnvironments(node)
+		if !ok || node.Phase != wfv1.NodeRunning {
+			continue
+		}
+		if job != "" && node.DisplayName != job+ApprovalSuffix {
+			continue
+		}
+		if !allowed(environments) {
+			forbidden = true
+			continue
+		}
+		node.Phase = phase
+		node.Message = message
+		node.FinishedAt = finishedAt
+		wf.Status.Nodes[id] = node
+		resolved = append(resolved, node.DisplayName)
+	}
+	switch {
+	case len(resolved) == 0 && forbidden:
+		return nil, fmt.Errorf("%w of workflow %s", ErrApprovalForbidden, wf.Name)
+	case len(resolved) == 0 && job != "":
+		return nil, fmt.Errorf("job %s of workflow %s is not waiting for approval", job, wf.Name)
+	case len(resolved) == 0:
+		return nil, fmt.Errorf("workflow %s has no pending approval", wf.Name)
+	}
+	sort.Strings(resolved)
+	return resolved, nil
+}
+
+// approvalEnvironments 返回审批节点的 job 部署的环境，node 不是转换时生成的 <job>-approval suspend 节点时 ok 为 false
+func approvalEnvironments(node wfv1.NodeStatus) (environments []string, ok bool) {
+	if node.Type != wfv1.NodeTypeSuspend || !strings.HasSuffix(node.DisplayName, ApprovalSuffix) || node.Inputs == nil {
+		return nil, false
+	}
+	param := node.Inputs.GetParameterByName(ApprovalEnvironmentsParameter)
+	if param == nil || param.Value == nil {
+		return nil, false
+	}
+	if err := json.Unmarshal([]byte(param.Value.String()), &environments); err != nil {
+		return nil, false
+	}
+	return environments, true
+}
@@ -0,0 +1,201 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned/fake"
+	"github.com/argoproj/argo-workflows/v3/util/file"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestSubmitWorkflowCancelInProgress 测试提交 workflow 时终止同组中仍在运行的旧 workflow
+func TestSubmitWorkflowCancelInProgress(t *testing.T) {
+	label := concurrencyLabel("org/repo/ci-refs/heads/main")
+	running := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "running",
+			Namespace: "default",
+			Labels:    map[string]string{ConcurrencyGroupLabel: label},
+		},
+	}
+	completed := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "completed",
+			Namespace: "default",
+			Labels:    map[string]string{ConcurrencyGroupLabel: label, completedLabel: "true"},
+		},
+	}
+	other := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "other",
+			Namespace: "default",
+			Labels:    map[string]string{ConcurrencyGroupLabel: concurrencyLabel("org/repo/ci-refs/heads/dev")},
+		},
+	}
+	client := fake.NewSimpleClientset(running, completed, other)
+
+	wf := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "new",
+			Annotations: map[string]string{
+				ConcurrencyGroupAnnotation: "org/repo/ci-{{workflow.parameters.github-ref}}",
+				CancelInProgressAnnotation: "true",
+			},
+		},
+		Spec: wfv1.WorkflowSpec{
+			Arguments: wfv1.Arguments{Parameters: []wfv1.Parameter{
+				{Name: "github-ref", Value: wfv1.AnyStringPtr("refs/heads/main")},
+			}},
+		},
+	}
+	created, err := SubmitWorkflow(context.TODO(), client, "default", wf)
+	if err != nil {
+		t.Fatalf("SubmitWorkflow() error = %v", err)
+	}
+	if got := created.Labels[ConcurrencyGroupLabel]; got != label {
+		t.Errorf("concurrency group label = %q, want %q", got, label)
+	}
+
+	want := map[string]wfv1.ShutdownStrategy{
+		"running":   wfv1.ShutdownStrategyTerminate,
+		"completed": "",
+		"other":     "",
+		"new":       "",
+	}
+	for name, shutdown := range want {
+		got, err := client.ArgoprojV1alpha1().Workflows("default").Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", name, err)
+		}
+		if got.Spec.Shutdown != shutdown {
+			t.Errorf("workflow %s shutdown = %q, want %q", name, got.Spec.Shutdown, shutdown)
+		}
+	}
+}
+
+// approvalNode 返回部署到 environments 的 job 的审批节点
+func approvalNode(id, job string, environments string) wfv1.NodeStatus {
+	return wfv1.NodeStatus{
+		ID:          id,
+		DisplayName: job + ApprovalSuffix,
+		Type:        wfv1.NodeTypeSuspend,
+		Phase:       wfv1.NodeRunning,
+		Inputs: &wfv1.Inputs{
+			Parameters: []wfv1.Parameter{{Name: ApprovalEnvironmentsParameter, Value: wfv1.AnyStringPtr(environments)}},
+		},
+	}
+}
+
+// TestResolveApproval 测试审批结果写入等待审批的 suspend 节点
+func TestResolveApproval(t *testing.T) {
+	wf := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "release", Namespace: "default"},
+		Status: wfv1.WorkflowStatus{
+			Nodes: wfv1.Nodes{
+				"release-1": approvalNode("release-1", "deploy", `["production"]`),
+				"release-2": approvalNode("release-2", "docs", `["staging"]`),
+				"release-3": {ID: "release-3", DisplayName: "build", Type: wfv1.NodeTypePod, Phase: wfv1.NodeRunning},
+				// 不是转换时生成的审批节点
+				"release-4": {ID: "release-4", DisplayName: "wait-approval", Type: wfv1.NodeTypeSuspend, Phase: wfv1.NodeRunning},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(wf)
+	all := func([]string) bool { return true }
+
+	nodes, err := ResolveApproval(context.TODO(), client, "default", "release", "deploy", false, "ops", "wrong version", all)
+	if err != nil {
+		t.Fatalf("ResolveApproval() error = %v", err)
+	}
+	if len(nodes) != 1 || nodes[0] != "deploy-approval" {
+		t.Errorf("ResolveApproval() = %v, want [deploy-approval]", nodes)
+	}
+	got, err := client.ArgoprojV1alpha1().Workflows("default").Get(context.TODO(), "release", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	// 审批人和审批意见记录在节点的 message 中
+	if node := got.Status.Nodes["release-1"]; node.Phase != wfv1.NodeFailed || node.Message != "rejected by ops: wrong version" {
+		t.Errorf("deploy-approval = %s %q, want Failed with approver and message", node.Phase, node.Message)
+	}
+	if node := got.Status.Nodes["release-2"]; node.Phase != wfv1.NodeRunning {
+		t.Errorf("docs-approval phase = %s, want Running", node.Phase)
+	}
+
+	if _, err := ResolveApproval(context.TODO(), client, "default", "release", "", true, "", "", all); err == nil {
+		t.Errorf("ResolveApproval() error = nil, want empty approver error")
+	}
+	if _, err := ResolveApproval(context.TODO(), client, "default", "release", "wait", true, "alice", "", all); err == nil {
+		t.Errorf("ResolveApproval() of a suspend node not generated for approval error = nil, want error")
+	}
+	production := func(environments []string) bool { return len(environments) == 1 && environments[0] == "production" }
+	if _, err := ResolveApproval(context.TODO(), client, "default", "release", "", true, "alice", "", production); !errors.Is(err, ErrApprovalForbidden) {
+		t.Errorf("ResolveApproval() error = %v, want %v", err, ErrApprovalForbidden)
+	}
+	nodes, err = ResolveApproval(context.TODO(), client, "default", "release", "", true, "alice", "", all)
+	if err != nil || len(nodes) != 1 || nodes[0] != "docs-approval" {
+		t.Errorf("ResolveApproval() = %v, %v, want [docs-approval]", nodes, err)
+	}
+	got, err = client.ArgoprojV1alpha1().Workflows("default").Get(context.TODO(), "release", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if node := got.Status.Nodes["release-2"]; node.Phase != wfv1.NodeSucceeded || node.Message != "approved by alice" {
+		t.Errorf("docs-approval = %s %q, want Succeeded approved by alice", node.Phase, node.Message)
+	}
+	if node := got.Status.Nodes["release-4"]; node.Phase != wfv1.NodeRunning {
+		t.Errorf("wait-approval phase = %s, want Running", node.Phase)
+	}
+	if _, err := ResolveApproval(context.TODO(), client, "default", "release", "", true, "alice", "", all); err == nil {
+		t.Errorf("ResolveApproval() error = nil, want no pending approval")
+	}
+}
+
+// TestResolveApprovalConflict 测试 workflow 更新冲突时重新读取后重试，压缩的节点状态解压后更新
+func TestResolveApprovalConflict(t *testing.T) {
+	nodes, _ := json.Marshal(wfv1.Nodes{"release-1": approvalNode("release-1", "deploy", `["production"]`)})
+	wf := &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "release", Namespace: "default"},
+		Status:     wfv1.WorkflowStatus{CompressedNodes: file.CompressEncodeString(string(nodes))},
+	}
+	client := fake.NewSimpleClientset(wf)
+	conflicts := 0
+	client.PrependReactor("update", "workflows", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts++; conflicts == 1 {
+			return true, nil, apierrors.NewConflict(wfv1.Resource("workflows"), "release", errors.New("modified"))
+		}
+		return false, nil, nil
+	})
+
+	resolved, err := ResolveApproval(context.TODO(), client, "default", "release", "deploy", true, "ops", "", func([]string) bool { return true })
+	if err != nil || len(resolved) != 1 {
+		t.Fatalf("ResolveApproval() = %v, %v, want [deploy-approval]", resolved, err)
+	}
+	if conflicts != 2 {
+		t.Errorf("updates = %d, want 2", conflicts)
+	}
+	got, err := client.ArgoprojV1alpha1().Workflows("default").Get(context.TODO(), "release", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if node := got.Status.Nodes["release-1"]; node.Phase != wfv1.NodeSucceeded {
+		t.Errorf("deploy-approval phase = %s, want Succeeded", node.Phase)
+	}
+
+	// 卸载到数据库的节点状态不能在这里更新
+	wf = &wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "offloaded", Namespace: "default"},
+		Status:     wfv1.WorkflowStatus{OffloadNodeStatusVersion: "fnv:1"},
+	}
+	client = fake.NewSimpleClientset(wf)
+	if _, err := ResolveApproval(context.TODO(), client, "default", "offloaded", "", true, "ops", "", func([]string) bool { return true }); err == nil {
+		t.Errorf("ResolveApproval() of offloaded workflow error = nil, want error")
+	}
+}
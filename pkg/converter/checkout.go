@@ -0,0 +1,194 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// GitHub 的服务地址和 API 地址，对应 github.server_url 和 github.api_url
+const (
+	githubServerURL = "https://github.com"
+	githubAPIURL    = "https://api.github.com"
+)
+
+// builtinActions 是转换为 shell 脚本执行的 action，键为不带版本的 action 名称
+var builtinActions = map[string]func(c *WorkflowConverter, step *model.Step, eval *evaluator, env *scriptEnv) (string, error){
+	"actions/checkout": (*WorkflowConverter).checkoutScript,
+}
+
+// actionName 返回 uses 中去掉版本后的 action 名称，统一为小写
+func actionName(uses string) string {
+	name := uses
+	if idx := strings.LastIndex(name, "@"); idx != -1 {
+		name = name[:idx]
+	}
+	return strings.ToLower(name)
+}
+
+// stepScript 返回 step 在 shell 中执行的脚本：run step 为替换表达式后的 run 内容，
+// 内置支持的 action 为生成的脚本。不支持的 step 返回 false
+func (c *WorkflowConverter) stepScript(step *model.Step, eval *evaluator, env *scriptEnv) (string, bool, error) {
+	if step.Run != "" {
+		script, err := eval.interpolateScript(step.Run, env)
+		return script, true, err
+	}
+	action, ok := builtinActions[actionName(step.Uses)]
+	if !ok {
+		return "", false, nil
+	}
+	script, err := action(c, step, eval, env)
+	return script, true, err
+}
+
+// actionInput 返回 step with 中的输入，输入名不区分大小写
+func actionInput(step *model.Step, name string) (string, bool) {
+	if value, ok := step.With[name]; ok {
+		return value, true
+	}
+	for k, value := range step.With {
+		if strings.EqualFold(k, name) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// constantInput 在转换时对输入求值，输入不存在时返回 def
+func constantInput(step *model.Step, eval *evaluator, name, def string) (string, error) {
+	raw, ok := actionInput(step, name)
+	if !ok {
+		return def, nil
+	}
+	value, err := eval.interpolate(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate input %s: %w", name, err)
+	}
+	if strings.Contains(value, "{{") {
+		return "", fmt.Errorf("input %s must be resolvable at conversion time", name)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// checkoutScript 将 actions/checkout 转换为 git 克隆脚本，支持 repository、ref、path、token、
+// fetch-depth、submodules、lfs 和 persist-credentials 输入。未指定 token 时使用仓库映射的
+// Kubernetes Secret 中的 GITHUB_TOKEN（可选），没有映射时匿名克隆。
+// 工作区位于 PVC 上，token 写入 .git/config 后会在 workflow 结束后继续保留，
+// 因此与 GitHub 不同，persist-credentials 默认为 false
+func (c *WorkflowConverter) checkoutScript(step *model.Step, eval *evaluator, env *scriptEnv) (string, error) {
+	word := func(name, def string) (string, error) {
+		raw, ok := actionInput(step, name)
+		if !ok {
+			raw = def
+		}
+		value, err := eval.interpolateShellWord(raw, env)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate input %s: %w", name, err)
+		}
+		return value, nil
+	}
+
+	repository, err := word("repository", "${{ github.repository }}")
+	if err != nil {
+		return "", err
+	}
+	// 检出触发 workflow 的仓库时默认使用触发事件的提交，其他仓库使用默认分支
+	defaultRef := ""
+	if _, ok := actionInput(step, "repository"); !ok {
+		defaultRef = "${{ github.sha }}"
+	}
+	ref, err := word("ref", defaultRef)
+	if err != nil {
+		return "", err
+	}
+	dir, err := word("path", ".")
+	if err != nil {
+		return "", err
+	}
+
+	token := `""`
+	if _, ok := actionInput(step, "token"); ok {
+		if token, err = word("token", ""); err != nil {
+			return "", err
+		}
+	} else if secret, ok := c.secretName(); ok {
+		token = `"` + env.bindSecret(secretValue{Secret: secret, Key: "GITHUB_TOKEN", Optional: true}) + `"`
+	}
+
+	depthValue, err := constantInput(step, eval, "fetch-depth", "1")
+	if err != nil {
+		return "", err
+	}
+	depth, err := strconv.Atoi(depthValue)
+	if err != nil || depth < 0 {
+		return "", fmt.Errorf("invalid fetch-depth %q", depthValue)
+	}
+	depthFlag := ""
+	if depth > 0 {
+		depthFlag = fmt.Sprintf(" --depth=%d", depth)
+	}
+
+	submodules, err := constantInput(step, eval, "submodules", "false")
+	if err != nil {
+		return "", err
+	}
+	lfs, err := constantInput(step, eval, "lfs", "false")
+	if err != nil {
+		return "", err
+	}
+	persist, err := constantInput(step, eval, "persist-credentials", "false")
+	if err != nil {
+		return "", err
+	}
+
+	authKey := "http." + githubServerURL + "/.extraheader"
+	git := `git -C "$__argus_path"`
+	authGit := git + ` -c "` + authKey + `=$__argus_auth"`
+
+	lines := []string{
+		// 在子 shell 中执行，避免变量影响后续 step
+		"(",
+		"__argus_repository=" + repository,
+		"__argus_ref=" + ref,
+		"__argus_path=" + dir,
+		"__argus_token=" + token,
+		`[ -n "$__argus_ref" ] || __argus_ref=HEAD`,
+		`__argus_auth=""`,
+		`[ -z "$__argus_token" ] || __argus_auth="AUTHORIZATION: basic $(printf 'x-access-token:%s' "$__argus_token" | base64 | tr -d '\n')"`,
+		`mkdir -p "$__argus_path"`,
+		// 共享工作区的属主可能与当前用户不同
+		`git config --global --add safe.directory '*'`,
+		git + " init -q",
+		git + " remote remove origin 2>/dev/null || true",
+		git + ` remote add origin "` + githubServerURL + `/$__argus_repository"`,
+		authGit + " fetch --no-tags --prune" + depthFlag + ` origin "$__argus_ref"`,
+		git + " checkout -q --force FETCH_HEAD",
+	}
+
+	switch strings.ToLower(submodules) {
+	case "false", "":
+	case "true":
+		lines = append(lines, authGit+" submodule update --init --force"+depthFlag)
+	case "recursive":
+		lines = append(lines, authGit+" submodule update --init --force --recursive"+depthFlag)
+	default:
+		return "", fmt.Errorf("invalid submodules %q, expected true, false or recursive", submodules)
+	}
+
+	if isTrue(lfs) {
+		lines = append(lines, git+" lfs install --local", authGit+" lfs pull")
+	}
+	if isTrue(persist) {
+		lines = append(lines, `[ -z "$__argus_auth" ] || `+git+` config --local "`+authKey+`" "$__argus_auth"`)
+	}
+
+	lines = append(lines, ")")
+	return strings.Join(lines, "\n"), nil
+}
+
+// isTrue 判断 action 的布尔输入是否为真
+func isTrue(value string) bool {
+	return strings.EqualFold(strings.TrimSpace(value), "true")
+}
@@ -0,0 +1,352 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxActionDepth 是 composite action 嵌套展开的最大层数，与 GitHub 的限制相同
+const maxActionDepth = 10
+
+// actionOutputDelimiter 是 composite action 输出按多行格式写入 $GITHUB_OUTPUT 时使用的分隔符
+const actionOutputDelimiter = "__ARGUS_ACTION_OUTPUT__"
+
+// WithActionSource 设置远程 action 和 reusable workflow 的源码目录，owner/repo/path@ref 从其中的
+// owner/repo@ref/path 读取。本地 action 和 reusable workflow（uses: ./path）从 WithWorkspace 设置的仓库文件中读取
+func WithActionSource(source fs.FS) Option {
+	return func(c *WorkflowConverter) {
+		c.actionSource = source
+	}
+}
+
+// stepScope 是一组顺序执行的 step 所在的作用域，即 job 的 steps 或 composite action 的 runs.steps
+type stepScope struct {
+	eval *evaluator
+	// prefix 是作用域内 step 输出文件名的前缀，composite action 内部 step 的输出互不影响
+	prefix string
+	// defined 记录作用域内已经执行过的 step，steps 上下文只能引用其中的 step
+	defined map[string]bool
+	// tasks 是作用域内已转换的带 id 的 step 对应的 DAG 任务，step 的 if 条件通过任务的状态和输出参数引用它们
+	tasks map[string]*stepTask
+	// depth 是 composite action 的嵌套层数
+	depth int
+	// pod 是 job 在 pod 级别的配置，运行 step 的模板都需要添加
+	pod *jobPod
+	// timeout 是 job 的运行时间，单位为秒，作用域内的 step 共享这段时间。composite action 内部的作用域为 0，
+	// 共享的时间是 composite step 剩余的运行时间，由 DAG 模板的 deadline 参数传入
+	timeout int32
+	// continued 记录作用域内设置了 continue-on-error 的 DAG 任务
+	continued map[string]bool
+	// defaults 是作用域内 run step 的默认 shell 和工作目录，composite action 内部不继承
+	defaults model.RunDefaults
+}
+
+// key 返回作用域内第 index 个 step 的输出文件名
+func (s *stepScope) key(index int, step *model.Step) string {
+	return s.prefix + stepKey(index, step)
+}
+
+// podTemplate 为运行 step 的模板添加 job 的 pod 配置，pod 的运行时间上限由任务的 deadline 参数传入
+func (s *stepScope) podTemplate(template *wfv1.Template) {
+	s.pod.apply(template)
+	deadlineInput(template)
+}
+
+// taskArguments 返回 step 任务传给模板的参数：运行时间上限和服务 pod 的 IP。job 的 DAG 中服务的 IP 取自
+// daemon 任务，composite action 的 DAG 中取自 DAG 模板的输入参数
+func (s *stepScope) taskArguments(seconds int32, first string) wfv1.Arguments {
+	params := []wfv1.Parameter{s.deadlineArgument(seconds, first)}
+	if s.pod != nil && s.pod.daemons {
+		for _, service := range s.pod.sidecars {
+			value := fmt.Sprintf("{{tasks.%s.ip}}", serviceTaskName(service.Name))
+			if s.depth > 0 {
+				value = fmt.Sprintf("{{inputs.parameters.%s}}", serviceParameter(service.Name))
+			}
+			params = append(params, wfv1.Parameter{Name: serviceParameter(service.Name), Value: wfv1.AnyStringPtr(value)})
+		}
+	}
+	return wfv1.Arguments{Parameters: params}
+}
+
+// composite 返回 step 引用的 composite action 内部的作用域。inputs 上下文由 with 和输入默认值
+// 在 step 所在作用域中求值得到，eval 是 step 所在作用域包含 step env 的求值器
+func (s *stepScope) composite(key string, step *model.Step, action *model.Action, eval *evaluator) (*stepScope, error) {
+	if s.depth >= maxActionDepth {
+		return nil, fmt.Errorf("composite actions are nested more than %d levels", maxActionDepth)
+	}
+
+	inputs, err := actionInputs(step, action, eval)
+	if err != nil {
+		return nil, err
+	}
+	defined := make(map[string]bool)
+	prefix := key + "."
+	return &stepScope{
+		eval:      eval.withContext("inputs", inputs).withResolver("steps", stepsResolver(prefix, defined)),
+		prefix:    prefix,
+		defined:   defined,
+		tasks:     make(map[string]*stepTask),
+		depth:     s.depth + 1,
+		pod:       s.pod,
+		continued: make(map[string]bool),
+	}, nil
+}
+
+// actionInputs 在 step 所在作用域中对 action 的输入求值，未传入的输入使用默认值。
+// 输入名不区分大小写，与 GitHub 一样统一为小写
+func actionInputs(step *model.Step, action *model.Action, eval *evaluator) (map[string]interface{}, error) {
+	raw := make(map[string]string, len(action.Inputs)+len(step.With))
+	for name, input := range action.Inputs {
+		raw[strings.ToLower(name)] = input.Default
+	}
+	for name, value := range step.With {
+		raw[strings.ToLower(name)] = value
+	}
+	inputs := make(map[string]interface{}, len(raw))
+	for _, name := range sortedKeys(raw) {
+		value, err := eval.interpolateValue(raw[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate input %s: %w", name, err)
+		}
+		inputs[name] = value
+	}
+	return inputs, nil
+}
+
+// loadAction 读取 uses 引用的 action 的元数据，返回 action 以及它在 step 容器中的目录：
+// 本地 action 位于工作区，远程 action 位于挂载的 action 卷。找不到 action 时返回错误
+func (c *WorkflowConverter) loadAction(uses string) (*model.Action, string, error) {
+	var source fs.FS
+	var dir, root, origin string
+	if strings.HasPrefix(uses, "./") {
+		if c.workspace == nil {
+			return nil, "", fmt.Errorf("local action %s is not available, the repository files are not provided", uses)
+		}
+		source, dir, root, origin = c.workspace, path.Clean(uses), workspaceDir, "the repository files"
+	} else {
+		idx := strings.LastIndex(uses, "@")
+		parts := strings.SplitN(uses[:max(idx, 0)], "/", 3)
+		if idx == -1 || len(parts) < 2 {
+			return nil, "", fmt.Errorf("invalid action %q, expected owner/repo[/path]@ref", uses)
+		}
+		if c.actionSource == nil {
+			return nil, "", fmt.Errorf("action %s is not available, no action source is configured", uses)
+		}
+		source, dir, root, origin = c.actionSource, parts[0]+"/"+parts[1]+"@"+uses[idx+1:], actionsDir, "the action source"
+		if len(parts) == 3 {
+			dir = path.Join(dir, parts[2])
+		}
+	}
+	if !fs.ValidPath(dir) {
+		return nil, "", fmt.Errorf("invalid action path %q", uses)
+	}
+
+	for _, name := range []string{"action.yml", "action.yaml"} {
+		file, err := source.Open(path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open action %s: %w", uses, err)
+		}
+		action, err := model.ReadAction(file)
+		file.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read action %s: %w", uses, err)
+		}
+		return action, path.Join(root, dir), nil
+	}
+	return nil, "", fmt.Errorf("action %s is not found in %s", uses, origin)
+}
+
+// stepAction 返回 step 引用的 composite action 或 node action 及其在 step 容器中的目录，
+// run step、Docker step 和内置支持的 action 返回 nil。无法转换的 action 返回错误，不能跳过
+func (c *WorkflowConverter) stepAction(step *model.Step) (*model.Action, string, error) {
+	if step.Uses == "" || isDockerStep(step) {
+		return nil, "", nil
+	}
+	if _, ok := builtinActions[actionName(step.Uses)]; ok {
+		return nil, "", nil
+	}
+	action, dir, err := c.loadAction(step.Uses)
+	if err != nil {
+		return nil, "", err
+	}
+	if !action.Runs.Using.IsComposite() && !action.Runs.Using.IsNode() {
+		return nil, "", fmt.Errorf("action %s runs using %s, which is not supported", step.Uses, action.Runs.Using)
+	}
+	return action, dir, nil
+}
+
+// actionSteps 返回 composite action 的 runs.steps
+func actionSteps(action *model.Action) []*model.Step {
+	steps := make([]*model.Step, len(action.Runs.Steps))
+	for i := range action.Runs.Steps {
+		steps[i] = &action.Runs.Steps[i]
+	}
+	return steps
+}
+
+// actionOutputScript 返回在 composite action 内部 step 执行后将 action 输出写入 step 输出文件的脚本，
+// 输出值可能包含换行，因此使用多行格式写入
+func actionOutputScript(action *model.Action, key string, eval *evaluator, env *scriptEnv) ([]string, error) {
+	values := make(map[string]string, len(action.Outputs))
+	for name, output := range action.Outputs {
+		values[name] = output.Value
+	}
+
+	file := shellQuote(stepOutputFile(key))
+	var lines []string
+	for _, name := range sortedKeys(values) {
+		word, err := eval.interpolateShellWord(values[name], env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate output %s: %w", name, err)
+		}
+		lines = append(lines, fmt.Sprintf(`printf '%%s<<%s\n%%s\n%s\n' %s %s >> %s`,
+			actionOutputDelimiter, actionOutputDelimiter, shellQuote(name), word, file))
+	}
+	return lines, nil
+}
+
+// scriptStepLines 返回 step 在 job 脚本中执行的命令，composite action 在原位置展开为内部 step 的命令。
+// composite 表示 step 是否为 composite action
+func (c *WorkflowConverter) scriptStepLines(key string, step *model.Step, scope *stepScope, env *scriptEnv) (lines []string, composite bool, err error) {
+	action, _, err := c.stepAction(step)
+	if err != nil {
+		return nil, false, err
+	}
+	// 需要独立容器的 step 会让 job 按 step 生成模板，不会出现在 job 脚本中
+	if isDockerStep(step) || (action != nil && action.Runs.Using.IsNode()) {
+		return nil, false, fmt.Errorf("step %s must run in its own container, which requires step templates", step.String())
+	}
+	// 带 if 条件的 step 同样需要 step 模板，脚本中无法按条件跳过
+	if strings.TrimSpace(step.If.Value) != "" {
+		return nil, false, fmt.Errorf("step %s has an if condition, which requires step templates", step.String())
+	}
+
+	continued, err := continueOnError(step.RawContinueOnError, scope.eval)
+	if err != nil {
+		return nil, false, err
+	}
+	exports, stepEnv, err := stepEnvExports(step, scope.eval, env)
+	if err != nil {
+		return nil, false, err
+	}
+	eval := scope.eval.withContext("env", stepEnv)
+	// 与 GitHub 一样每个 step 从工作区开始，之前的 step 切换的目录不影响当前 step，相对路径基于工作区
+	setup := []string{"cd " + workspaceDir}
+	if dir := scope.workingDirectory(step); dir != "" {
+		word, err := eval.interpolateShellWord(dir, env)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to evaluate working-directory: %w", err)
+		}
+		setup = append(setup, "cd "+word)
+	}
+	exports = append(setup, exports...)
+
+	var body []string
+	if action == nil {
+		script, _, err := c.stepScript(step, eval, env)
+		if err != nil {
+			return nil, false, err
+		}
+		body = append(body, script)
+	} else {
+		inner, err := scope.composite(key, step, action, eval)
+		if err != nil {
+			return nil, true, err
+		}
+		// 内部 step 总是收集输出，action 的输出可能引用它们
+		for i, innerStep := range actionSteps(action) {
+			innerKey := inner.key(i, innerStep)
+			innerLines, _, err := c.scriptStepLines(innerKey, innerStep, inner, env)
+			if err != nil {
+				return nil, true, fmt.Errorf("failed to evaluate step %s of action %s: %w", innerStep.String(), step.Uses, err)
+			}
+			body = append(body, stepOutputSetup(innerKey))
+			body = append(body, innerLines...)
+			inner.defined[stepKey(i, innerStep)] = true
+		}
+		outputs, err := actionOutputScript(action, key, inner.eval, env)
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to evaluate action %s: %w", step.Uses, err)
+		}
+		body = append(body, outputs...)
+	}
+
+	if continued {
+		// continue-on-error 的 step 在子 shell 中按 set -e 执行，失败时继续执行之后的 step。
+		// 子 shell 出现在 || 等条件中时 set -e 会失效，因此暂时关闭外层的 set -e
+		lines = append(lines, "set +e", "(", "set -e", "__argus_runner_files")
+		lines = append(lines, exports...)
+		lines = append(lines, body...)
+		return append(lines, ")", "set -e"), action != nil, nil
+	}
+	// 工作目录、step env 和 step 中设置的 shell 变量只对当前 step 生效，因此每个 step 在子 shell 中执行
+	lines = append(lines, "(", "__argus_runner_files")
+	lines = append(lines, exports...)
+	lines = append(lines, body...)
+	return append(lines, ")"), action != nil, nil
+}
+
+// convertCompositeStep 将 composite action 的 step 转换为 DAG 模板，内部 step 各自生成模板并按顺序执行，
+// action 的输出由最后的任务写入 step 的输出文件
+func (c *WorkflowConverter) convertCompositeStep(name, jobName, key string, step *model.Step, action *model.Action, scope *stepScope, base *corev1.Container) ([]wfv1.Template, error) {
+	containerEnv, _ := scope.eval.contexts["env"].(map[string]interface{})
+	stepEnv, err := evaluateEnv(scope.eval, containerEnv, step.Environment())
+	if err != nil {
+		return nil, err
+	}
+	inner, err := scope.composite(key, step, action, scope.eval.withContext("env", stepEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	templates, dag, previous, err := c.convertStepsToDAG(name, jobName, actionSteps(action), inner, base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand action %s: %w", step.Uses, err)
+	}
+	dag.Annotations = map[string]string{
+		string(wfv1.TemplateAnnotationDisplayName): stepDisplayName(step),
+	}
+	// step 的 timeout-minutes 和 job 剩余的运行时间同样限制 composite action 内部的 step
+	deadlineInput(dag)
+	scope.pod.serviceInputs(dag)
+
+	if len(action.Outputs) > 0 {
+		env := &scriptEnv{}
+		lines, err := actionOutputScript(action, key, inner.eval, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate action %s: %w", step.Uses, err)
+		}
+		source := strings.Join(append([]string{stepOutputFunction, "mkdir -p " + stepOutputsDir}, lines...), "\n")
+
+		template := wfv1.Template{
+			Name: name + "-" + outputsTaskName,
+			Script: &wfv1.ScriptTemplate{
+				Container: stepContainer(base, jobName, []string{"sh", "-e"}, env.vars),
+				Source:    source,
+			},
+		}
+		templates = append(templates, template)
+
+		cond, err := c.translateStepCondition(&model.Step{}, previous, inner)
+		if err != nil {
+			return nil, err
+		}
+		dag.DAG.Tasks = append(dag.DAG.Tasks, wfv1.DAGTask{
+			Name:     outputsTaskName,
+			Template: template.Name,
+			Depends:  cond.Depends,
+		})
+	}
+
+	return append(templates, *dag), nil
+}
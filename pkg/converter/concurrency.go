@@ -0,0 +1,157 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	"github.com/opensourceways/argus-worker/pkg/common"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// configMapKeyPattern 是 ConfigMap 中合法的键，信号量以 concurrency 组名为键
+var configMapKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// WithSource 设置 workflow 的原始 YAML，act 的模型中没有的字段（例如 concurrency）从中读取
+func WithSource(data []byte) Option {
+	return func(c *WorkflowConverter) {
+		c.source = data
+	}
+}
+
+// WithConcurrencySemaphores 设置允许多个 workflow 同时运行的 concurrency 组。这些组转换为 configMap 中
+// 以组名为键的信号量，同时运行的上限为 ConfigMap 中对应键的值；其他组与 GitHub 一样转换为互斥锁
+func WithConcurrencySemaphores(configMap string, groups []string) Option {
+	return func(c *WorkflowConverter) {
+		c.concurrencyConfigMap = configMap
+		c.concurrencySemaphores = make(map[string]bool, len(groups))
+		for _, group := range groups {
+			c.concurrencySemaphores[group] = true
+		}
+	}
+}
+
+// concurrency 是 workflow 或 job 的 concurrency 配置，可以只写组名
+type concurrency struct {
+	Group            string `yaml:"group"`
+	CancelInProgress string `yaml:"cancel-in-progress"`
+}
+
+func (c *concurrency) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		c.Group = node.Value
+		return nil
+	}
+	type plain concurrency
+	return node.Decode((*plain)(c))
+}
+
+// rawWorkflow 是从原始 YAML 中读取的 act 模型之外的字段
+type rawWorkflow struct {
+	Concurrency *concurrency `yaml:"concurrency"`
+	Jobs        map[string]struct {
+		Concurrency *concurrency    `yaml:"concurrency"`
+		Environment *jobEnvironment `yaml:"environment"`
+		// act 的 Job 模型没有 continue-on-error
+		ContinueOnError string `yaml:"continue-on-error"`
+	} `yaml:"jobs"`
+}
+
+// parseRawWorkflow 解析 workflow 的原始 YAML，没有设置时返回空的结果
+func parseRawWorkflow(source []byte) (*rawWorkflow, error) {
+	raw := &rawWorkflow{}
+	if len(source) == 0 {
+		return raw, nil
+	}
+	if err := yaml.Unmarshal(source, raw); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow source: %w", err)
+	}
+	return raw, nil
+}
+
+// convertConcurrency 将 concurrency 组转换为 Argo 的同步配置，返回带仓库前缀的组名和 cancel-in-progress 设置。
+// 组名在运行时确定时由 Argo 替换，GitHub 的组在仓库内有效，因此互斥锁名带有仓库前缀
+func (c *WorkflowConverter) convertConcurrency(conc *concurrency, eval *evaluator) (*wfv1.Synchronization, string, bool, error) {
+	if conc == nil || strings.TrimSpace(conc.Group) == "" {
+		return nil, "", false, nil
+	}
+	group, err := eval.interpolate(conc.Group)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("failed to evaluate concurrency group: %w", err)
+	}
+
+	cancel := false
+	if strings.TrimSpace(conc.CancelInProgress) != "" {
+		value, err := constantValue(eval, "cancel-in-progress", conc.CancelInProgress)
+		if err != nil {
+			return nil, "", false, err
+		}
+		if cancel, err = strconv.ParseBool(value); err != nil {
+			return nil, "", false, fmt.Errorf("invalid cancel-in-progress %q", value)
+		}
+	}
+
+	if c.concurrencySemaphores[group] {
+		if !configMapKeyPattern.MatchString(group) {
+			return nil, "", false, fmt.Errorf("concurrency group %q cannot be used as a semaphore key", group)
+		}
+		return &wfv1.Synchronization{
+			Semaphores: []*wfv1.SemaphoreRef{{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: c.concurrencyConfigMap},
+					Key:                  group,
+				},
+			}},
+		}, c.scopedGroup(group), cancel, nil
+	}
+	return &wfv1.Synchronization{Mutexes: []*wfv1.Mutex{{Name: c.scopedGroup(group)}}}, c.scopedGroup(group), cancel, nil
+}
+
+// scopedGroup 返回带仓库前缀的 concurrency 组名
+func (c *WorkflowConverter) scopedGroup(group string) string {
+	if c.repository == "" {
+		return group
+	}
+	return c.repository + "/" + group
+}
+
+// applyWorkflowConcurrency 将 workflow 级别的 concurrency 转换为 workflow 的同步配置，组名和
+// cancel-in-progress 记录在注解中，提交方据此终止同组中仍在运行的旧 workflow
+func (c *WorkflowConverter) applyWorkflowConcurrency(argoWf *wfv1.Workflow) error {
+	sync, group, cancel, err := c.convertConcurrency(c.raw.Concurrency, c.newEvaluator(map[string]interface{}{}))
+	if err != nil || sync == nil {
+		return err
+	}
+	argoWf.Spec.Synchronization = sync
+
+	if argoWf.Annotations == nil {
+		argoWf.Annotations = make(map[string]string)
+	}
+	argoWf.Annotations[common.ConcurrencyGroupAnnotation] = group
+	argoWf.Annotations[common.CancelInProgressAnnotation] = strconv.FormatBool(cancel)
+	return nil
+}
+
+// applyJobConcurrency 将 job 级别的 concurrency 转换为 job 入口模板的同步配置，matrix 的每个组合分别求值。
+// job 级别的 cancel-in-progress 需要取消其他 workflow 中的单个 job，无法转换，设置为 true 时返回错误
+func (c *WorkflowConverter) applyJobConcurrency(job *model.Job, eval *evaluator, template *wfv1.Template) error {
+	var conc *concurrency
+	for id, j := range c.githubWorkflow.Jobs {
+		if j == job {
+			conc = c.raw.Jobs[id].Concurrency
+		}
+	}
+	sync, group, cancel, err := c.convertConcurrency(conc, eval)
+	if err != nil || sync == nil {
+		return err
+	}
+	if cancel {
+		return fmt.Errorf("cancel-in-progress of job concurrency group %s is not supported, set it on the workflow concurrency", group)
+	}
+	template.Synchronization = sync
+	return nil
+}
@@ -0,0 +1,696 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	"github.com/rhysd/actionlint"
+)
+
+// jobCondition 是 job if 条件翻译后的 Argo DAG 任务条件
+type jobCondition struct {
+	// Depends 由状态函数（success()、failure() 等）翻译得到的 depends 表达式
+	Depends string
+	// When 由其余表达式翻译得到的 govaluate 表达式
+	When string
+}
+
+// boolExpr 是带常量折叠的布尔表达式，expr 为空时表示常量 value。
+// op 记录最外层运算符（"&&"、"||"、比较运算为 "cmp"），用于拼接时决定是否加括号
+type boolExpr struct {
+	expr  string
+	value bool
+	op    string
+}
+
+func constExpr(value bool) boolExpr {
+	return boolExpr{value: value}
+}
+
+func (e boolExpr) isConst(value bool) bool {
+	return e.expr == "" && e.value == value
+}
+
+func (e boolExpr) and(other boolExpr) boolExpr {
+	switch {
+	case e.isConst(false) || other.isConst(false):
+		return constExpr(false)
+	case e.isConst(true):
+		return other
+	case other.isConst(true):
+		return e
+	}
+	return boolExpr{expr: fmt.Sprintf("%s && %s", e.group("&&"), other.group("&&")), op: "&&"}
+}
+
+func (e boolExpr) or(other boolExpr) boolExpr {
+	switch {
+	case e.isConst(true) || other.isConst(true):
+		return constExpr(true)
+	case e.isConst(false):
+		return other
+	case other.isConst(false):
+		return e
+	}
+	return boolExpr{expr: fmt.Sprintf("%s || %s", e.group("||"), other.group("||")), op: "||"}
+}
+
+func (e boolExpr) not() boolExpr {
+	if e.expr == "" {
+		return constExpr(!e.value)
+	}
+	return boolExpr{expr: "!" + e.group("!")}
+}
+
+// group 返回作为 parent 运算符操作数时的表达式，比较运算优先级高于逻辑运算，
+// 只有取反时需要加括号
+func (e boolExpr) group(parent string) string {
+	if e.expr == "" {
+		return strconv.FormatBool(e.value)
+	}
+	switch {
+	case e.op == "", e.op == parent:
+		return e.expr
+	case e.op == "cmp" && parent != "!":
+		return e.expr
+	}
+	return "(" + e.expr + ")"
+}
+
+// jobResultPredicates 是 needs.<job>.result 取值对应的 Argo 任务状态。
+// Argo 中被终止的节点状态为 Errored，因此 cancelled 映射为 Errored；
+// depends 不满足的任务状态为 Omitted，对应 GitHub 中被跳过的 job
+var jobResultPredicates = map[string][]string{
+	"success":   {"Succeeded"},
+	"failure":   {"Failed", "Errored"},
+	"cancelled": {"Errored"},
+	"skipped":   {"Skipped", "Omitted"},
+}
+
+// failurePredicates 是 failure() 对应的 Argo 任务状态。GitHub 中任一祖先 job 失败
+// failure() 即为真，而上游失败会使中间任务变为 Omitted，因此 Omitted 也计入失败
+var failurePredicates = []string{"Failed", "Errored", "Omitted"}
+
+// statusPredicates 是状态函数对应的 Argo 任务状态
+type statusPredicates struct {
+	success   []string
+	failure   []string
+	always    []string
+	cancelled []string
+}
+
+var allResults = []string{"Succeeded", "Skipped", "Failed", "Errored", "Omitted"}
+
+// jobStatus 用于 job 的 if 条件，状态函数作用于 needs 中的 job
+var jobStatus = statusPredicates{
+	success:   []string{"Succeeded"},
+	failure:   failurePredicates,
+	always:    allResults,
+	cancelled: jobResultPredicates["cancelled"],
+}
+
+// stepStatus 用于 step 的 if 条件，状态函数作用于之前的所有 step。
+// 被 if 跳过的 step 状态为 Skipped，不影响 success()；失败 step 之后的 step 为 Omitted，
+// 失败的 step 本身一定在之前的 step 中，因此 failure() 不需要计入 Omitted
+var stepStatus = statusPredicates{
+	success:   []string{"Succeeded", "Skipped"},
+	failure:   []string{"Failed", "Errored"},
+	always:    allResults,
+	cancelled: []string{"Errored"},
+}
+
+// conditionTranslator 将 GitHub if 表达式翻译为 Argo depends/when 表达式
+type conditionTranslator struct {
+	converter *WorkflowConverter
+	// scope 为 "job" 或 "step"，用于错误信息
+	scope string
+	// needs 是状态函数作用的 DAG 任务
+	needs    []string
+	statuses statusPredicates
+	// eval 用于在转换时求值 matrix 等已知上下文，可以为 nil
+	eval *evaluator
+	// continued 是设置了 continue-on-error 的任务，它们失败时与成功一样不影响状态函数
+	continued map[string]bool
+	// steps 是 step 的 if 条件可以引用的之前的 step，以 step id 为键
+	steps map[string]*stepTask
+}
+
+// translateJobCondition 翻译 job 的 if 条件。不包含状态函数的表达式按 GitHub 规则
+// 隐式追加 success()；无法翻译的表达式返回错误。continued 是设置了 continue-on-error 的 job
+func (c *WorkflowConverter) translateJobCondition(job *model.Job, continued map[string]bool) (*jobCondition, error) {
+	return c.translateCondition(job.If.Value, &conditionTranslator{
+		converter: c,
+		scope:     "job",
+		needs:     jobNeeds(job),
+		statuses:  jobStatus,
+		// reusable workflow 中的 inputs 在转换时已知
+		eval:      c.newEvaluator(map[string]interface{}{}),
+		continued: continued,
+	})
+}
+
+// translateStepCondition 翻译 step 的 if 条件，previous 是作用域中之前所有 step 的 DAG 任务名
+func (c *WorkflowConverter) translateStepCondition(step *model.Step, previous []string, scope *stepScope) (*jobCondition, error) {
+	return c.translateCondition(step.If.Value, &conditionTranslator{
+		converter: c,
+		scope:     "step",
+		needs:     previous,
+		statuses:  stepStatus,
+		eval:      scope.eval,
+		continued: scope.continued,
+		steps:     scope.tasks,
+	})
+}
+
+// continueOnError 解析 step 或 job 的 continue-on-error 设置，取值必须在转换时确定
+func continueOnError(raw string, eval *evaluator) (bool, error) {
+	if strings.TrimSpace(raw) == "" {
+		return false, nil
+	}
+	value, err := constantValue(eval, "continue-on-error", raw)
+	if err != nil {
+		return false, err
+	}
+	continued, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid continue-on-error %q", value)
+	}
+	return continued, nil
+}
+
+// jobContinueOnError 返回 job 的 continue-on-error 设置，matrix 的每个组合分别求值
+func (c *WorkflowConverter) jobContinueOnError(job *model.Job, matrix map[string]interface{}) (bool, error) {
+	var raw string
+	for id, j := range c.githubWorkflow.Jobs {
+		if j == job {
+			raw = c.raw.Jobs[id].ContinueOnError
+		}
+	}
+	return continueOnError(raw, c.newEvaluator(map[string]interface{}{
+		"matrix": matrix,
+	}))
+}
+
+// continueTask 返回在设置了 continue-on-error 的任务 task 之后执行的空任务及其模板，模板名以 template 为前缀。
+// Argo 按 DAG 中没有后续任务的任务的结果确定 DAG 的结果，并且使用 depends 的 DAG 不能设置 continueOn，
+// task 没有后续任务时由空任务吸收它的失败，DAG 与 GitHub 一样不因为 task 失败而失败。
+// 空任务是时长为 0 的 suspend 模板，不需要启动 pod；task 出错或被取消时空任务不会执行
+func continueTask(task, template string) (wfv1.DAGTask, wfv1.Template) {
+	tmpl := wfv1.Template{
+		Name:    template + "-continued",
+		Suspend: &wfv1.SuspendTemplate{Duration: "0"},
+	}
+	return wfv1.DAGTask{
+		Name:     task + "-continued",
+		Template: tmpl.Name,
+		Depends:  taskResult(task, "Succeeded", "Skipped", "Failed").expr,
+	}, tmpl
+}
+
+func (c *WorkflowConverter) translateCondition(raw string, t *conditionTranslator) (*jobCondition, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		raw = "success()"
+	}
+
+	node, err := parseExpression(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var conjuncts []actionlint.ExprNode
+	if !t.usesStatus(node) {
+		conjuncts = append(conjuncts, &actionlint.FuncCallNode{Callee: "success"})
+	}
+	conjuncts = append(conjuncts, splitConjuncts(node)...)
+
+	depends, when := constExpr(true), constExpr(true)
+	for _, conjunct := range conjuncts {
+		status, other := t.usesStatus(conjunct), t.usesOther(conjunct)
+		switch {
+		case status && other:
+			return nil, fmt.Errorf("if condition %q mixes job status checks with other expressions, which Argo cannot express", raw)
+		case status:
+			expr, err := t.status(conjunct)
+			if err != nil {
+				return nil, fmt.Errorf("cannot translate if condition %q: %w", raw, err)
+			}
+			depends = depends.and(expr)
+		default:
+			expr, err := t.when(conjunct)
+			if err != nil {
+				return nil, fmt.Errorf("cannot translate if condition %q: %w", raw, err)
+			}
+			when = when.and(expr)
+		}
+	}
+
+	cond := &jobCondition{}
+	// depends 恒为假时任务永远不会执行，用 when: false 表示
+	if depends.isConst(false) || when.isConst(false) {
+		cond.When = "false"
+		return cond, nil
+	}
+	cond.Depends = depends.expr
+	cond.When = when.expr
+	return cond, nil
+}
+
+// splitConjuncts 将顶层的 && 表达式拆分为多个子条件
+func splitConjuncts(node actionlint.ExprNode) []actionlint.ExprNode {
+	if n, ok := node.(*actionlint.LogicalOpNode); ok && n.Kind == actionlint.LogicalOpNodeKindAnd {
+		return append(splitConjuncts(n.Left), splitConjuncts(n.Right)...)
+	}
+	return []actionlint.ExprNode{node}
+}
+
+func isStatusFunction(name string) bool {
+	switch strings.ToLower(name) {
+	case "success", "failure", "always", "cancelled":
+		return true
+	}
+	return false
+}
+
+// needsResult 判断节点是否为 needs.<job>.result，并返回 job 名
+func needsResult(node actionlint.ExprNode) (string, bool) {
+	path, ok := contextPath(node)
+	if !ok || len(path) != 3 || path[0] != "needs" || path[2] != "result" {
+		return "", false
+	}
+	return path[1], true
+}
+
+// isStatusCompare 判断节点是否为 needs.<job>.result 与字符串常量的比较
+func isStatusCompare(node actionlint.ExprNode) bool {
+	n, ok := node.(*actionlint.CompareOpNode)
+	if !ok || !n.Kind.IsEqualityOp() {
+		return false
+	}
+	_, left := needsResult(n.Left)
+	_, right := needsResult(n.Right)
+	return left || right
+}
+
+// usesStatus 判断表达式中是否包含状态函数或 needs.<job>.result 比较
+func (t *conditionTranslator) usesStatus(node actionlint.ExprNode) bool {
+	found := false
+	actionlint.VisitExprNode(node, func(n, _ actionlint.ExprNode, entering bool) {
+		if !entering {
+			return
+		}
+		if f, ok := n.(*actionlint.FuncCallNode); ok && isStatusFunction(f.Callee) {
+			found = true
+		}
+		if isStatusCompare(n) {
+			found = true
+		}
+	})
+	return found
+}
+
+// usesOther 判断表达式中是否包含状态检查以外的上下文引用或函数调用
+func (t *conditionTranslator) usesOther(node actionlint.ExprNode) bool {
+	switch n := node.(type) {
+	case *actionlint.FuncCallNode:
+		if isStatusFunction(n.Callee) {
+			return false
+		}
+		return true
+	case *actionlint.CompareOpNode:
+		if isStatusCompare(n) {
+			return false
+		}
+		return true
+	case *actionlint.NotOpNode:
+		return t.usesOther(n.Operand)
+	case *actionlint.LogicalOpNode:
+		return t.usesOther(n.Left) || t.usesOther(n.Right)
+	case *actionlint.BoolNode, *actionlint.NullNode, *actionlint.IntNode, *actionlint.FloatNode, *actionlint.StringNode:
+		return false
+	}
+	return true
+}
+
+// anyNeed 对所有 needs 任务取任一状态满足的析取
+func (t *conditionTranslator) anyNeed(results ...string) boolExpr {
+	expr := constExpr(false)
+	for _, need := range t.needs {
+		expr = expr.or(taskResult(need, t.results(need, results)...))
+	}
+	return expr
+}
+
+// allNeeds 对所有 needs 任务取状态满足的合取
+func (t *conditionTranslator) allNeeds(results ...string) boolExpr {
+	expr := constExpr(true)
+	for _, need := range t.needs {
+		expr = expr.and(taskResult(need, t.results(need, results)...))
+	}
+	return expr
+}
+
+// results 返回任务满足状态检查的结果。continue-on-error 的任务失败时在 GitHub 中的结论为成功，
+// 因此 Failed 计入成功而不计入失败
+func (t *conditionTranslator) results(task string, results []string) []string {
+	if !t.continued[task] || containsString(results, "Failed") == containsString(results, "Succeeded") {
+		return results
+	}
+	adjusted := make([]string, 0, len(results)+1)
+	for _, result := range results {
+		if result != "Failed" {
+			adjusted = append(adjusted, result)
+		}
+	}
+	if containsString(results, "Succeeded") {
+		adjusted = append(adjusted, "Failed")
+	}
+	return adjusted
+}
+
+func taskResult(task string, results ...string) boolExpr {
+	expr := constExpr(false)
+	for _, result := range results {
+		expr = expr.or(boolExpr{expr: fmt.Sprintf("%s.%s", task, result)})
+	}
+	return expr
+}
+
+// status 将状态检查翻译为 Argo depends 表达式
+func (t *conditionTranslator) status(node actionlint.ExprNode) (boolExpr, error) {
+	switch n := node.(type) {
+	case *actionlint.BoolNode:
+		return constExpr(n.Value), nil
+	case *actionlint.NotOpNode:
+		operand, err := t.status(n.Operand)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		return operand.not(), nil
+	case *actionlint.LogicalOpNode:
+		left, err := t.status(n.Left)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		right, err := t.status(n.Right)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		if n.Kind == actionlint.LogicalOpNodeKindAnd {
+			return left.and(right), nil
+		}
+		return left.or(right), nil
+	case *actionlint.FuncCallNode:
+		if len(n.Args) != 0 {
+			return boolExpr{}, fmt.Errorf("%s() does not take arguments", n.Callee)
+		}
+		switch strings.ToLower(n.Callee) {
+		case "success":
+			return t.allNeeds(t.statuses.success...), nil
+		case "failure":
+			return t.anyNeed(t.statuses.failure...), nil
+		case "always":
+			return t.allNeeds(t.statuses.always...), nil
+		case "cancelled":
+			return t.anyNeed(t.statuses.cancelled...), nil
+		}
+	case *actionlint.CompareOpNode:
+		if t.scope != "job" {
+			return boolExpr{}, fmt.Errorf("needs.<job>.result is not available in %s if conditions", t.scope)
+		}
+		job, ok := needsResult(n.Left)
+		value := n.Right
+		if !ok {
+			job, _ = needsResult(n.Right)
+			value = n.Left
+		}
+		result, ok := value.(*actionlint.StringNode)
+		if !ok {
+			return boolExpr{}, fmt.Errorf("needs.%s.result must be compared with a string literal", job)
+		}
+		if !containsString(t.needs, job) {
+			return boolExpr{}, fmt.Errorf("needs.%s.result references a job that is not listed in needs", job)
+		}
+		predicates, ok := jobResultPredicates[strings.ToLower(result.Value)]
+		if !ok {
+			return boolExpr{}, fmt.Errorf("unknown job result %q", result.Value)
+		}
+		expr := taskResult(job, t.results(job, predicates)...)
+		if n.Kind == actionlint.CompareOpNodeKindNotEq {
+			expr = expr.not()
+		}
+		return expr, nil
+	}
+	return boolExpr{}, fmt.Errorf("unsupported status expression")
+}
+
+// when 将不含状态检查的表达式翻译为 Argo when 使用的 govaluate 表达式。
+// GitHub 的字符串比较不区分大小写，而 govaluate 区分大小写，因此字符串操作数统一转为小写后比较
+func (t *conditionTranslator) when(node actionlint.ExprNode) (boolExpr, error) {
+	switch n := node.(type) {
+	case *actionlint.BoolNode:
+		return constExpr(n.Value), nil
+	case *actionlint.NotOpNode:
+		operand, err := t.when(n.Operand)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		return operand.not(), nil
+	case *actionlint.LogicalOpNode:
+		left, err := t.when(n.Left)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		right, err := t.when(n.Right)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		if n.Kind == actionlint.LogicalOpNodeKindAnd {
+			return left.and(right), nil
+		}
+		return left.or(right), nil
+	case *actionlint.CompareOpNode:
+		numeric := isNumberNode(n.Left) || isNumberNode(n.Right)
+		left, err := t.operand(n.Left, numeric)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		right, err := t.operand(n.Right, numeric)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		return boolExpr{expr: fmt.Sprintf("%s %s %s", left, n.Kind.String(), right), op: "cmp"}, nil
+	case *actionlint.FuncCallNode:
+		return t.stringFunction(n)
+	}
+
+	// 单独出现的上下文引用按 GitHub 的真值规则处理。运行时取值都是字符串，无法区分布尔值 false 和字符串 'false'，
+	// 因此空字符串、false 和 0 为假，其他取值为真
+	if _, ok := contextPath(node); ok {
+		ref, err := t.operand(node, false)
+		if err != nil {
+			return boolExpr{}, err
+		}
+		return boolExpr{expr: fmt.Sprintf("%s != '' && %s != 'false' && %s != '0'", ref, ref, ref), op: "&&"}, nil
+	}
+	return boolExpr{}, fmt.Errorf("unsupported expression in if condition")
+}
+
+// stringFunction 将 startsWith/endsWith/contains 翻译为 govaluate 的正则匹配
+func (t *conditionTranslator) stringFunction(n *actionlint.FuncCallNode) (boolExpr, error) {
+	if len(n.Args) != 2 {
+		return boolExpr{}, fmt.Errorf("%s() expects 2 arguments", n.Callee)
+	}
+	search, ok := n.Args[1].(*actionlint.StringNode)
+	if !ok {
+		return boolExpr{}, fmt.Errorf("%s() is only supported with a string literal as second argument", n.Callee)
+	}
+	subject, err := t.operand(n.Args[0], false)
+	if err != nil {
+		return boolExpr{}, err
+	}
+
+	// GitHub 的字符串函数不区分大小写
+	pattern := "(?i)" + regexp.QuoteMeta(search.Value)
+	switch strings.ToLower(n.Callee) {
+	case "startswith":
+		pattern = "(?i)^" + regexp.QuoteMeta(search.Value)
+	case "endswith":
+		pattern += "$"
+	case "contains":
+	default:
+		return boolExpr{}, fmt.Errorf("function %s() is not supported in if conditions", n.Callee)
+	}
+	return boolExpr{expr: fmt.Sprintf("%s =~ %s", subject, quoteGovaluate(pattern)), op: "cmp"}, nil
+}
+
+// operand 翻译比较运算的操作数，上下文引用翻译为 workflow 参数
+func (t *conditionTranslator) operand(node actionlint.ExprNode, numeric bool) (string, error) {
+	switch n := node.(type) {
+	case *actionlint.StringNode:
+		return quoteGovaluate(strings.ToLower(n.Value)), nil
+	case *actionlint.IntNode:
+		return strconv.Itoa(n.Value), nil
+	case *actionlint.FloatNode:
+		return strconv.FormatFloat(n.Value, 'f', -1, 64), nil
+	case *actionlint.BoolNode:
+		return quoteGovaluate(strconv.FormatBool(n.Value)), nil
+	case *actionlint.NullNode:
+		return "''", nil
+	case *actionlint.FuncCallNode:
+		return "", fmt.Errorf("function %s() is not supported in if conditions", n.Callee)
+	}
+
+	path, ok := contextPath(node)
+	if !ok {
+		return "", fmt.Errorf("unsupported operand in if condition")
+	}
+	var ref string
+	if t.scope == "step" && path[0] == "steps" {
+		return t.stepOperand(path)
+	} else if t.eval != nil && t.eval.handles(path[0]) {
+		// 转换时已知的上下文直接替换为常量，needs 输出等运行时取值使用求值器给出的引用
+		value, err := t.eval.resolve(path)
+		if err != nil {
+			return "", err
+		}
+		switch v := value.(type) {
+		case shellValue, secretValue:
+			return "", fmt.Errorf("%s cannot be used in if conditions", strings.Join(path, "."))
+		case runtimeValue:
+			ref = string(v)
+		default:
+			if numeric {
+				return strconv.FormatFloat(toNumber(value), 'f', -1, 64), nil
+			}
+			return quoteGovaluate(strings.ToLower(toString(value))), nil
+		}
+	} else if t.scope == "job" && len(path) == 4 && path[0] == "needs" && path[2] == "outputs" {
+		// 上游 job 的输出可以直接在 when 中引用任务输出参数
+		if !containsString(t.needs, path[1]) {
+			return "", fmt.Errorf("needs.%s references a job that is not listed in needs", path[1])
+		}
+		outputs, err := t.converter.jobOutputs(t.converter.githubWorkflow.Jobs[path[1]])
+		if err != nil {
+			return "", err
+		}
+		if !containsString(outputs, path[3]) {
+			return "", fmt.Errorf("job %s does not declare output %s", path[1], path[3])
+		}
+		ref = fmt.Sprintf("{{tasks.%s.outputs.parameters.%s}}", path[1], path[3])
+	} else if run, ok := workflowRunRefs[path[len(path)-1]]; ok && len(path) == 2 && path[0] == "github" {
+		ref = run
+	} else {
+		name, ok := t.converter.contextParameterName(path)
+		if !ok {
+			return "", fmt.Errorf("context %s is not available in %s if conditions", path[0], t.scope)
+		}
+		ref = t.converter.workflowParameter(name)
+	}
+	return quoteRuntime(ref, numeric), nil
+}
+
+// stepOperand 翻译 step 的 if 条件中的 steps 上下文。steps.<id>.outputs.<name> 引用 step 任务的输出参数；
+// outcome 和 conclusion 由任务的状态得到，设置了 continue-on-error 的 step 失败时 conclusion 为 success
+func (t *conditionTranslator) stepOperand(path []string) (string, error) {
+	if len(path) < 3 {
+		return "", fmt.Errorf("%s is not supported in if conditions", strings.Join(path, "."))
+	}
+	task, ok := t.steps[path[1]]
+	if !ok {
+		return "", fmt.Errorf("step %s is not defined before it is referenced", path[1])
+	}
+	switch {
+	case len(path) == 4 && path[2] == "outputs":
+		ref, err := task.outputParameter(path[1], path[3])
+		if err != nil {
+			return "", err
+		}
+		return quoteRuntime(ref, false), nil
+	case len(path) == 3 && (path[2] == "outcome" || path[2] == "conclusion"):
+		status := exprPath("tasks." + task.name + ".status")
+		success := "'Succeeded'"
+		if path[2] == "conclusion" && t.continued[task.name] {
+			success = "'Succeeded', 'Failed'"
+		}
+		return fmt.Sprintf("'{{=%s in [%s] ? 'success' : %s in ['Skipped', 'Omitted'] ? 'skipped' : 'failure'}}'", status, success, status), nil
+	}
+	return "", fmt.Errorf("%s is not supported in if conditions", strings.Join(path, "."))
+}
+
+// templateRefPattern 匹配 Argo 模板中的 {{...}} 引用
+var templateRefPattern = regexp.MustCompile(`\{\{\s*([-\w.]+)\s*\}\}`)
+
+// quoteRuntime 将包含运行时引用的取值翻译为 govaluate 操作数。Argo 在求值 when 之前按文本替换引用，
+// 取值中的引号会改变表达式，因此引用改为 Argo 表达式标签，在替换时转义引号并转为小写；
+// 数值操作数必须能转换为数字
+func quoteRuntime(ref string, numeric bool) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range templateRefPattern.FindAllStringSubmatchIndex(ref, -1) {
+		b.WriteString(escapeGovaluate(strings.ToLower(ref[last:m[0]])))
+		value := exprPath(ref[m[2]:m[3]])
+		if numeric {
+			fmt.Fprintf(&b, "{{=asFloat(%s)}}", value)
+		} else {
+			fmt.Fprintf(&b, `{{=sprig.replace("'", "\\'", sprig.replace("\\", "\\\\", sprig.lower(%s)))}}`, value)
+		}
+		last = m[1]
+	}
+	b.WriteString(escapeGovaluate(strings.ToLower(ref[last:])))
+	if numeric {
+		return b.String()
+	}
+	return "'" + b.String() + "'"
+}
+
+// identifierPattern 匹配表达式标签中可以直接用 . 访问的名称
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// exprPath 将 workflow.parameters.github-ref 这样的引用转换为表达式标签中的变量访问，
+// 包含 '-' 等字符的名称使用下标访问
+func exprPath(ref string) string {
+	parts := strings.Split(ref, ".")
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, part := range parts[1:] {
+		if identifierPattern.MatchString(part) {
+			b.WriteString("." + part)
+		} else {
+			b.WriteString("['" + part + "']")
+		}
+	}
+	return b.String()
+}
+
+func isNumberNode(node actionlint.ExprNode) bool {
+	switch node.(type) {
+	case *actionlint.IntNode, *actionlint.FloatNode:
+		return true
+	}
+	return false
+}
+
+// quoteGovaluate 生成 govaluate 的单引号字符串，govaluate 会处理反斜杠转义
+func quoteGovaluate(s string) string {
+	return "'" + escapeGovaluate(s) + "'"
+}
+
+// escapeGovaluate 转义 govaluate 单引号字符串中的反斜杠和引号
+func escapeGovaluate(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `'`, `\'`)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package converter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/kballard/go-shellquote"
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// --shm-size 通过挂载到 /dev/shm 的内存卷实现
+const (
+	shmVolume = "dshm"
+	shmDir    = "/dev/shm"
+)
+
+// dockerBytesPattern 是 Docker 的内存大小格式，例如 512m、1.5g
+var dockerBytesPattern = regexp.MustCompile(`^(\d+(?:\.\d+)?) ?([kKmMgGtTpP])?[iI]?[bB]?$`)
+
+// WithImagePullSecrets 设置镜像仓库地址到 docker-registry 类型 Secret 名称的映射，Docker Hub 的地址为 docker.io。
+// container 和 services 配置了 credentials 时使用对应的 Secret 拉取镜像
+func WithImagePullSecrets(secrets map[string]string) Option {
+	return func(c *WorkflowConverter) {
+		c.imagePullSecrets = secrets
+	}
+}
+
+// jobPod 是 job 在 pod 级别的配置，包括服务 sidecar、服务主机名和容器卷，运行 step 的模板都需要添加
+type jobPod struct {
+	sidecars    []wfv1.UserContainer
+	hostAliases []corev1.HostAlias
+	volumes     []corev1.Volume
+	// volumeNames 记录已添加的命名卷和主机目录对应的卷名，同一个卷在各容器间共享
+	volumeNames map[string]string
+	// arch 是 job 运行的节点架构，即 RUNNER_ARCH 的取值
+	arch string
+	// daemons 为 true 时服务不作为 sidecar，而是由 job 的 daemon 任务运行，见 serviceTasks
+	daemons bool
+}
+
+// apply 为运行 step 的模板添加 pod 级别的配置
+func (p *jobPod) apply(template *wfv1.Template) {
+	if p == nil {
+		return
+	}
+	if p.daemons {
+		p.serviceInputs(template)
+	} else {
+		for _, sidecar := range p.sidecars {
+			template.Sidecars = append(template.Sidecars, *sidecar.DeepCopy())
+		}
+		for _, alias := range p.hostAliases {
+			template.HostAliases = append(template.HostAliases, *alias.DeepCopy())
+		}
+	}
+	for _, volume := range p.volumes {
+		template.Volumes = append(template.Volumes, *volume.DeepCopy())
+	}
+}
+
+// mount 将 Docker 的卷配置 [source:]target[:mode] 转换为卷挂载。source 为绝对路径时挂载节点上的目录，
+// 命名卷和匿名卷使用 emptyDir，只在 pod 内有效
+func (p *jobPod) mount(raw string) (corev1.VolumeMount, error) {
+	var source, target, mode string
+	switch parts := strings.Split(raw, ":"); len(parts) {
+	case 1:
+		target = parts[0]
+	case 2:
+		source, target = parts[0], parts[1]
+	case 3:
+		source, target, mode = parts[0], parts[1], parts[2]
+	default:
+		return corev1.VolumeMount{}, fmt.Errorf("invalid volume %q", raw)
+	}
+	if !path.IsAbs(target) {
+		return corev1.VolumeMount{}, fmt.Errorf("invalid volume %q, the container path must be absolute", raw)
+	}
+
+	mount := corev1.VolumeMount{MountPath: target}
+	if mode != "" {
+		for _, opt := range strings.Split(mode, ",") {
+			switch opt {
+			case "ro":
+				mount.ReadOnly = true
+			case "rw":
+			default:
+				return corev1.VolumeMount{}, fmt.Errorf("volume option %s is not supported", opt)
+			}
+		}
+	}
+
+	key := source
+	if path.IsAbs(source) {
+		key = "host:" + path.Clean(source)
+	}
+	if name, ok := p.volumeNames[key]; ok && source != "" {
+		mount.Name = name
+		return mount, nil
+	}
+
+	volume := corev1.Volume{Name: fmt.Sprintf("container-volume-%d", len(p.volumes))}
+	if path.IsAbs(source) {
+		volume.HostPath = &corev1.HostPathVolumeSource{Path: path.Clean(source)}
+	} else {
+		volume.EmptyDir = &corev1.EmptyDirVolumeSource{}
+	}
+	p.volumes = append(p.volumes, volume)
+	if source != "" {
+		if p.volumeNames == nil {
+			p.volumeNames = make(map[string]string)
+		}
+		p.volumeNames[key] = volume.Name
+	}
+	mount.Name = volume.Name
+	return mount, nil
+}
+
+// applyContainerSpec 将 job 的 container 配置应用到 job 的基础容器：env 作为容器环境变量，
+// ports 和 volumes 转换为容器端口和卷挂载，options 转换为资源限制和安全上下文
+func (c *WorkflowConverter) applyContainerSpec(container *corev1.Container, spec *model.ContainerSpec, image string, eval *evaluator, pod *jobPod) error {
+	if err := c.registryCredentials(image, spec.Credentials); err != nil {
+		return err
+	}
+
+	env, err := evaluateEnv(eval, nil, spec.Env)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate container env: %w", err)
+	}
+	vars, err := envVars(env)
+	if err != nil {
+		return err
+	}
+	container.Env = mergeEnvVars(container.Env, vars)
+
+	for _, raw := range spec.Ports {
+		port, err := containerPort(raw)
+		if err != nil {
+			return err
+		}
+		container.Ports = append(container.Ports, port)
+	}
+	for _, raw := range spec.Volumes {
+		mount, err := pod.mount(raw)
+		if err != nil {
+			return err
+		}
+		container.VolumeMounts = append(container.VolumeMounts, mount)
+	}
+
+	return applyContainerOptions(container, spec.Options, pod)
+}
+
+// applyContainerOptions 将 job 容器的 Docker 选项应用到容器，支持 --cpus、--memory、--user、
+// --privileged 和 --shm-size，无法转换的选项报错
+func applyContainerOptions(container *corev1.Container, options string, pod *jobPod) error {
+	opts, err := parseDockerOptions(options, "--privileged")
+	if err != nil {
+		return err
+	}
+
+	for _, opt := range opts {
+		switch opt.flag {
+		case "--cpus":
+			cpus, err := resource.ParseQuantity(opt.value)
+			if err != nil || cpus.Sign() <= 0 {
+				return fmt.Errorf("invalid %s %q", opt.flag, opt.value)
+			}
+			setResourceLimit(container, corev1.ResourceCPU, cpus)
+		case "--memory", "-m":
+			memory, err := dockerBytes(opt.value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", opt.flag, opt.value, err)
+			}
+			setResourceLimit(container, corev1.ResourceMemory, memory)
+		case "--shm-size":
+			size, err := dockerBytes(opt.value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", opt.flag, opt.value, err)
+			}
+			pod.volumes = append(pod.volumes, corev1.Volume{
+				Name: shmVolume,
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: &size},
+				},
+			})
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: shmVolume, MountPath: shmDir})
+		case "--user", "-u":
+			if container.SecurityContext == nil {
+				container.SecurityContext = &corev1.SecurityContext{}
+			}
+			user, group, hasGroup := strings.Cut(opt.value, ":")
+			uid, err := strconv.ParseInt(user, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q, only numeric uid[:gid] is supported", opt.flag, opt.value)
+			}
+			container.SecurityContext.RunAsUser = &uid
+			if hasGroup {
+				gid, err := strconv.ParseInt(group, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid %s %q, only numeric uid[:gid] is supported", opt.flag, opt.value)
+				}
+				container.SecurityContext.RunAsGroup = &gid
+			}
+		case "--privileged":
+			privileged, err := strconv.ParseBool(opt.value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q", opt.flag, opt.value)
+			}
+			if container.SecurityContext == nil {
+				container.SecurityContext = &corev1.SecurityContext{}
+			}
+			container.SecurityContext.Privileged = &privileged
+		default:
+			return fmt.Errorf("option %s is not supported", opt.flag)
+		}
+	}
+	return nil
+}
+
+// setResourceLimit 设置容器的资源上限，超过上限的资源请求降低到上限
+func setResourceLimit(container *corev1.Container, name corev1.ResourceName, limit resource.Quantity) {
+	if container.Resources.Limits == nil {
+		container.Resources.Limits = corev1.ResourceList{}
+	}
+	container.Resources.Limits[name] = limit
+	if request, ok := container.Resources.Requests[name]; ok && request.Cmp(limit) > 0 {
+		container.Resources.Requests[name] = limit
+	}
+}
+
+// dockerBytes 将 Docker 的内存大小转换为 Kubernetes 的资源数量，单位按 1024 进位
+func dockerBytes(value string) (resource.Quantity, error) {
+	match := dockerBytesPattern.FindStringSubmatch(value)
+	if match == nil {
+		return resource.Quantity{}, fmt.Errorf("invalid size")
+	}
+	quantity := match[1]
+	if match[2] != "" {
+		quantity += strings.ToUpper(match[2]) + "i"
+	}
+	return resource.ParseQuantity(quantity)
+}
+
+// dockerOption 是 options 中的一个 Docker 命令行选项
+type dockerOption struct {
+	flag  string
+	value string
+}
+
+// parseDockerOptions 解析 container 和 services 的 options，选项值可以写成 --flag value 或 --flag=value，
+// boolFlags 中的选项可以不带值
+func parseDockerOptions(options string, boolFlags ...string) ([]dockerOption, error) {
+	args, err := shellquote.Split(options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options %q: %w", options, err)
+	}
+
+	var opts []dockerOption
+	for i := 0; i < len(args); i++ {
+		if !strings.HasPrefix(args[i], "-") {
+			return nil, fmt.Errorf("invalid options %q, unexpected argument %s", options, args[i])
+		}
+		flag, value, ok := strings.Cut(args[i], "=")
+		if !ok {
+			switch {
+			case containsString(boolFlags, flag):
+				value = "true"
+			case i+1 == len(args):
+				return nil, fmt.Errorf("option %s requires a value", flag)
+			default:
+				i++
+				value = args[i]
+			}
+		}
+		opts = append(opts, dockerOption{flag: flag, value: value})
+	}
+	return opts, nil
+}
+
+// imageRegistry 返回镜像所在的仓库地址，没有仓库地址的镜像来自 docker.io
+func imageRegistry(image string) string {
+	if host, _, ok := strings.Cut(image, "/"); ok && (strings.ContainsAny(host, ".:") || host == "localhost") {
+		return host
+	}
+	return "docker.io"
+}
+
+// registryCredentials 为配置了 credentials 的镜像登记镜像仓库对应的拉取 Secret。
+// 用户名和密码保存在 Secret 中，不会写入 workflow
+func (c *WorkflowConverter) registryCredentials(image string, credentials map[string]string) error {
+	if len(credentials) == 0 {
+		return nil
+	}
+	registry := imageRegistry(image)
+	secret, ok := c.imagePullSecrets[registry]
+	if !ok {
+		return fmt.Errorf("credentials for registry %s require an image pull secret mapping", registry)
+	}
+	if c.pullSecrets == nil {
+		c.pullSecrets = make(map[string]bool)
+	}
+	c.pullSecrets[secret] = true
+	return nil
+}
+
+// workflowPullSecrets 返回 workflow 需要的镜像拉取 Secret，按名称排序
+func (c *WorkflowConverter) workflowPullSecrets() []corev1.LocalObjectReference {
+	names := make([]string, 0, len(c.pullSecrets))
+	for name := range c.pullSecrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	refs := make([]corev1.LocalObjectReference, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+	return refs
+}
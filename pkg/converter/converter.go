@@ -4,26 +4,109 @@ package converter
 import (
 	"bytes"
 	"fmt"
-	"log"
-	"os"
+	"io/fs"
+	"path"
+	"sort"
 	"strings"
+	"testing/fstest"
 
 	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
 	"github.com/nektos/act/pkg/model"
+	"github.com/opensourceways/argus-worker/pkg/common"
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8syaml "sigs.k8s.io/yaml"
 )
 
 type WorkflowConverter struct {
 	githubWorkflow *model.Workflow
+	// workspace 是仓库文件，用于 hashFiles() 和读取本地 action、reusable workflow
+	workspace fs.FS
+	// parameters 记录转换过程中引用到的运行时 workflow 参数
+	parameters map[string]bool
+	// stepTemplates 为 true 时每个 step 生成独立的模板
+	stepTemplates bool
+	// workspaceJobs 记录按 step 生成了模板的 job，每个 job 需要一个工作区卷，workspaceVolume 是卷的配置
+	workspaceJobs   []string
+	workspaceVolume WorkspaceVolume
+	// repository 是 workflow 所属的仓库，格式为 owner/repo
+	repository string
+	// secretMapping 是仓库或组织到 Kubernetes Secret 名称的映射
+	secretMapping map[string]string
+	// actionSource 是远程 action 的源码目录，用于读取 action 元数据
+	actionSource fs.FS
+	// nodeImage 是运行 JavaScript action 的镜像
+	nodeImage string
+	// actionVolume 是包含远程 action 源码的卷，node action 运行时挂载
+	actionVolume *corev1.VolumeSource
+	// usesActionVolume 记录是否有 step 挂载了 action 卷
+	usesActionVolume bool
+	// imagePullSecrets 是镜像仓库地址到镜像拉取 Secret 的映射
+	imagePullSecrets map[string]string
+	// pullSecrets 记录 credentials 用到的镜像拉取 Secret
+	pullSecrets map[string]bool
+	// source 是 workflow 的原始 YAML，raw 是从中读取的 act 模型之外的字段
+	source []byte
+	raw    *rawWorkflow
+	// concurrencyConfigMap 是 concurrency 信号量所在的 ConfigMap，concurrencySemaphores 是使用信号量的组
+	concurrencyConfigMap  string
+	concurrencySemaphores map[string]bool
+	// call 是正在展开的 reusable workflow 的调用信息，转换顶层 workflow 时为 nil
+	call *workflowCall
+	// eventSensor 为 true 时 ConvertWorkflow 同时生成 Sensor 和 EventSource，sensorServiceAccount 是 Sensor 的 ServiceAccount
+	eventSensor          bool
+	sensorServiceAccount string
+	// webhookSecret 是 EventSource 校验 GitHub webhook 签名的密钥
+	webhookSecret corev1.SecretKeySelector
+	// inputs 是手动触发时传入的 workflow_dispatch 输入，为 nil 时使用默认值
+	inputs map[string]interface{}
+	// event 是由 WithEventContext 设置的事件计算出的 github 上下文，为 nil 时 github.* 作为运行时参数
+	event map[string]interface{}
+	// runnerArch 是无法从 runs-on 判断架构时 RUNNER_ARCH 的取值
+	runnerArch string
+	// environments 是部署环境的配置，approvals 记录需要审批的 job 及其部署的环境
+	environments map[string]Environment
+	approvals    map[*model.Job][]string
 }
 
-func NewConverter(ghWorkflow *model.Workflow) *WorkflowConverter {
-	return &WorkflowConverter{
+// Option 是 WorkflowConverter 的可选配置
+type Option func(*WorkflowConverter)
+
+// WithWorkspace 设置仓库文件，hashFiles() 会在其中匹配文件，本地 action 和 reusable workflow（uses: ./path）从中读取
+func WithWorkspace(workspace fs.FS) Option {
+	return func(c *WorkflowConverter) {
+		c.workspace = workspace
+	}
+}
+
+// WithWorkspaceFiles 使用内存中的仓库文件作为工作区，键为相对仓库根目录的路径，值为文件内容
+func WithWorkspaceFiles(files map[string]string) Option {
+	workspace := make(fstest.MapFS, len(files))
+	for name, data := range files {
+		workspace[path.Clean(strings.TrimLeft(name, "/"))] = &fstest.MapFile{Data: []byte(data)}
+	}
+	return WithWorkspace(workspace)
+}
+
+// WithStepTemplates 让每个 step 生成独立的模板，job 转换为按 step 顺序执行的 DAG 模板，
+// 各 step 通过共享卷使用同一个工作区
+func WithStepTemplates() Option {
+	return func(c *WorkflowConverter) {
+		c.stepTemplates = true
+	}
+}
+
+func NewConverter(ghWorkflow *model.Workflow, opts ...Option) *WorkflowConverter {
+	c := &WorkflowConverter{
 		githubWorkflow: ghWorkflow,
+		nodeImage:      defaultNodeImage,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *WorkflowConverter) Run() (*wfv1.Workflow, error) {
@@ -31,6 +114,18 @@ func (c *WorkflowConverter) Run() (*wfv1.Workflow, error) {
 		return nil, fmt.Errorf("GitHub workflow is nil")
 	}
 
+	c.parameters = make(map[string]bool)
+	c.workspaceJobs = nil
+	c.usesActionVolume = false
+	c.pullSecrets = nil
+	c.approvals = make(map[*model.Job][]string)
+
+	raw, err := parseRawWorkflow(c.source)
+	if err != nil {
+		return nil, err
+	}
+	c.raw = raw
+
 	// 创建 Argo Workflow 对象
 	argoWf := &wfv1.Workflow{
 		TypeMeta: metav1.TypeMeta{
@@ -45,31 +140,51 @@ func (c *WorkflowConverter) Run() (*wfv1.Workflow, error) {
 		},
 	}
 
-	// 创建主 DAG 模板
-	mainTemplate := wfv1.Template{
-		Name: "main",
-		DAG:  &wfv1.DAGTemplate{},
+	// 按 needs 的顺序转换每个 job，由主 DAG 模板执行
+	jobTemplates, mainTemplate, err := c.convertJobs("main", "")
+	if err != nil {
+		return nil, err
 	}
+	argoWf.Spec.Templates = append(argoWf.Spec.Templates, jobTemplates...)
 
-	// 转换每个 job
-	for jobName, job := range c.githubWorkflow.Jobs {
-		// 为每个 job 创建一个独立的 template
-		jobTemplate, err := c.convertJobToTemplate(jobName, job)
-		if err != nil {
-			return nil, fmt.Errorf("failed to convert job %s: %w", jobName, err)
+	// 由 workflow_call 触发的 workflow 的 outputs 作为主 DAG 模板的输出参数
+	callable := isCallable(c.githubWorkflow)
+	if callable {
+		if mainTemplate.Outputs.Parameters, err = c.callOutputs(c.githubWorkflow.WorkflowCallConfig()); err != nil {
+			return nil, err
 		}
-		argoWf.Spec.Templates = append(argoWf.Spec.Templates, *jobTemplate)
-
-		// 在 DAG 中添加任务
-		mainTemplate.DAG.Tasks = append(mainTemplate.DAG.Tasks, wfv1.DAGTask{
-			Name:     jobName,
-			Template: jobName,
-		})
 	}
 
 	// 将主 DAG 模板添加到 templates 列表
 	argoWf.Spec.Templates = append(argoWf.Spec.Templates, mainTemplate)
 
+	// workflow 级别的 concurrency 组同一时间只运行一个 workflow
+	if err := c.applyWorkflowConcurrency(argoWf); err != nil {
+		return nil, err
+	}
+
+	// 表达式中引用的运行时上下文作为 workflow 参数，由提交方传入
+	argoWf.Spec.Arguments.Parameters = c.workflowParameters()
+	if dispatch := c.githubWorkflow.WorkflowDispatchConfig(); dispatch != nil {
+		if argoWf.Spec.Arguments.Parameters, err = c.dispatchParameters(argoWf.Spec.Arguments.Parameters, dispatch); err != nil {
+			return nil, err
+		}
+	}
+	if callable {
+		argoWf.Spec.Arguments.Parameters = callParameters(argoWf.Spec.Arguments.Parameters, c.githubWorkflow.WorkflowCallConfig())
+	}
+
+	// step 模板通过 job 的工作区卷共享工作区
+	if argoWf.Spec.VolumeClaimTemplates, err = c.workspaceClaims(); err != nil {
+		return nil, err
+	}
+	if c.usesActionVolume {
+		argoWf.Spec.Volumes = append(argoWf.Spec.Volumes, corev1.Volume{Name: actionsVolume, VolumeSource: *c.actionVolume})
+	}
+	if len(c.pullSecrets) > 0 {
+		argoWf.Spec.ImagePullSecrets = c.workflowPullSecrets()
+	}
+
 	return argoWf, nil
 }
 
@@ -268,70 +383,427 @@ func parseHandler(handler map[interface{}]interface{}) *corev1.LifecycleHandler
 	return result
 }
 
-func (c *WorkflowConverter) convertJobToTemplate(jobName string, job *model.Job) (*wfv1.Template, error) {
-	template := &wfv1.Template{
+// convertJobs 按 needs 计算的执行阶段转换 workflow 中的每个 job，返回 job 的模板和执行它们的名为 name 的
+// DAG 模板。job 模板名以 prefix 为前缀，DAG 任务名为 job ID
+func (c *WorkflowConverter) convertJobs(name, prefix string) ([]wfv1.Template, wfv1.Template, error) {
+	dag := wfv1.Template{
+		Name: name,
+		DAG:  &wfv1.DAGTemplate{},
+	}
+
+	// 按 needs 计算执行阶段，同时校验未知 job 和循环依赖
+	stages, err := jobStages(c.githubWorkflow)
+	if err != nil {
+		return nil, dag, err
+	}
+
+	var templates []wfv1.Template
+	// continued 记录设置了 continue-on-error 的 job，它们失败时依赖它们的 job 与成功时一样执行
+	continued := make(map[string]bool)
+	needed := make(map[string]bool)
+	var continuedJobs []string
+	for _, stage := range stages {
+		for _, jobName := range stage {
+			job := c.githubWorkflow.Jobs[jobName]
+
+			// 为每个 job 创建独立的 template，matrix job 会展开为多个 template
+			jobTemplates, inputs, jobContinued, err := c.convertJob(prefix+jobName, job)
+			if err != nil {
+				return nil, dag, fmt.Errorf("failed to convert job %s: %w", jobName, err)
+			}
+			templates = append(templates, jobTemplates...)
+
+			// needs 和 if 条件转换为 DAG 任务的 depends/when
+			cond, err := c.translateJobCondition(job, continued)
+			if err != nil {
+				return nil, dag, fmt.Errorf("failed to convert job %s: %w", jobName, err)
+			}
+
+			// 在 DAG 中添加任务
+			task := wfv1.DAGTask{
+				Name:     jobName,
+				Template: prefix + jobName,
+				Depends:  cond.Depends,
+				When:     cond.When,
+				// 引用的上游 job 输出从对应任务的输出参数传入
+				Arguments: wfv1.Arguments{
+					Parameters: inputParameters(inputs, func(name string) string { return inputs[name] }),
+				},
+			}
+
+			// 部署到需要审批的环境的 job 在审批任务通过后执行
+			if len(c.approvals[job]) > 0 {
+				template, approval, err := c.approvalTask(jobName, prefix, c.approvals[job], &task)
+				if err != nil {
+					return nil, dag, fmt.Errorf("failed to convert job %s: %w", jobName, err)
+				}
+				templates = append(templates, template)
+				dag.DAG.Tasks = append(dag.DAG.Tasks, approval)
+			}
+			dag.DAG.Tasks = append(dag.DAG.Tasks, task)
+
+			if jobContinued {
+				continued[jobName] = true
+				continuedJobs = append(continuedJobs, jobName)
+			}
+			for _, need := range jobNeeds(job) {
+				needed[need] = true
+			}
+		}
+	}
+	// 没有 job 依赖的 continue-on-error job 失败时不能使 workflow 失败
+	for _, jobName := range continuedJobs {
+		if !needed[jobName] {
+			task, template := continueTask(jobName, prefix+jobName)
+			templates = append(templates, template)
+			dag.DAG.Tasks = append(dag.DAG.Tasks, task)
+		}
+	}
+	return templates, dag, nil
+}
+
+// convertJob 将 job 转换为 Argo template。matrix job 的每个组合生成一个 template，
+// 并由一个与 job 同名的 DAG template 扇出执行。返回的 inputs 是 DAG 任务需要传入的
+// 上游 job 输出，键为参数名；continued 表示 job 设置了 continue-on-error，
+// matrix 组合的 continue-on-error 在 matrix DAG 中处理，matrix job 总是返回 false
+func (c *WorkflowConverter) convertJob(jobName string, job *model.Job) (templates []wfv1.Template, inputs map[string]string, continued bool, err error) {
+	matrixes, err := expandMatrix(job)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to expand matrix: %w", err)
+	}
+
+	inputs = make(map[string]string)
+	if len(matrixes) == 0 {
+		if continued, err = c.jobContinueOnError(job, nil); err != nil {
+			return nil, nil, false, err
+		}
+		templates, err = c.convertJobToTemplate(jobName, job, nil, inputs)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		forwardInputs(templates, inputs)
+		return templates, inputs, continued, nil
+	}
+
+	matrixTemplate := wfv1.Template{
 		Name: jobName,
+		DAG:  &wfv1.DAGTemplate{},
+	}
+	if err := c.applyStrategy(&matrixTemplate, job.Strategy); err != nil {
+		return nil, nil, false, err
 	}
 
-	// 获取 runsOn 配置
-	runsOnConfig := c.parseRunsOn(job.RunsOn())
+	for i, matrix := range matrixes {
+		taskName := matrixTaskName(jobName, i)
+		legContinued, err := c.jobContinueOnError(job, matrix)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to convert matrix %s: %w", matrixKey(matrix), err)
+		}
+		jobTemplates, err := c.convertJobToTemplate(taskName, job, matrix, inputs)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to convert matrix %s: %w", matrixKey(matrix), err)
+		}
+		templates = append(templates, jobTemplates...)
 
-	// 如果获取到了 runsOn 配置，则解析 YAML 并应用到模板
-	if runsOnConfig != "" {
-		fmt.Printf("Got runsOn config: %s\n", runsOnConfig)
+		matrixTemplate.DAG.Tasks = append(matrixTemplate.DAG.Tasks, wfv1.DAGTask{
+			Name:     taskName,
+			Template: taskName,
+		})
+		// 设置了 continue-on-error 的组合失败时不使 matrix job 失败
+		if legContinued {
+			task, template := continueTask(taskName, taskName)
+			templates = append(templates, template)
+			matrixTemplate.DAG.Tasks = append(matrixTemplate.DAG.Tasks, task)
+		}
+	}
+	// 与 GitHub 一样，matrix job 的输出取最后一个组合的值
+	outputs, err := c.jobOutputs(job)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	matrixTemplate.Outputs.Parameters = taskOutputParameters(outputs, matrixTaskName(jobName, len(matrixes)-1))
 
-		container, err := ParseContainerFromYAML(runsOnConfig)
+	// 各组合引用的上游输出由 matrix DAG 模板接收后转发给每个组合
+	templates = append(templates, matrixTemplate)
+	forwardInputs(templates, inputs)
+	return templates, inputs, false, nil
+}
+
+// convertJobToTemplate 将 job 转换为模板，最后一个模板是名为 jobName 的入口模板。
+// 引用的上游 job 输出以参数名和取值的形式记录到 inputs 中
+func (c *WorkflowConverter) convertJobToTemplate(jobName string, job *model.Job, matrix map[string]interface{}, inputs map[string]string) ([]wfv1.Template, error) {
+	// job 中的表达式在转换时求值，matrix 等上下文在这里已知；
+	// needs 和 steps 的输出在运行时通过输入参数和输出文件获取
+	defined := make(map[string]bool)
+	eval := c.newEvaluator(map[string]interface{}{
+		"matrix": matrix,
+	})
+	eval.resolvers["needs"] = c.needsResolver(job, inputs)
+	eval.resolvers["steps"] = stepsResolver("", defined)
+
+	// 调用 reusable workflow 的 job 没有 step，展开为被调用 workflow 的 DAG
+	if job.Uses != "" {
+		templates, err := c.convertReusableJob(jobName, job, eval)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse runsOn config: %w", err)
+			return nil, err
 		}
-		fmt.Printf("Parsed runsOn spec: %+v\n", container)
+		if err := c.applyJobConcurrency(job, eval, &templates[len(templates)-1]); err != nil {
+			return nil, err
+		}
+		return templates, nil
+	}
 
-		// 使用解析的容器配置
-		template.Container = container
+	// environment 的 secrets 和 vars 覆盖仓库级别的同名取值
+	if err := c.useEnvironment(job, eval); err != nil {
+		return nil, err
+	}
+
+	// workflow 和 job 的 env 作为容器环境变量，同时作为表达式中的 env 上下文
+	jobEnv, err := c.jobEnv(job, eval)
+	if err != nil {
+		return nil, err
+	}
+	eval.contexts["env"] = jobEnv
+
+	pod := &jobPod{}
+	container, err := c.jobContainer(job, eval, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	// services 作为 sidecar 与 step 运行在同一个 pod 中，按 step 生成模板时由 job 的 daemon 任务运行
+	services, err := c.convertServices(job, eval, pod)
+	if err != nil {
+		return nil, err
+	}
+	eval.contexts["job"] = map[string]interface{}{"services": services}
+
+	// Docker step 和 node action 需要独立的容器，这类 job 总是按 step 生成模板
+	docker, node, err := c.containerSteps(job.Steps, 0)
+	if err != nil {
+		return nil, err
+	}
+	// timeout-minutes 转换为 pod 的运行时间上限。Argo 的 DAG 模板不支持 timeout，按 step 生成模板时
+	// 每个 step pod 的上限是 job 剩余的运行时间，在任务调度时计算；step 的超时需要 step 运行在独立的 pod 中
+	timeout, err := jobTimeout(job, eval)
+	if err != nil {
+		return nil, err
+	}
+	// job 脚本由 bash 或 sh 执行，使用其他 shell 的 step 需要独立的模板
+	defaults := c.runDefaults(job)
+	shells, err := c.shellSteps(job.Steps, defaults, 0)
+	if err != nil {
+		return nil, err
+	}
+	// step 的 if 条件需要翻译为任务的 depends/when，不能在 job 脚本中执行
+	conditions, err := c.hasStepConditions(job.Steps, 0)
+	if err != nil {
+		return nil, err
+	}
+	scope := &stepScope{
+		eval:      eval,
+		defined:   defined,
+		tasks:     make(map[string]*stepTask),
+		pod:       pod,
+		timeout:   timeout,
+		continued: make(map[string]bool),
+		defaults:  defaults,
+	}
+	if c.stepTemplates || docker || node || shells || conditions || hasStepTimeouts(job.Steps) {
+		c.workspaceJobs = append(c.workspaceJobs, jobName)
+		templates, err := c.convertJobToSteps(jobName, job, scope, container)
+		if err != nil {
+			return nil, err
+		}
+		// 最后一个模板是 job 的入口模板
+		if err := c.applyJobConcurrency(job, eval, &templates[len(templates)-1]); err != nil {
+			return nil, err
+		}
+		return templates, nil
+	}
+
+	template := wfv1.Template{
+		Name:                  jobName,
+		Container:             container,
+		ActiveDeadlineSeconds: activeDeadline(timeout),
+	}
+	pod.apply(&template)
+
+	// 脚本中引用不可信上下文的表达式通过环境变量传入
+	env := &scriptEnv{}
+
+	// 逐个 step 生成脚本，steps.<id>.outputs 只能引用之前已执行的 step，
+	// composite action 在原位置展开
+	stepScripts := make([][]string, 0, len(job.Steps))
+	composite := false
+	for i, step := range job.Steps {
+		lines, isComposite, err := c.scriptStepLines(scope.key(i, step), step, scope, env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate step %s: %w", step.String(), err)
+		}
+		stepScripts = append(stepScripts, lines)
+		composite = composite || isComposite
+		defined[stepKey(i, step)] = true
+	}
+
+	outputLines, err := jobOutputScript(job, eval, env)
+	if err != nil {
+		return nil, err
 	}
 
 	// 合并所有步骤的 shell 命令
 	var scriptLines []string
 	scriptLines = append(scriptLines, "set -e") // 确保任一命令失败时退出
+	// 每个 step 在子 shell 中执行，之前的 step 写入 $GITHUB_ENV 和 $GITHUB_PATH 的变量在子 shell 开头加载
+	scriptLines = append(scriptLines, runnerFilesFunction, fmt.Sprintf("mkdir -p %s && export GITHUB_ENV=%s GITHUB_PATH=%s", stepOutputsDir, runnerEnvFile, runnerPathFile))
 
+	// 只有声明了 outputs、存在带 id 的 step 或 composite action 时才可能引用 step 输出，此时收集 $GITHUB_OUTPUT
+	collectOutputs := len(job.Outputs) > 0 || composite
 	for _, step := range job.Steps {
-		if step.Run != "" {
-			// 处理多行命令，去除空行
-			lines := strings.Split(step.Run, "\n")
-			for _, line := range lines {
-				if trimmed := strings.TrimSpace(line); trimmed != "" {
-					scriptLines = append(scriptLines, trimmed)
-				}
-			}
+		collectOutputs = collectOutputs || step.ID != ""
+	}
+	if collectOutputs {
+		scriptLines = append(scriptLines, stepOutputFunction)
+	}
+	for i, lines := range stepScripts {
+		if collectOutputs {
+			scriptLines = append(scriptLines, stepOutputSetup(stepKey(i, job.Steps[i])))
 		}
+		scriptLines = append(scriptLines, lines...)
 	}
+	if len(outputLines) > 0 {
+		scriptLines = append(scriptLines, "mkdir -p "+jobOutputsDir)
+		scriptLines = append(scriptLines, outputLines...)
+	}
+
+	// 脚本原样拼接，不能去除缩进和空行，否则会改变 heredoc 等多行命令的内容。
+	// 与 GitHub 未指定 shell 时一样，bash 存在时由 bash 执行，否则由 sh 执行，脚本作为 $1 传入
+	template.Container.Command = []string{"/bin/sh", "-c", jobShellScript, "sh"}
+	template.Container.Args = []string{
+		strings.Join(scriptLines, "\n"),
+	}
+	vars, err := envVars(jobEnv)
+	if err != nil {
+		return nil, err
+	}
+	template.Container.Env = mergeEnvVars(template.Container.Env, vars)
+	template.Container.Env = append(template.Container.Env, env.vars...)
+
+	// job outputs 作为模板输出参数
+	template.Outputs.Parameters = jobOutputParameters(job)
 
-	// 创建或更新容器规格
-	if template.Container == nil {
-		container := corev1.Container{
-			Image:   job.Container().Image,
-			Command: []string{"/bin/sh", "-c"},
-			Args: []string{
-				strings.Join(scriptLines, "\n"),
-			},
+	if err := c.applyJobConcurrency(job, eval, &template); err != nil {
+		return nil, err
+	}
+
+	return []wfv1.Template{template}, nil
+}
+
+// jobContainer 根据 runs-on 配置和 job 的 container 配置生成 job 的基础容器规格，
+// container 中的卷添加到 pod 中
+func (c *WorkflowConverter) jobContainer(job *model.Job, eval *evaluator, pod *jobPod) (*corev1.Container, error) {
+	// 获取 runsOn 配置，runs-on 需要在转换时确定
+	var runsOn []string
+	for _, label := range job.RunsOn() {
+		value, err := eval.interpolate(label)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate runs-on: %w", err)
 		}
-		template.Container = &container
-	} else {
-		// 如果容器已经从 runsOn 配置中设置，确保设置了必要的字段
-		if template.Container.Image == "" {
-			template.Container.Image = job.Container().Image
+		if strings.Contains(value, "{{") {
+			return nil, fmt.Errorf("runs-on %q must be resolvable at conversion time", label)
+		}
+		runsOn = append(runsOn, value)
+	}
+	runsOnConfig := c.parseRunsOn(runsOn)
+	pod.arch = c.jobRunnerArch(runsOn)
+
+	container := &corev1.Container{}
+
+	// 如果获取到了 runsOn 配置，则解析 YAML 并应用到容器
+	if runsOnConfig != "" {
+		fmt.Printf("Got runsOn config: %s\n", runsOnConfig)
+
+		parsed, err := ParseContainerFromYAML(runsOnConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse runsOn config: %w", err)
+		}
+		fmt.Printf("Parsed runsOn spec: %+v\n", parsed)
+
+		// 使用解析的容器配置
+		container = parsed
+	}
+
+	// 与 GitHub 一样在工作区目录中执行
+	if container.WorkingDir == "" {
+		container.WorkingDir = workspaceDir
+	}
+
+	// 设置了事件时与 GitHub runner 一样提供 GITHUB_* 等环境变量，job 和容器的 env 可以覆盖
+	if c.event != nil {
+		env, err := jobRunnerEnv(eval, pod.arch)
+		if err != nil {
+			return nil, err
 		}
-		template.Container.Command = []string{"/bin/sh", "-c"}
-		template.Container.Args = []string{
-			strings.Join(scriptLines, "\n"),
+		vars, err := envVars(env)
+		if err != nil {
+			return nil, err
+		}
+		container.Env = mergeEnvVars(vars, container.Env)
+	}
+
+	// job 容器镜像，运行时引用由 Argo 替换；runsOn 配置中的镜像优先
+	if spec := job.Container(); spec != nil {
+		image, err := eval.interpolate(spec.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate container image: %w", err)
+		}
+		if container.Image == "" {
+			container.Image = image
+		}
+		if err := c.applyContainerSpec(container, spec, image, eval, pod); err != nil {
+			return nil, fmt.Errorf("failed to convert container: %w", err)
 		}
 	}
 
-	return template, nil
+	return container, nil
 }
 
-// ConvertWorkflow is the core conversion function that converts GitHub workflow to Argo Workflow
-func ConvertWorkflow(yamlData []byte) (string, error) {
+// forwardInputs 让 job 生成的所有模板声明引用的上游输出参数，
+// 其中的 DAG 模板将收到的参数原样传给每个子任务。被调用 workflow 的模板已有的参数保持不变
+func forwardInputs(templates []wfv1.Template, inputs map[string]string) {
+	forward := func(name string) string {
+		return fmt.Sprintf("{{inputs.parameters.%s}}", name)
+	}
+	for i := range templates {
+		templates[i].Inputs.Parameters = mergeParameters(templates[i].Inputs.Parameters, inputParameters(inputs, nil))
+		if templates[i].DAG == nil {
+			continue
+		}
+		for j := range templates[i].DAG.Tasks {
+			args := &templates[i].DAG.Tasks[j].Arguments
+			args.Parameters = mergeParameters(args.Parameters, inputParameters(inputs, forward))
+		}
+	}
+}
+
+// mergeParameters 将 params 中 base 没有的参数添加到 base，结果按名称排序
+func mergeParameters(base, params []wfv1.Parameter) []wfv1.Parameter {
+	names := make(map[string]bool, len(base))
+	for _, param := range base {
+		names[param.Name] = true
+	}
+	for _, param := range params {
+		if !names[param.Name] {
+			base = append(base, param)
+		}
+	}
+	sort.Slice(base, func(i, j int) bool { return base[i].Name < base[j].Name })
+	return base
+}
+
+// ConvertWorkflow is the core conversion function that converts GitHub workflow to Argo Workflow.
+// It returns the generated objects as YAML documents separated by ---
+func ConvertWorkflow(yamlData []byte, opts ...Option) (string, error) {
 	// Use act's NewSingleWorkflowPlanner to validate and parse the workflow directly from bytes
 	reader := bytes.NewReader(yamlData)
 	planner, err := model.NewSingleWorkflowPlanner("workflow.yml", reader)
@@ -339,36 +811,76 @@ func ConvertWorkflow(yamlData []byte) (string, error) {
 		return "", fmt.Errorf("创建 workflow planner 失败: %w", err)
 	}
 
-	plan, err := planner.PlanAll()
-	if err != nil {
-		log.Fatalf("创建完整计划失败: %v", err)
-	}
-	PrintPlan(plan)
-	printList(plan)
-
 	// 重新创建 reader，因为原来的 reader 已经被读取到末尾
 	reader = bytes.NewReader(yamlData)
 	githubWorkflow, err := model.ReadWorkflow(reader, false)
 	if err != nil {
-		fmt.Printf("Error parsing GitHub workflow: %v\n", err)
-		os.Exit(1)
+		return "", fmt.Errorf("解析 GitHub workflow 失败: %w", err)
 	}
 
-	// 创建转换器并生成 Argo Workflow
-	converter := NewConverter(githubWorkflow)
-	argoWorkflow, err := converter.Run()
-	if err != nil {
-		fmt.Printf("Error converting to Argo workflow: %v\n", err)
-		os.Exit(1)
+	// 创建转换器并生成 Argo Workflow，未知 job 和循环依赖会在这里报错。
+	// 由 workflow_call 触发的 workflow 生成 WorkflowTemplate
+	converter := NewConverter(githubWorkflow, append([]Option{WithSource(yamlData)}, opts...)...)
+	var objects []interface{}
+	var meta metav1.ObjectMeta
+	var spec wfv1.WorkflowSpec
+	if isCallable(githubWorkflow) {
+		template, err := converter.RunTemplate()
+		if err != nil {
+			return "", fmt.Errorf("转换 Argo workflow 失败: %w", err)
+		}
+		objects, meta, spec = append(objects, template), template.ObjectMeta, template.Spec
+	} else {
+		argoWorkflow, err := converter.Run()
+		if err != nil {
+			return "", fmt.Errorf("转换 Argo workflow 失败: %w", err)
+		}
+		objects, meta, spec = append(objects, argoWorkflow), argoWorkflow.ObjectMeta, argoWorkflow.Spec
 	}
-	// 序列化为 YAML 并输出
-	output, err := yaml.Marshal(argoWorkflow)
-	if err != nil {
-		fmt.Printf("Error marshaling Argo workflow: %v\n", err)
-		os.Exit(1)
+
+	// cancel-in-progress 由 /api/v1/workflows/{namespace} 在提交前终止同组中的旧 workflow，CronWorkflow 和
+	// Sensor 直接创建 workflow，无法取消旧的运行
+	schedule := containsString(githubWorkflow.On(), "schedule")
+	webhook := converter.eventSensor && hasSensorEvents(githubWorkflow)
+	if meta.Annotations[common.CancelInProgressAnnotation] == "true" && (schedule || webhook) {
+		return "", fmt.Errorf("cancel-in-progress of workflow concurrency is only supported for workflows submitted through " +
+			"/api/v1/workflows/{namespace}, runs created by the generated CronWorkflow or Sensor cannot cancel earlier runs")
+	}
+
+	// 带有 on.schedule 的 workflow 同时生成定时运行的 CronWorkflow
+	if schedule {
+		cronWorkflow, err := converter.cronWorkflow(meta, spec)
+		if err != nil {
+			return "", fmt.Errorf("生成 CronWorkflow 失败: %w", err)
+		}
+		objects = append(objects, cronWorkflow)
 	}
 
-	fmt.Println(string(output))
+	// 由 push 或 pull_request 触发的 workflow 可以同时生成 Argo Events 的 Sensor 和 EventSource，
+	// 没有 webhook 触发事件的 workflow 只生成 Workflow 和 CronWorkflow
+	if webhook {
+		sensor, eventSource, err := converter.sensor(meta, spec)
+		if err != nil {
+			return "", fmt.Errorf("生成 Sensor 失败: %w", err)
+		}
+		objects = append(objects, sensor, eventSource)
+	}
+
+	plan, err := planner.PlanAll()
+	if err != nil {
+		return "", fmt.Errorf("创建完整计划失败: %w", err)
+	}
+	PrintPlan(plan)
+	printList(plan)
 
-	return string("converted argo workflow successfully"), nil
+	// 按 json 标签序列化为 YAML，字段名与 Kubernetes 资源一致，多个对象之间以 --- 分隔
+	var documents []string
+	for _, object := range objects {
+		output, err := k8syaml.Marshal(object)
+		if err != nil {
+			return "", fmt.Errorf("序列化 Argo workflow 失败: %w", err)
+		}
+		documents = append(documents, string(output))
+	}
+	return strings.Join(documents, "---\n"), nil
 }
@@ -1 +1,4098 @@
 package converter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned/fake"
+	argotemplate "github.com/argoproj/argo-workflows/v3/util/template"
+	"github.com/argoproj/argo-workflows/v3/workflow/templateresolution"
+	"github.com/argoproj/argo-workflows/v3/workflow/validate"
+	"github.com/nektos/act/pkg/model"
+	"github.com/opensourceways/argus-worker/pkg/common"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// jobScriptHeader 是 job 脚本在第一个 step 之前的内容
+const jobScriptHeader = "set -e\n" + runnerFilesFunction + "\nmkdir -p /tmp/argus/steps && export GITHUB_ENV=/tmp/argus/steps/@env GITHUB_PATH=/tmp/argus/steps/@path"
+
+// readTestWorkflow 从 YAML 字符串解析 GitHub workflow
+func readTestWorkflow(t *testing.T, data string) *model.Workflow {
+	t.Helper()
+	wf, err := model.ReadWorkflow(strings.NewReader(data), false)
+	if err != nil {
+		t.Fatalf("ReadWorkflow() error = %v", err)
+	}
+	return wf
+}
+
+// findDAGTask 在 main 模板中查找指定名称的 DAG 任务
+func findDAGTask(t *testing.T, wf *wfv1.Workflow, name string) wfv1.DAGTask {
+	t.Helper()
+	for _, tmpl := range wf.Spec.Templates {
+		if tmpl.Name != "main" || tmpl.DAG == nil {
+			continue
+		}
+		for _, task := range tmpl.DAG.Tasks {
+			if task.Name == name {
+				return task
+			}
+		}
+	}
+	t.Fatalf("DAG task %s not found", name)
+	return wfv1.DAGTask{}
+}
+
+// validateWorkflow 使用 Argo 的校验规则检查转换得到的 Workflow，与提交时 Argo Server 的校验相同
+func validateWorkflow(t *testing.T, wf *wfv1.Workflow) error {
+	t.Helper()
+	client := fake.NewSimpleClientset()
+	return validate.ValidateWorkflow(
+		templateresolution.WrapWorkflowTemplateInterface(client.ArgoprojV1alpha1().WorkflowTemplates("default")),
+		templateresolution.WrapClusterWorkflowTemplateInterface(client.ArgoprojV1alpha1().ClusterWorkflowTemplates()),
+		wf, nil, validate.ValidateOpts{})
+}
+
+const pipelineWorkflow = `
+name: pipeline
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: echo build
+  test:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: build
+    steps:
+      - run: echo test
+  lint:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: [build]
+    steps:
+      - run: echo lint
+  deploy:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: [test, lint]
+    steps:
+      - run: echo deploy
+`
+
+// TestRunDAGDependencies 测试 needs 被转换为 DAG 依赖
+func TestRunDAGDependencies(t *testing.T) {
+	argoWf, err := NewConverter(readTestWorkflow(t, pipelineWorkflow)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	cases := map[string]string{
+		"build":  "",
+		"test":   "build.Succeeded",
+		"lint":   "build.Succeeded",
+		"deploy": "test.Succeeded && lint.Succeeded",
+	}
+	for name, want := range cases {
+		task := findDAGTask(t, argoWf, name)
+		if task.Depends != want {
+			t.Errorf("task %s depends = %q, want %q", name, task.Depends, want)
+		}
+	}
+}
+
+// TestRunUnknownNeeds 测试 needs 引用不存在的 job 时返回错误
+func TestRunUnknownNeeds(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: broken
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: build
+    steps:
+      - run: echo test
+`)
+	_, err := NewConverter(wf).Run()
+	if err == nil || !strings.Contains(err.Error(), "job test needs unknown job build") {
+		t.Errorf("Run() error = %v, want unknown job error", err)
+	}
+}
+
+// TestRunDependencyCycle 测试循环依赖时返回错误
+func TestRunDependencyCycle(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: cycle
+on: push
+jobs:
+  a:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: c
+    steps:
+      - run: echo a
+  b:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: a
+    steps:
+      - run: echo b
+  c:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: b
+    steps:
+      - run: echo c
+`)
+	_, err := NewConverter(wf).Run()
+	if err == nil || !strings.Contains(err.Error(), "a -> c -> b -> a") {
+		t.Errorf("Run() error = %v, want cycle error", err)
+	}
+}
+
+// TestJobStagesMatchPlanner 测试 DAG 分层与 act planner 计算的阶段一致
+func TestJobStagesMatchPlanner(t *testing.T) {
+	planner, err := model.NewSingleWorkflowPlanner("workflow.yml", strings.NewReader(pipelineWorkflow))
+	if err != nil {
+		t.Fatalf("NewSingleWorkflowPlanner() error = %v", err)
+	}
+	plan, err := planner.PlanAll()
+	if err != nil {
+		t.Fatalf("PlanAll() error = %v", err)
+	}
+
+	stages, err := jobStages(readTestWorkflow(t, pipelineWorkflow))
+	if err != nil {
+		t.Fatalf("jobStages() error = %v", err)
+	}
+
+	if len(stages) != len(plan.Stages) {
+		t.Fatalf("jobStages() = %d stages, planner = %d stages", len(stages), len(plan.Stages))
+	}
+	for i, stage := range plan.Stages {
+		want := stage.GetJobIDs()
+		sort.Strings(want)
+		if !reflect.DeepEqual(stages[i], want) {
+			t.Errorf("stage %d = %v, want %v", i, stages[i], want)
+		}
+	}
+}
+
+// findTemplate 查找指定名称的模板
+func findTemplate(t *testing.T, wf *wfv1.Workflow, name string) *wfv1.Template {
+	t.Helper()
+	for i := range wf.Spec.Templates {
+		if wf.Spec.Templates[i].Name == name {
+			return &wf.Spec.Templates[i]
+		}
+	}
+	t.Fatalf("template %s not found", name)
+	return nil
+}
+
+// TestRunMatrixFanOut 测试 matrix job 展开为多个任务，并处理 include/exclude 和 matrix 引用
+func TestRunMatrixFanOut(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: matrix
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    container: python:${{ matrix.python }}
+    strategy:
+      matrix:
+        python: ["3.9", "3.10"]
+        cann: ["7.0", "8.0"]
+        exclude:
+          - python: "3.9"
+            cann: "8.0"
+        include:
+          - python: "3.11"
+            cann: "8.0"
+    steps:
+      - run: pytest --cann ${{ matrix.cann }}
+  report:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: test
+    steps:
+      - run: echo done
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	matrixTemplate := findTemplate(t, argoWf, "test")
+	if matrixTemplate.DAG == nil || len(matrixTemplate.DAG.Tasks) != 4 {
+		t.Fatalf("matrix template = %+v, want DAG with 4 tasks", matrixTemplate)
+	}
+
+	var got []string
+	for _, task := range matrixTemplate.DAG.Tasks {
+		container := findTemplate(t, argoWf, task.Template).Container
+		got = append(got, container.Image+" "+container.Args[0])
+	}
+	want := []string{
+		"python:3.10 " + jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\npytest --cann 7.0\n)",
+		"python:3.9 " + jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\npytest --cann 7.0\n)",
+		"python:3.10 " + jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\npytest --cann 8.0\n)",
+		"python:3.11 " + jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\npytest --cann 8.0\n)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("matrix combinations = %q, want %q", got, want)
+	}
+
+	// 下游 job 依赖整个 matrix
+	if depends := findDAGTask(t, argoWf, "report").Depends; depends != "test.Succeeded" {
+		t.Errorf("report depends = %q, want test.Succeeded", depends)
+	}
+}
+
+// TestEvaluatorInterpolateMatrix 测试 matrix 引用替换
+func TestEvaluatorInterpolateMatrix(t *testing.T) {
+	eval := NewConverter(&model.Workflow{}).newEvaluator(map[string]interface{}{
+		"matrix": map[string]interface{}{
+			"os":      "npu-910b",
+			"version": 3.9,
+			"target":  map[string]interface{}{"arch": "aarch64"},
+		},
+	})
+	got, err := eval.interpolate("${{ matrix.os }}-${{matrix.version}}-${{ matrix.target.arch }}-${{ matrix.missing }}")
+	if err != nil {
+		t.Fatalf("interpolate() error = %v", err)
+	}
+	if want := "npu-910b-3.9-aarch64-"; got != want {
+		t.Errorf("interpolate() = %q, want %q", got, want)
+	}
+}
+
+// TestEvaluatorEvaluate 测试表达式字面量、运算符和内置函数
+func TestEvaluatorEvaluate(t *testing.T) {
+	workspace := fstest.MapFS{
+		"go.sum":          {Data: []byte("a")},
+		"sub/go.sum":      {Data: []byte("b")},
+		"vendor/x/go.sum": {Data: []byte("c")},
+	}
+	c := NewConverter(&model.Workflow{}, WithWorkspace(workspace))
+	eval := c.newEvaluator(map[string]interface{}{
+		"env": map[string]interface{}{"TARGET": "Release", "COUNT": "3"},
+		"matrix": map[string]interface{}{
+			"python": []interface{}{"3.9", "3.10"},
+		},
+		"event": map[string]interface{}{
+			"commits": []interface{}{
+				map[string]interface{}{"id": "a1"},
+				map[string]interface{}{"id": "b2"},
+			},
+		},
+	})
+
+	cases := []struct {
+		expr string
+		want interface{}
+	}{
+		{"'it''s'", "it's"},
+		{"0xff", float64(255)},
+		{"null == 0", true},
+		{"env.TARGET == 'release'", true},
+		{"env.COUNT >= 3 && 'yes'", "yes"},
+		{"env.MISSING || 'default'", "default"},
+		{"!env.TARGET", false},
+		{"'abc' < 'ABD'", true},
+		{"contains(matrix.python, '3.10')", true},
+		{"contains('Hello World', 'WORLD')", true},
+		{"startsWith(env.TARGET, 'rel') && endsWith(env.TARGET, 'ASE')", true},
+		{"format('{0}-{{literal}}-{1}', env.TARGET, 1.5)", "Release-{literal}-1.5"},
+		{"join(event.commits.*.id, '+')", "a1+b2"},
+		{"join(matrix.python)", "3.9,3.10"},
+		{"fromJSON('{\"a\": [1, 2]}').a[1]", float64(2)},
+		{"toJSON(matrix.python)", "[\n  \"3.9\",\n  \"3.10\"\n]"},
+		{"hashFiles('**/go.sum', '!vendor/**')", hashOf("a", "b")},
+		{"hashFiles('missing/**')", ""},
+	}
+
+	for _, tc := range cases {
+		got, err := eval.evaluate(tc.expr)
+		if err != nil {
+			t.Errorf("evaluate(%q) error = %v", tc.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("evaluate(%q) = %#v, want %#v", tc.expr, got, tc.want)
+		}
+	}
+}
+
+// hashOf 按 hashFiles 的算法计算多个文件内容的哈希
+func hashOf(contents ...string) string {
+	result := sha256.New()
+	for _, content := range contents {
+		sum := sha256.Sum256([]byte(content))
+		result.Write(sum[:])
+	}
+	return hex.EncodeToString(result.Sum(nil))
+}
+
+// TestEvaluatorRuntimeReferences 测试运行时上下文改写为 Argo 参数，脚本中通过环境变量传入
+func TestEvaluatorRuntimeReferences(t *testing.T) {
+	c := NewConverter(&model.Workflow{})
+	eval := c.newEvaluator(nil)
+
+	got, err := eval.interpolate("image:${{ inputs.tag }}")
+	if err != nil {
+		t.Fatalf("interpolate() error = %v", err)
+	}
+	if want := "image:{{workflow.parameters.tag}}"; got != want {
+		t.Errorf("interpolate() = %q, want %q", got, want)
+	}
+
+	env := &scriptEnv{}
+	script, err := eval.interpolateScript(`echo "${{ github.event.pull_request.title }}" ${{ format('{0}/{1}', github.sha, 'x') }} ${{ github.event.pull_request.title }}`, env)
+	if err != nil {
+		t.Fatalf("interpolateScript() error = %v", err)
+	}
+	if want := `echo "${ARGUS_EXPR_0}" ${ARGUS_EXPR_1} ${ARGUS_EXPR_0}`; script != want {
+		t.Errorf("interpolateScript() = %q, want %q", script, want)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "ARGUS_EXPR_0", Value: "{{workflow.parameters.github-event-pull_request-title}}"},
+		{Name: "ARGUS_EXPR_1", Value: "{{workflow.parameters.github-sha}}/x"},
+	}
+	if !reflect.DeepEqual(env.vars, wantEnv) {
+		t.Errorf("script env = %+v, want %+v", env.vars, wantEnv)
+	}
+
+	params := c.workflowParameters()
+	if len(params) != 3 {
+		t.Errorf("workflowParameters() = %+v, want 3 parameters", params)
+	}
+
+	// 需要实际取值的运算不能作用于运行时引用
+	if _, err := eval.interpolate("${{ github.ref == 'refs/heads/main' }}"); err == nil || !strings.Contains(err.Error(), "only known at runtime") {
+		t.Errorf("interpolate() error = %v, want runtime error", err)
+	}
+	if _, err := eval.interpolate("${{ secrets.TOKEN }}"); err == nil {
+		t.Error("interpolate() with unavailable context should return error")
+	}
+}
+
+// TestTranslateJobCondition 测试 job if 条件翻译为 depends/when
+func TestTranslateJobCondition(t *testing.T) {
+	cases := []struct {
+		name    string
+		needs   string
+		cond    string
+		depends string
+		when    string
+	}{
+		{name: "default", needs: "[build]", depends: "build.Succeeded"},
+		{name: "no needs", cond: "success()"},
+		{
+			name:    "event name",
+			needs:   "[build]",
+			cond:    "github.event_name == 'push'",
+			depends: "build.Succeeded",
+			when:    runtimeString("workflow.parameters['github-event_name']") + " == 'push'",
+		},
+		{
+			name:    "failure",
+			needs:   "[build, test]",
+			cond:    "${{ failure() }}",
+			depends: "build.Failed || build.Errored || build.Omitted || test.Failed || test.Errored || test.Omitted",
+		},
+		{
+			name:    "always with ref check",
+			needs:   "[build]",
+			cond:    "always() && startsWith(github.ref, 'refs/tags/v1.')",
+			depends: "build.Succeeded || build.Skipped || build.Failed || build.Errored || build.Omitted",
+			when:    runtimeString("workflow.parameters['github-ref']") + ` =~ '(?i)^refs/tags/v1\\.'`,
+		},
+		{
+			name:    "needs result",
+			needs:   "[build]",
+			cond:    "!cancelled() && needs.build.result != 'success'",
+			depends: "!build.Errored && !build.Succeeded",
+		},
+		{name: "never", cond: "failure()", when: "false"},
+		{
+			name:    "case insensitive with quote",
+			needs:   "[build]",
+			cond:    "github.head_ref == 'Fix/It''s'",
+			depends: "build.Succeeded",
+			when:    runtimeString("workflow.parameters['github-head_ref']") + ` == 'fix/it\'s'`,
+		},
+		{
+			name:  "number and input",
+			cond:  "github.event.pull_request.number > 10 || inputs.deploy",
+			when:  "{{=asFloat(workflow.parameters['github-event-pull_request-number'])}} > 10 || (" + truthy(runtimeString("workflow.parameters.deploy")) + ")",
+			needs: "",
+		},
+		{
+			// 单独引用的取值按真值判断，'false'、'0' 和空字符串为假
+			name: "negated input",
+			cond: "!inputs.skip && github.event_name == 'push'",
+			when: "!(" + truthy(runtimeString("workflow.parameters.skip")) + ") && " + runtimeString("workflow.parameters['github-event_name']") + " == 'push'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := &model.Job{}
+			if tc.needs != "" {
+				job.RawNeeds = yamlNode(t, tc.needs)
+			}
+			job.If.Value = tc.cond
+
+			cond, err := NewConverter(&model.Workflow{}).translateJobCondition(job, nil)
+			if err != nil {
+				t.Fatalf("translateJobCondition() error = %v", err)
+			}
+			if cond.Depends != tc.depends {
+				t.Errorf("depends = %q, want %q", cond.Depends, tc.depends)
+			}
+			if cond.When != tc.when {
+				t.Errorf("when = %q, want %q", cond.When, tc.when)
+			}
+		})
+	}
+}
+
+// truthy 返回 when 中按 GitHub 真值规则判断操作数的表达式
+func truthy(operand string) string {
+	return operand + " != '' && " + operand + " != 'false' && " + operand + " != '0'"
+}
+
+// runtimeString 返回 when 中运行时取值的字符串操作数，取值在替换时转义引号并转为小写
+func runtimeString(ref string) string {
+	return fmt.Sprintf(`'{{=sprig.replace("'", "\\'", sprig.replace("\\", "\\\\", sprig.lower(%s)))}}'`, ref)
+}
+
+// TestTranslateJobConditionErrors 测试无法翻译的条件返回明确的错误
+func TestTranslateJobConditionErrors(t *testing.T) {
+	cases := map[string]string{
+		"failure() || github.ref == 'refs/heads/main'": "mixes job status checks",
+		"hashFiles('**/go.sum') != ''":                 "not supported in if conditions",
+		"env.DEPLOY == 'true'":                         "context env is not available",
+		"needs.other.result == 'success'":              "not listed in needs",
+	}
+
+	for cond, want := range cases {
+		job := &model.Job{If: yaml.Node{Kind: yaml.ScalarNode, Value: cond}}
+		_, err := NewConverter(&model.Workflow{}).translateJobCondition(job, nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("translateJobCondition(%q) error = %v, want to contain %q", cond, err, want)
+		}
+	}
+}
+
+// yamlNode 将 YAML 片段解析为节点
+func yamlNode(t *testing.T, data string) yaml.Node {
+	t.Helper()
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+	return *doc.Content[0]
+}
+
+// TestRunRunNumber 测试 github.run_number 是数字，可以在条件中按数字比较
+func TestRunRunNumber(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: release
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    if: github.run_number > 100
+    steps:
+      - run: echo "version=1.2.${{ github.run_number }}"
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if when := findDAGTask(t, argoWf, "build").When; when != "{{=asFloat(workflow.creationTimestamp.s)}} > 100" {
+		t.Errorf("build when = %q, want numeric comparison of the creation timestamp", when)
+	}
+	if err := validateWorkflow(t, argoWf); err != nil {
+		t.Errorf("ValidateWorkflow() error = %v", err)
+	}
+}
+
+// TestRunJobOutputs 测试 job outputs 转换为模板输出参数，并通过任务参数传给下游 job
+func TestRunJobOutputs(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: release
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    outputs:
+      version: ${{ steps.ver.outputs.version }}
+    steps:
+      - id: ver
+        run: echo "version=1.2.$GITHUB_RUN_NUMBER" >> $GITHUB_OUTPUT
+  deploy:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: build
+    if: needs.build.outputs.version != ''
+    steps:
+      - run: ./deploy.sh ${{ needs.build.outputs.version }}
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	build := findTemplate(t, argoWf, "build")
+	wantOutputs := []wfv1.Parameter{{
+		Name: "version",
+		ValueFrom: &wfv1.ValueFrom{
+			Path:    "/tmp/argus/outputs/version",
+			Default: wfv1.AnyStringPtr(""),
+		},
+	}}
+	if !reflect.DeepEqual(build.Outputs.Parameters, wantOutputs) {
+		t.Errorf("build outputs = %+v, want %+v", build.Outputs.Parameters, wantOutputs)
+	}
+	script := build.Container.Args[0]
+	for _, want := range []string{
+		"export GITHUB_OUTPUT='/tmp/argus/steps/ver'",
+		`printf '%s' "$(__argus_step_output 'ver' 'version')" > '/tmp/argus/outputs/version'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("build script does not contain %q:\n%s", want, script)
+		}
+	}
+
+	deployTask := findDAGTask(t, argoWf, "deploy")
+	wantArgs := []wfv1.Parameter{{
+		Name:  "needs-build-outputs-version",
+		Value: wfv1.AnyStringPtr("{{tasks.build.outputs.parameters.version}}"),
+	}}
+	if !reflect.DeepEqual(deployTask.Arguments.Parameters, wantArgs) {
+		t.Errorf("deploy arguments = %+v, want %+v", deployTask.Arguments.Parameters, wantArgs)
+	}
+	if want := runtimeString("tasks.build.outputs.parameters.version") + " != ''"; deployTask.When != want {
+		t.Errorf("deploy when = %q, want %q", deployTask.When, want)
+	}
+
+	// 上游输出属于不可信取值，通过环境变量传入脚本
+	deploy := findTemplate(t, argoWf, "deploy")
+	if want := jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\n./deploy.sh ${ARGUS_EXPR_0}\n)"; deploy.Container.Args[0] != want {
+		t.Errorf("deploy script = %q, want %q", deploy.Container.Args[0], want)
+	}
+	wantEnv := []corev1.EnvVar{{Name: "ARGUS_EXPR_0", Value: "{{inputs.parameters.needs-build-outputs-version}}"}}
+	if !reflect.DeepEqual(deploy.Container.Env, wantEnv) {
+		t.Errorf("deploy env = %+v, want %+v", deploy.Container.Env, wantEnv)
+	}
+	if len(deploy.Inputs.Parameters) != 1 || deploy.Inputs.Parameters[0].Name != "needs-build-outputs-version" {
+		t.Errorf("deploy inputs = %+v, want needs-build-outputs-version", deploy.Inputs.Parameters)
+	}
+}
+
+// TestRunJobOutputsErrors 测试引用未声明的输出或未执行的 step 时报错
+func TestRunJobOutputsErrors(t *testing.T) {
+	cases := map[string]string{
+		"${{ needs.build.outputs.missing }}": "does not declare output missing",
+		"${{ needs.lint.outputs.version }}":  "not listed in needs",
+		"${{ steps.later.outputs.value }}":   "step later is not defined",
+	}
+
+	for run, want := range cases {
+		wf := readTestWorkflow(t, `
+name: release
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    outputs:
+      version: "1.0"
+    steps:
+      - run: echo build
+  lint:
+    runs-on: ubuntu-latest
+    container: alpine
+    outputs:
+      version: "1.0"
+    steps:
+      - run: echo lint
+  deploy:
+    runs-on: ubuntu-latest
+    container: alpine
+    needs: build
+    steps:
+      - run: echo "`+run+`"
+      - id: later
+        run: echo later
+`)
+		_, err := NewConverter(wf).Run()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() with %q error = %v, want to contain %q", run, err, want)
+		}
+	}
+}
+
+// TestRunStepTemplates 测试 step 模板模式下每个 step 生成独立的脚本模板
+func TestRunStepTemplates(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: release
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    outputs:
+      version: ${{ steps.ver.outputs.version }}
+    steps:
+      - name: Compute version
+        id: ver
+        shell: bash
+        working-directory: src
+        run: |
+          cat <<EOF >> $GITHUB_OUTPUT
+            version=1.0
+          EOF
+      - name: Notify
+        if: failure() && github.ref == 'refs/heads/main'
+        shell: python
+        run: print("failed")
+      - run: echo ${{ steps.ver.outputs.version }}
+        if: always()
+`)
+	argoWf, err := NewConverter(wf, WithStepTemplates()).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(argoWf.Spec.VolumeClaimTemplates) != 1 || argoWf.Spec.VolumeClaimTemplates[0].Name != "workspace-build" {
+		t.Errorf("volumeClaimTemplates = %+v, want workspace claim", argoWf.Spec.VolumeClaimTemplates)
+	}
+
+	build := findTemplate(t, argoWf, "build")
+	if build.DAG == nil {
+		t.Fatalf("build template = %+v, want DAG", build)
+	}
+	type task struct{ name, depends, when string }
+	var gotTasks []task
+	for _, dagTask := range build.DAG.Tasks {
+		gotTasks = append(gotTasks, task{dagTask.Name, dagTask.Depends, dagTask.When})
+	}
+	wantTasks := []task{
+		{"step-0", "", ""},
+		{"step-1", "step-0.Failed || step-0.Errored", runtimeString("workflow.parameters['github-ref']") + " == 'refs/heads/main'"},
+		{"step-2", "(step-0.Succeeded || step-0.Skipped || step-0.Failed || step-0.Errored || step-0.Omitted) && " +
+			"(step-1.Succeeded || step-1.Skipped || step-1.Failed || step-1.Errored || step-1.Omitted)", ""},
+		{"outputs", "(step-0.Succeeded || step-0.Skipped) && (step-1.Succeeded || step-1.Skipped) && (step-2.Succeeded || step-2.Skipped)", ""},
+	}
+	if !reflect.DeepEqual(gotTasks, wantTasks) {
+		t.Errorf("build tasks = %+v, want %+v", gotTasks, wantTasks)
+	}
+	if want := "{{tasks.outputs.outputs.parameters.version}}"; len(build.Outputs.Parameters) != 1 || build.Outputs.Parameters[0].ValueFrom.Parameter != want {
+		t.Errorf("build outputs = %+v, want %s", build.Outputs.Parameters, want)
+	}
+
+	// 脚本内容原样保留，包括 heredoc 的缩进
+	compute := findTemplate(t, argoWf, "build-step-0")
+	if compute.Script == nil {
+		t.Fatalf("build-step-0 = %+v, want script template", compute)
+	}
+	if want := runnerFilesScript + "\ncat <<EOF >> $GITHUB_OUTPUT\n  version=1.0\nEOF\n"; compute.Script.Source != want {
+		t.Errorf("build-step-0 source = %q, want %q", compute.Script.Source, want)
+	}
+	if got := compute.Annotations["workflows.argoproj.io/display-name"]; got != "Compute version" {
+		t.Errorf("build-step-0 display name = %q, want Compute version", got)
+	}
+	if got := compute.Script.Command; !reflect.DeepEqual(got, []string{"bash", "--noprofile", "--norc", "-eo", "pipefail"}) {
+		t.Errorf("build-step-0 command = %q", got)
+	}
+	if compute.Script.WorkingDir != "/workspace/src" {
+		t.Errorf("build-step-0 workingDir = %q, want /workspace/src", compute.Script.WorkingDir)
+	}
+	wantMounts := []corev1.VolumeMount{
+		{Name: "workspace-build", MountPath: "/workspace", SubPath: "workspace"},
+		{Name: "workspace-build", MountPath: "/tmp/argus/steps", SubPath: "steps"},
+		{Name: "workspace-build", MountPath: "/opt/hostedtoolcache", SubPath: "toolcache"},
+	}
+	if !reflect.DeepEqual(compute.Script.VolumeMounts, wantMounts) {
+		t.Errorf("build-step-0 volumeMounts = %+v, want %+v", compute.Script.VolumeMounts, wantMounts)
+	}
+
+	notify := findTemplate(t, argoWf, "build-step-1")
+	if !reflect.DeepEqual(notify.Script.Command, []string{"python"}) {
+		t.Errorf("build-step-1 command = %q, want [python]", notify.Script.Command)
+	}
+
+	// 读取 step 输出的脚本带上读取函数
+	echo := findTemplate(t, argoWf, "build-step-2")
+	if !strings.HasPrefix(echo.Script.Source, runnerFilesScript+"\n__argus_step_output() {") ||
+		!strings.HasSuffix(echo.Script.Source, "echo $(__argus_step_output 'ver' 'version')") {
+		t.Errorf("build-step-2 source = %q", echo.Script.Source)
+	}
+}
+
+// TestRunScriptWorkingDirectory 测试 job 脚本模式下每个 step 都从工作区开始，之前的 step 切换目录不影响之后的 step
+func TestRunScriptWorkingDirectory(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: CI
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: mkdir -p sub && cd sub
+      - run: pwd
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	script := findTemplate(t, argoWf, "build").Container.Args[0]
+	if want := jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\nmkdir -p sub && cd sub\n)\n(\n__argus_runner_files\ncd /workspace\npwd\n)"; script != want {
+		t.Fatalf("build script = %q, want %q", script, want)
+	}
+
+	// 第二个 step 输出工作区而不是 sub
+	runner := newTestRunner(t)
+	if got := runner.run(t, script, nil); got != runner.workspace {
+		t.Errorf("pwd of step 2 = %q, want %q", got, runner.workspace)
+	}
+}
+
+// testRunner 用临时目录代替工作区、step 输出目录和输出参数目录执行转换得到的脚本
+type testRunner struct {
+	workspace string
+	params    string
+	replacer  *strings.Replacer
+}
+
+func newTestRunner(t *testing.T) *testRunner {
+	workspace, steps, params := t.TempDir(), t.TempDir(), t.TempDir()
+	return &testRunner{
+		workspace: workspace,
+		params:    params,
+		replacer:  strings.NewReplacer(workspaceDir, workspace, stepOutputsDir, steps, stepParamsDir, params),
+	}
+}
+
+// command 返回在工作区中执行 args 的命令，env 是容器的环境变量
+func (r *testRunner) command(args []string, env []corev1.EnvVar) *exec.Cmd {
+	for i := range args {
+		args[i] = r.replacer.Replace(args[i])
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = r.workspace
+	cmd.Env = os.Environ()
+	for _, v := range env {
+		cmd.Env = append(cmd.Env, v.Name+"="+r.replacer.Replace(v.Value))
+	}
+	return cmd
+}
+
+// runTemplate 与 Argo 一样执行脚本模板：源码写入文件，文件路径作为命令的最后一个参数
+func (r *testRunner) runTemplate(t *testing.T, script *wfv1.ScriptTemplate) error {
+	t.Helper()
+	file := t.TempDir() + "/script"
+	if err := os.WriteFile(file, []byte(r.replacer.Replace(script.Source)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return r.command(append(append([]string{}, script.Command...), file), script.Env).Run()
+}
+
+// run 在工作区中按 sh -e 执行 script，env 是容器的环境变量，返回去掉首尾空白的输出
+func (r *testRunner) run(t *testing.T, script string, env []corev1.EnvVar) string {
+	t.Helper()
+	cmd := r.command([]string{"/bin/sh", "-e", "-c", script}, env)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("run script: %v: %s", err, stderr.String())
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// runnerFilesWorkflow 的第一个 step 通过 $GITHUB_ENV 和 $GITHUB_PATH 设置环境变量和 PATH，第二个 step 使用它们
+const runnerFilesWorkflow = `
+name: CI
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: |
+          mkdir -p tools && printf '#!/bin/sh\necho from-tool\n' > tools/argus-tool && chmod +x tools/argus-tool
+          echo "$PWD/tools" >> "$GITHUB_PATH"
+          echo "GREETING=hello" >> "$GITHUB_ENV"
+          echo "NOTES<<EOF" >> "$GITHUB_ENV"
+          printf 'it'"'"'s\nfine\nEOF\n' >> "$GITHUB_ENV"
+        shell: sh
+      - run: echo "$GREETING $NOTES" && argus-tool
+        shell: sh
+`
+
+// TestRunRunnerFiles 测试 job 脚本模式下之前的 step 写入 $GITHUB_ENV 和 $GITHUB_PATH 的变量在之后的 step 中生效
+func TestRunRunnerFiles(t *testing.T) {
+	wf := readTestWorkflow(t, runnerFilesWorkflow)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	build := findTemplate(t, argoWf, "build")
+	if build.Container == nil {
+		t.Fatalf("build = %+v, want job script", build)
+	}
+	if got, want := newTestRunner(t).run(t, build.Container.Args[0], nil), "hello it's\nfine\nfrom-tool"; got != want {
+		t.Errorf("output of step 2 = %q, want %q", got, want)
+	}
+}
+
+// TestRunRunnerFilesStepTemplates 测试按 step 生成模板时 $GITHUB_ENV 和 $GITHUB_PATH 位于共享的 step 目录中，
+// 之后的 step 的 pod 加载之前的 step 写入的变量
+func TestRunRunnerFilesStepTemplates(t *testing.T) {
+	wf := readTestWorkflow(t, runnerFilesWorkflow)
+	argoWf, err := NewConverter(wf, WithStepTemplates()).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	runner := newTestRunner(t)
+	var got string
+	for _, name := range []string{"build-step-0", "build-step-1"} {
+		script := findTemplate(t, argoWf, name).Script
+		if script == nil {
+			t.Fatalf("%s is not a script template", name)
+		}
+		got = runner.run(t, script.Source, script.Env)
+	}
+	if want := "hello it's\nfine\nfrom-tool"; got != want {
+		t.Errorf("output of step 2 = %q, want %q", got, want)
+	}
+}
+
+// TestRunStepConditionSteps 测试 step 的 if 条件引用之前的 step 的输出、outcome 和 conclusion：输出由 step 的模板写出为
+// 输出参数，outcome 和 conclusion 由任务的状态得到
+func TestRunStepConditionSteps(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: CI
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - id: check
+        run: |
+          echo "changed=true" >> "$GITHUB_OUTPUT"
+          exit "${FAIL:-0}"
+        shell: sh
+      - id: lint
+        run: make lint
+        continue-on-error: true
+      - if: steps.check.outputs.changed == 'true'
+        run: make build
+      - if: always() && steps.lint.outcome == 'failure' && steps.lint.conclusion == 'success'
+        run: echo lint failed
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if err := validateWorkflow(t, argoWf); err != nil {
+		t.Errorf("validateWorkflow() error = %v", err)
+	}
+
+	check := findTemplate(t, argoWf, "build-step-0")
+	want := []wfv1.Parameter{{Name: "changed", ValueFrom: &wfv1.ValueFrom{Path: "/tmp/argus/params/changed", Default: wfv1.AnyStringPtr("")}}}
+	if !reflect.DeepEqual(check.Outputs.Parameters, want) {
+		t.Errorf("check outputs = %+v, want %+v", check.Outputs.Parameters, want)
+	}
+	if lint := findTemplate(t, argoWf, "build-step-1"); len(lint.Outputs.Parameters) != 0 {
+		t.Errorf("lint outputs = %+v, want none", lint.Outputs.Parameters)
+	}
+
+	// 输出参数在 step 失败时同样写出，step 的退出码不变
+	for _, fail := range []string{"0", "3"} {
+		runner := newTestRunner(t)
+		script := check.Script.DeepCopy()
+		script.Env = append(script.Env, corev1.EnvVar{Name: "FAIL", Value: fail})
+		err := runner.runTemplate(t, script)
+		var exit *exec.ExitError
+		if fail == "0" && err != nil || fail != "0" && (!errors.As(err, &exit) || strconv.Itoa(exit.ExitCode()) != fail) {
+			t.Errorf("check with FAIL=%s error = %v, want exit code %s", fail, err, fail)
+		}
+		if data, err := os.ReadFile(runner.params + "/changed"); err != nil || string(data) != "true" {
+			t.Errorf("check with FAIL=%s output parameter = %q, %v, want true", fail, data, err)
+		}
+	}
+
+	// 按 Argo 替换任务的输出参数和状态后得到 when 的取值
+	tests := []struct {
+		task   string
+		values map[string]string
+		want   string
+	}{
+		{"step-2", map[string]string{"tasks.step-0.outputs.parameters.changed": "True"}, "'true' == 'true'"},
+		{"step-3", map[string]string{"tasks.step-1.status": "Failed"}, "'failure' == 'failure' && 'success' == 'success'"},
+		{"step-3", map[string]string{"tasks.step-1.status": "Succeeded"}, "'success' == 'failure' && 'success' == 'success'"},
+		{"step-3", map[string]string{"tasks.step-1.status": "Omitted"}, "'skipped' == 'failure' && 'skipped' == 'success'"},
+		{"step-3", map[string]string{"tasks.step-1.status": "Error"}, "'failure' == 'failure' && 'failure' == 'success'"},
+	}
+	when := make(map[string]string)
+	for _, task := range findTemplate(t, argoWf, "build").DAG.Tasks {
+		when[task.Name] = task.When
+	}
+	for _, tt := range tests {
+		got, err := argotemplate.Replace(strconv.Quote(when[tt.task]), tt.values, false)
+		if err != nil {
+			t.Fatalf("Replace(%s) error = %v", when[tt.task], err)
+		}
+		if got, _ = strconv.Unquote(got); got != tt.want {
+			t.Errorf("%s when with %v = %s, want %s", tt.task, tt.values, got, tt.want)
+		}
+	}
+}
+
+// TestRunStepConditionStepsErrors 测试 if 条件引用的 step 不能写出输出参数或不存在时返回错误
+func TestRunStepConditionStepsErrors(t *testing.T) {
+	tests := []struct {
+		step string
+		cond string
+		want string
+	}{
+		{"- id: lint\n        uses: docker://alpine", "steps.lint.outputs.result == 'ok'", "steps.lint.outputs cannot be used in if conditions"},
+		{"- id: lint\n        run: make lint", "steps.later.outcome == 'success'", "step later is not defined before it is referenced"},
+		{"- id: lint\n        run: make lint", "steps.lint.outputs.result.value == 'ok'", "steps.lint.outputs.result.value is not supported in if conditions"},
+		{"- id: lint\n        run: make lint", "steps.lint.outputs['a.b'] == 'ok'", "output a.b of step lint cannot be used in if conditions"},
+	}
+	for _, tt := range tests {
+		wf := readTestWorkflow(t, "name: ci\non: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      "+tt.step+"\n      - if: "+tt.cond+"\n        run: make\n")
+		if _, err := NewConverter(wf).Run(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Run() with if %s error = %v, want to contain %q", tt.cond, err, tt.want)
+		}
+	}
+}
+
+// TestRunScriptHeredoc 测试 job 脚本模式下多行命令原样拼接，heredoc 的缩进和空行保持不变
+func TestRunScriptHeredoc(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: heredoc
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: |
+          cat <<EOF > config.yaml
+          server:
+            port: 8080
+
+            host: localhost
+          EOF
+      - run: cat config.yaml
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	build := findTemplate(t, argoWf, "build")
+	if build.Container == nil || len(build.Container.Args) != 1 {
+		t.Fatalf("build template = %+v, want job script", build)
+	}
+	want := jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\ncat <<EOF > config.yaml\nserver:\n  port: 8080\n\n  host: localhost\nEOF\n\n)\n(\n__argus_runner_files\ncd /workspace\ncat config.yaml\n)"
+	if script := build.Container.Args[0]; script != want {
+		t.Errorf("build script = %q, want %q", script, want)
+	}
+	// 与 GitHub 未指定 shell 时一样，bash 存在时由 bash 执行
+	if command := build.Container.Command; len(command) != 4 || !strings.Contains(command[2], `exec bash -c "$1"`) {
+		t.Errorf("build command = %q, want bash when available", command)
+	}
+}
+
+// TestRunWorkspaceVolumes 测试每个 matrix 组合使用独立的工作区卷，卷的存储类、访问模式和容量可以配置
+func TestRunWorkspaceVolumes(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: volumes
+on: push
+jobs:
+  Build_All:
+    runs-on: ubuntu-latest
+    container: alpine
+    strategy:
+      matrix:
+        arch: [amd64, arm64]
+    steps:
+      - run: make ${{ matrix.arch }}
+`)
+	argoWf, err := NewConverter(wf, WithStepTemplates(), WithWorkspaceVolume(WorkspaceVolume{
+		StorageClass: "nfs",
+		AccessMode:   corev1.ReadWriteMany,
+		Size:         "20Gi",
+	})).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var names []string
+	for _, claim := range argoWf.Spec.VolumeClaimTemplates {
+		names = append(names, claim.Name)
+		if claim.Spec.StorageClassName == nil || *claim.Spec.StorageClassName != "nfs" ||
+			!reflect.DeepEqual(claim.Spec.AccessModes, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}) ||
+			claim.Spec.Resources.Requests.Storage().String() != "20Gi" {
+			t.Errorf("claim %s spec = %+v, want nfs ReadWriteMany 20Gi", claim.Name, claim.Spec)
+		}
+	}
+	if want := []string{"workspace-build-all-0", "workspace-build-all-1"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("volumeClaimTemplates = %v, want %v", names, want)
+	}
+	for i, name := range names {
+		step := findTemplate(t, argoWf, fmt.Sprintf("Build_All-%d-step-0", i))
+		for _, mount := range step.Script.VolumeMounts {
+			if mount.Name != name {
+				t.Errorf("Build_All-%d mounts %s, want %s", i, mount.Name, name)
+			}
+		}
+	}
+
+	if long := workspaceVolumeName(strings.Repeat("job", 30)); len(long) > 63 {
+		t.Errorf("workspaceVolumeName() = %q, want at most 63 characters", long)
+	}
+	if _, err := NewConverter(wf, WithStepTemplates(), WithWorkspaceVolume(WorkspaceVolume{Size: "big"})).Run(); err == nil {
+		t.Error("Run() with invalid workspace size should return error")
+	}
+}
+
+// TestRunStepConditions 测试带 if 条件的 step 不会出现在 job 脚本中，而是按 step 生成模板并由 when/depends 控制
+func TestRunStepConditions(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: conditions
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: make
+      - if: false
+        run: ./deploy.sh
+      - if: failure()
+        run: ./cleanup.sh
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	build := findTemplate(t, argoWf, "build")
+	if build.DAG == nil {
+		t.Fatalf("build template = %+v, want DAG", build)
+	}
+	for _, template := range argoWf.Spec.Templates {
+		if template.Container != nil && strings.Contains(strings.Join(template.Container.Args, "\n"), "./deploy.sh") {
+			t.Errorf("template %s runs the skipped step in the job script", template.Name)
+		}
+	}
+	if deploy := build.DAG.Tasks[1]; deploy.When != "false" {
+		t.Errorf("deploy step when = %q, want false", deploy.When)
+	}
+	if cleanup := build.DAG.Tasks[2]; cleanup.Depends != "step-0.Failed || step-0.Errored || step-1.Failed || step-1.Errored" {
+		t.Errorf("cleanup step depends = %q, want failure of previous steps", cleanup.Depends)
+	}
+}
+
+const envWorkflow = `
+name: env
+on: push
+env:
+  REGION: cn-north
+  LEVEL: workflow
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    strategy:
+      matrix:
+        arch: [arm64]
+    env:
+      LEVEL: job
+      IMAGE: app-${{ matrix.arch }}
+      REF: ${{ github.ref }}
+    steps:
+      - id: ver
+        run: echo "version=1.0" >> $GITHUB_OUTPUT
+      - env:
+          LEVEL: step
+          VERSION: ${{ steps.ver.outputs.version }}
+        run: echo ${{ env.LEVEL }} ${{ env.IMAGE }}
+      - run: echo $LEVEL
+`
+
+// TestRunEnv 测试 workflow/job/step 的 env 按优先级合并到容器环境变量和脚本中
+func TestRunEnv(t *testing.T) {
+	argoWf, err := NewConverter(readTestWorkflow(t, envWorkflow)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	container := findTemplate(t, argoWf, "build-0").Container
+	wantEnv := []corev1.EnvVar{
+		{Name: "IMAGE", Value: "app-arm64"},
+		{Name: "LEVEL", Value: "job"},
+		{Name: "REF", Value: "{{workflow.parameters.github-ref}}"},
+		{Name: "REGION", Value: "cn-north"},
+		{Name: "ARGUS_EXPR_0", Value: "app-arm64"},
+	}
+	if !reflect.DeepEqual(container.Env, wantEnv) {
+		t.Errorf("env = %+v, want %+v", container.Env, wantEnv)
+	}
+
+	// step env 在子 shell 中导出，env 上下文中的 step 变量直接引用导出的变量
+	for _, want := range []string{
+		"(\n__argus_runner_files\ncd /workspace\nexport LEVEL=\"step\"\nexport VERSION=\"$(__argus_step_output 'ver' 'version')\"\necho ${LEVEL} ${ARGUS_EXPR_0}\n)\n",
+		"echo $LEVEL",
+	} {
+		if !strings.Contains(container.Args[0], want) {
+			t.Errorf("script does not contain %q:\n%s", want, container.Args[0])
+		}
+	}
+}
+
+// TestRunEnvStepTemplates 测试 step 模板模式下 env 的传递
+func TestRunEnvStepTemplates(t *testing.T) {
+	argoWf, err := NewConverter(readTestWorkflow(t, envWorkflow), WithStepTemplates()).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	script := findTemplate(t, argoWf, "build-0-step-1").Script
+	if !strings.HasSuffix(script.Source, "export LEVEL=\"step\"\nexport VERSION=\"$(__argus_step_output 'ver' 'version')\"\necho ${LEVEL} ${ARGUS_EXPR_0}") {
+		t.Errorf("source = %q", script.Source)
+	}
+	var names []string
+	for _, v := range script.Env {
+		names = append(names, v.Name)
+	}
+	if want := []string{"IMAGE", "LEVEL", "REF", "REGION", "GITHUB_OUTPUT", "GITHUB_ENV", "GITHUB_PATH", "ARGUS_EXPR_0"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("env names = %q, want %q", names, want)
+	}
+}
+
+const secretsWorkflow = `
+name: publish
+on: push
+jobs:
+  publish:
+    runs-on: ubuntu-latest
+    container: alpine
+    env:
+      REGISTRY_PASSWORD: ${{ secrets.registry_password }}
+    steps:
+      - run: echo "${{ secrets.TOKEN }}" | login --token-stdin && push ${{ secrets.TOKEN }}
+`
+
+// TestRunSecrets 测试 secrets 引用转换为 secretKeyRef，仓库映射优先于组织映射
+func TestRunSecrets(t *testing.T) {
+	argoWf, err := NewConverter(readTestWorkflow(t, secretsWorkflow),
+		WithRepository("openeuler/infra"),
+		WithSecretMapping(map[string]string{
+			"openeuler":       "openeuler-secrets",
+			"openeuler/infra": "infra-secrets",
+		}),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	container := findTemplate(t, argoWf, "publish").Container
+	secretRef := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "infra-secrets"},
+			Key:                  key,
+		}}
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "REGISTRY_PASSWORD", ValueFrom: secretRef("REGISTRY_PASSWORD")},
+		{Name: "ARGUS_EXPR_0", ValueFrom: secretRef("TOKEN")},
+	}
+	if !reflect.DeepEqual(container.Env, wantEnv) {
+		t.Errorf("env = %+v, want %+v", container.Env, wantEnv)
+	}
+	if want := jobScriptHeader + "\n(\n__argus_runner_files\ncd /workspace\necho \"${ARGUS_EXPR_0}\" | login --token-stdin && push ${ARGUS_EXPR_0}\n)"; container.Args[0] != want {
+		t.Errorf("script = %q, want %q", container.Args[0], want)
+	}
+
+	// secrets.GITHUB_TOKEN 与 github.token 一样，没有映射时为空字符串
+	wf := readTestWorkflow(t, `
+name: token
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    env:
+      GH_TOKEN: ${{ secrets.GITHUB_TOKEN }}
+    steps:
+      - run: gh release list
+`)
+	argoWf, err = NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() with GITHUB_TOKEN error = %v", err)
+	}
+	if env := findTemplate(t, argoWf, "build").Container.Env; !containsEnvVar(env, corev1.EnvVar{Name: "GH_TOKEN"}) {
+		t.Errorf("env = %+v, want empty GH_TOKEN", env)
+	}
+}
+
+// TestRunSecretsErrors 测试未映射的 secret 和不允许使用 secret 的位置报错
+func TestRunSecretsErrors(t *testing.T) {
+	mapping := WithSecretMapping(map[string]string{"openeuler": "openeuler-secrets"})
+
+	_, err := NewConverter(readTestWorkflow(t, secretsWorkflow), WithRepository("src-openeuler/kernel"), mapping).Run()
+	if err == nil || !strings.Contains(err.Error(), "repository src-openeuler/kernel is not mapped to a Kubernetes Secret") {
+		t.Errorf("Run() with unmapped repository error = %v", err)
+	}
+
+	cases := map[string]string{
+		"outputs:\n      token: ${{ secrets.TOKEN }}":               "output token must not reference secrets",
+		"env:\n      AUTH: Bearer ${{ secrets.TOKEN }}":             "can only be used as the whole value",
+		"steps:\n      - run: echo ${{ format('{0}', secrets.A) }}": "secrets can only be used as a whole value",
+	}
+	for field, want := range cases {
+		wf := readTestWorkflow(t, `
+name: publish
+on: push
+jobs:
+  publish:
+    runs-on: ubuntu-latest
+    `+field+`
+`)
+		if wf.Jobs["publish"].Steps == nil {
+			wf.Jobs["publish"].Steps = []*model.Step{{Run: "echo"}}
+		}
+		_, err := NewConverter(wf, WithRepository("openeuler/infra"), mapping).Run()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Run() with %q error = %v, want to contain %q", field, err, want)
+		}
+	}
+}
+
+// TestRunCheckout 测试 actions/checkout 转换为 git 克隆脚本
+func TestRunCheckout(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/checkout@v4
+        with:
+          repository: openeuler/infra
+          ref: ${{ github.head_ref }}
+          path: infra
+          token: ${{ secrets.INFRA_TOKEN }}
+          fetch-depth: 0
+          submodules: recursive
+          lfs: true
+          persist-credentials: true
+      - run: make -C infra
+`)
+	argoWf, err := NewConverter(wf,
+		WithRepository("openeuler/argus"),
+		WithSecretMapping(map[string]string{"openeuler": "openeuler-secrets"}),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	container := findTemplate(t, argoWf, "build").Container
+	script := container.Args[0]
+	for _, want := range []string{
+		// 默认检出当前仓库触发事件的提交，使用可选的 GITHUB_TOKEN
+		"__argus_repository=\"${ARGUS_EXPR_0}\"\n__argus_ref=\"${ARGUS_EXPR_1}\"\n__argus_path=\".\"\n__argus_token=\"${ARGUS_EXPR_2}\"",
+		`git -C "$__argus_path" -c "http.https://github.com/.extraheader=$__argus_auth" fetch --no-tags --prune --depth=1 origin "$__argus_ref"`,
+		// 指定的仓库、ref、路径和 token
+		"__argus_repository=\"openeuler/infra\"\n__argus_ref=\"${ARGUS_EXPR_3}\"\n__argus_path=\"infra\"\n__argus_token=\"${ARGUS_EXPR_4}\"",
+		`git -C "$__argus_path" -c "http.https://github.com/.extraheader=$__argus_auth" fetch --no-tags --prune origin "$__argus_ref"`,
+		`git -C "$__argus_path" -c "http.https://github.com/.extraheader=$__argus_auth" submodule update --init --force --recursive` + "\n",
+		"git -C \"$__argus_path\" lfs install --local\ngit -C \"$__argus_path\" -c \"http.https://github.com/.extraheader=$__argus_auth\" lfs pull\n" +
+			`[ -z "$__argus_auth" ] || git -C "$__argus_path" config --local "http.https://github.com/.extraheader" "$__argus_auth"` + "\n)",
+		"make -C infra",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script does not contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Count(script, "config --local") != 1 {
+		t.Errorf("credentials should only be persisted when persist-credentials is true:\n%s", script)
+	}
+
+	optional := true
+	wantEnv := []corev1.EnvVar{
+		{Name: "ARGUS_EXPR_0", Value: "{{workflow.parameters.github-repository}}"},
+		{Name: "ARGUS_EXPR_1", Value: "{{workflow.parameters.github-sha}}"},
+		{Name: "ARGUS_EXPR_2", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "openeuler-secrets"},
+			Key:                  "GITHUB_TOKEN",
+			Optional:             &optional,
+		}}},
+		{Name: "ARGUS_EXPR_3", Value: "{{workflow.parameters.github-head_ref}}"},
+		{Name: "ARGUS_EXPR_4", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "openeuler-secrets"},
+			Key:                  "INFRA_TOKEN",
+		}}},
+	}
+	if !reflect.DeepEqual(container.Env, wantEnv) {
+		t.Errorf("env = %+v, want %+v", container.Env, wantEnv)
+	}
+	if container.WorkingDir != "/workspace" {
+		t.Errorf("workingDir = %q, want /workspace", container.WorkingDir)
+	}
+}
+
+// TestRunUnsupportedAction 测试无法转换的 action 返回错误，而不是跳过 step
+func TestRunUnsupportedAction(t *testing.T) {
+	source := fstest.MapFS{
+		"octo/lint@v1/action.yml": {Data: []byte("name: lint\nruns:\n  using: docker\n  image: Dockerfile\n")},
+	}
+	tests := []struct {
+		name string
+		uses string
+		want string
+	}{
+		{"unknown action", "octo/deploy@v1", "action octo/deploy@v1 is not found in the action source"},
+		{"invalid action", "octo@v1", `invalid action "octo@v1"`},
+		{"docker action", "octo/lint@v1", "action octo/lint@v1 runs using docker, which is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := readTestWorkflow(t, fmt.Sprintf(`
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - uses: %s
+      - run: make
+`, tt.uses))
+			for _, opts := range [][]Option{{WithActionSource(source)}, {WithActionSource(source), WithStepTemplates()}} {
+				if _, err := NewConverter(wf, opts...).Run(); err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("Run() error = %v, want %q", err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestRunDockerStep 测试 docker:// step 转换为挂载工作区的独立容器模板
+func TestRunDockerStep(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: lint
+on: push
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    container: alpine
+    env:
+      MODE: strict
+    steps:
+      - run: echo prepare
+      - name: Shellcheck
+        uses: docker://koalaman/shellcheck:stable
+        env:
+          SHELLCHECK_OPTS: -e SC1091
+        with:
+          entrypoint: /bin/shellcheck
+          args: --severity=${{ env.MODE }} "scripts/build.sh"
+          who to-greet: ${{ github.actor }}
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// 含 Docker step 的 job 自动按 step 生成模板
+	if len(argoWf.Spec.VolumeClaimTemplates) != 1 {
+		t.Errorf("volumeClaimTemplates = %+v, want workspace claim", argoWf.Spec.VolumeClaimTemplates)
+	}
+	lint := findTemplate(t, argoWf, "lint")
+	if lint.DAG == nil || len(lint.DAG.Tasks) != 2 || lint.DAG.Tasks[1].Depends != "step-0.Succeeded || step-0.Skipped" {
+		t.Fatalf("lint template = %+v, want DAG with 2 sequential tasks", lint.DAG)
+	}
+
+	container := findTemplate(t, argoWf, "lint-step-1").Container
+	if container == nil {
+		t.Fatalf("lint-step-1 is not a container template")
+	}
+	if container.Image != "koalaman/shellcheck:stable" {
+		t.Errorf("image = %q", container.Image)
+	}
+	if !reflect.DeepEqual(container.Command, []string{"/bin/shellcheck"}) {
+		t.Errorf("command = %q", container.Command)
+	}
+	if want := []string{"--severity=strict", "scripts/build.sh"}; !reflect.DeepEqual(container.Args, want) {
+		t.Errorf("args = %q, want %q", container.Args, want)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "INPUT_WHO_TO-GREET", Value: "{{workflow.parameters.github-actor}}"},
+		{Name: "MODE", Value: "strict"},
+		{Name: "SHELLCHECK_OPTS", Value: "-e SC1091"},
+		{Name: "GITHUB_OUTPUT", Value: "/tmp/argus/steps/__step1"},
+		{Name: "GITHUB_ENV", Value: "/tmp/argus/steps/@env"},
+		{Name: "GITHUB_PATH", Value: "/tmp/argus/steps/@path"},
+	}
+	if !reflect.DeepEqual(container.Env, wantEnv) {
+		t.Errorf("env = %+v, want %+v", container.Env, wantEnv)
+	}
+	if container.WorkingDir != "/workspace" || len(container.VolumeMounts) != 3 {
+		t.Errorf("workingDir = %q, volumeMounts = %+v, want shared workspace", container.WorkingDir, container.VolumeMounts)
+	}
+}
+
+// compositeActions 包含一个本地 composite action 和它引用的远程 composite action
+var compositeActions = fstest.MapFS{
+	".github/actions/setup/action.yml": {Data: []byte(`
+name: setup
+inputs:
+  version:
+    default: "1.0"
+  target:
+    required: true
+outputs:
+  path:
+    value: ${{ steps.install.outputs.path }}
+runs:
+  using: composite
+  steps:
+    - id: install
+      shell: sh
+      run: echo "path=/opt/${{ inputs.version }}/${{ inputs.target }}" >> "$GITHUB_OUTPUT"
+    - uses: openeuler/actions/greet@v1
+      with:
+        who: ${{ inputs.target }}
+`)},
+	"openeuler/actions@v1/greet/action.yml": {Data: []byte(`
+name: greet
+inputs:
+  who:
+    default: world
+runs:
+  using: composite
+  steps:
+    - run: echo "hello ${{ inputs.who }}"
+      shell: sh
+`)},
+	".github/actions/loop/action.yml": {Data: []byte(`
+name: loop
+runs:
+  using: composite
+  steps:
+    - uses: ./.github/actions/loop
+`)},
+}
+
+const compositeWorkflow = `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - id: setup
+        uses: ./.github/actions/setup
+        env:
+          LEVEL: debug
+        with:
+          target: linux
+      - run: ls ${{ steps.setup.outputs.path }}
+`
+
+// TestRunCompositeAction 测试 composite action 在 job 脚本中原位展开，输入默认值和 outputs 映射生效
+func TestRunCompositeAction(t *testing.T) {
+	wf := readTestWorkflow(t, compositeWorkflow)
+	argoWf, err := NewConverter(wf, WithWorkspace(compositeActions), WithActionSource(compositeActions)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	container := findTemplate(t, argoWf, "build").Container
+	want := strings.Join([]string{
+		"mkdir -p /tmp/argus/steps && : > '/tmp/argus/steps/setup' && export GITHUB_OUTPUT='/tmp/argus/steps/setup'",
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		`export LEVEL="debug"`,
+		"mkdir -p /tmp/argus/steps && : > '/tmp/argus/steps/setup.install' && export GITHUB_OUTPUT='/tmp/argus/steps/setup.install'",
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		`echo "path=/opt/${ARGUS_EXPR_0}/${ARGUS_EXPR_1}" >> "$GITHUB_OUTPUT"`,
+		")",
+		"mkdir -p /tmp/argus/steps && : > '/tmp/argus/steps/setup.__step1' && export GITHUB_OUTPUT='/tmp/argus/steps/setup.__step1'",
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		"mkdir -p /tmp/argus/steps && : > '/tmp/argus/steps/setup.__step1.__step0' && export GITHUB_OUTPUT='/tmp/argus/steps/setup.__step1.__step0'",
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		`echo "hello ${ARGUS_EXPR_1}"`,
+		")",
+		")",
+		`printf '%s<<__ARGUS_ACTION_OUTPUT__\n%s\n__ARGUS_ACTION_OUTPUT__\n' 'path' "$(__argus_step_output 'setup.install' 'path')" >> '/tmp/argus/steps/setup'`,
+		")",
+		"mkdir -p /tmp/argus/steps && : > '/tmp/argus/steps/__step1' && export GITHUB_OUTPUT='/tmp/argus/steps/__step1'",
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		"ls $(__argus_step_output 'setup' 'path')",
+		")",
+	}, "\n")
+	if !strings.HasSuffix(container.Args[0], want) {
+		t.Errorf("script = %s\nwant suffix %s", container.Args[0], want)
+	}
+
+	wantEnv := []corev1.EnvVar{
+		{Name: "ARGUS_EXPR_0", Value: "1.0"},
+		{Name: "ARGUS_EXPR_1", Value: "linux"},
+	}
+	if !reflect.DeepEqual(container.Env, wantEnv) {
+		t.Errorf("env = %+v, want %+v", container.Env, wantEnv)
+	}
+}
+
+// TestRunCompositeActionStepTemplates 测试 step 模板模式下 composite action 转换为嵌套的 DAG 模板
+func TestRunCompositeActionStepTemplates(t *testing.T) {
+	wf := readTestWorkflow(t, compositeWorkflow)
+	argoWf, err := NewConverter(wf,
+		WithWorkspace(compositeActions),
+		WithActionSource(compositeActions),
+		WithStepTemplates(),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	setup := findTemplate(t, argoWf, "build-step-0")
+	if setup.DAG == nil {
+		t.Fatalf("build-step-0 is not a DAG template")
+	}
+	var tasks []string
+	for _, task := range setup.DAG.Tasks {
+		tasks = append(tasks, task.Name+":"+task.Template)
+	}
+	wantTasks := []string{"step-0:build-step-0-step-0", "step-1:build-step-0-step-1", "outputs:build-step-0-outputs"}
+	if !reflect.DeepEqual(tasks, wantTasks) {
+		t.Errorf("tasks = %v, want %v", tasks, wantTasks)
+	}
+
+	install := findTemplate(t, argoWf, "build-step-0-step-0").Script
+	wantEnv := []corev1.EnvVar{
+		{Name: "LEVEL", Value: "debug"},
+		{Name: "GITHUB_OUTPUT", Value: "/tmp/argus/steps/setup.install"},
+		{Name: "GITHUB_ENV", Value: "/tmp/argus/steps/@env"},
+		{Name: "GITHUB_PATH", Value: "/tmp/argus/steps/@path"},
+		{Name: "ARGUS_EXPR_0", Value: "1.0"},
+		{Name: "ARGUS_EXPR_1", Value: "linux"},
+	}
+	if !reflect.DeepEqual(install.Env, wantEnv) {
+		t.Errorf("env = %+v, want %+v", install.Env, wantEnv)
+	}
+
+	greet := findTemplate(t, argoWf, "build-step-0-step-1-step-0").Script
+	if greet.Source != runnerFilesScript+"\n"+`echo "hello ${ARGUS_EXPR_0}"` {
+		t.Errorf("source = %q", greet.Source)
+	}
+
+	outputs := findTemplate(t, argoWf, "build-step-0-outputs").Script
+	if !strings.HasSuffix(outputs.Source, `"$(__argus_step_output 'setup.install' 'path')" >> '/tmp/argus/steps/setup'`) {
+		t.Errorf("outputs source = %s", outputs.Source)
+	}
+}
+
+// TestRunCompositeActionErrors 测试 composite action 递归引用超过嵌套层数限制时报错
+func TestRunCompositeActionErrors(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: ./.github/actions/loop
+`)
+	_, err := NewConverter(wf, WithWorkspace(compositeActions)).Run()
+	if err == nil || !strings.Contains(err.Error(), "composite actions are nested more than 10 levels") {
+		t.Errorf("Run() error = %v, want nesting error", err)
+	}
+
+	// 找不到的本地 action 返回错误，不能跳过 step
+	_, err = NewConverter(wf).Run()
+	if err == nil || !strings.Contains(err.Error(), "local action ./.github/actions/loop is not available") {
+		t.Errorf("Run() without workspace error = %v, want unavailable error", err)
+	}
+	_, err = NewConverter(wf, WithWorkspaceFiles(map[string]string{"README.md": "# build"})).Run()
+	if err == nil || !strings.Contains(err.Error(), "action ./.github/actions/loop is not found in the repository files") {
+		t.Errorf("Run() with missing action error = %v, want not found error", err)
+	}
+}
+
+// nodeActions 包含一个带 pre 和 post 入口的本地 node action 和一个远程 node action
+var nodeActions = fstest.MapFS{
+	".github/actions/hello/action.yml": {Data: []byte(`
+name: hello
+inputs:
+  who-to-greet:
+    default: world
+  token:
+    default: ${{ github.server_url == 'https://github.com' && github.token || '' }}
+runs:
+  using: node20
+  pre: dist/pre.js
+  main: dist/main.js
+  post: dist/post.js
+`)},
+	"actions/setup-python@v5/action.yml": {Data: []byte(`
+name: setup-python
+inputs:
+  python-version:
+    required: false
+runs:
+  using: node20
+  main: dist/setup/index.js
+`)},
+}
+
+// TestRunNodeAction 测试 node action 的 pre、main、post 入口转换为 Node 镜像中的独立 step
+func TestRunNodeAction(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - id: hello
+        uses: ./.github/actions/hello
+        with:
+          who-to-greet: ${{ github.actor }}
+      - run: echo done
+`)
+	argoWf, err := NewConverter(wf,
+		WithWorkspace(nodeActions),
+		WithRepository("openeuler/argus"),
+		WithSecretMapping(map[string]string{"openeuler": "openeuler-secrets"}),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// node action 所在的 job 自动按 step 生成模板，post 在所有 step 之后执行
+	build := findTemplate(t, argoWf, "build")
+	var tasks []string
+	for _, task := range build.DAG.Tasks {
+		tasks = append(tasks, task.Name+":"+task.Depends)
+	}
+	wantTasks := []string{
+		"step-0-pre:",
+		"step-0:step-0-pre.Succeeded",
+		"step-1:(step-0-pre.Succeeded || step-0-pre.Skipped) && (step-0.Succeeded || step-0.Skipped)",
+		"step-0-post:(step-0.Succeeded || step-0.Failed || step-0.Errored) && (" +
+			"(step-0-pre.Succeeded || step-0-pre.Skipped || step-0-pre.Failed || step-0-pre.Errored || step-0-pre.Omitted) && " +
+			"(step-0.Succeeded || step-0.Skipped || step-0.Failed || step-0.Errored || step-0.Omitted) && " +
+			"(step-1.Succeeded || step-1.Skipped || step-1.Failed || step-1.Errored || step-1.Omitted))",
+	}
+	if !reflect.DeepEqual(tasks, wantTasks) {
+		t.Errorf("tasks = %q, want %q", tasks, wantTasks)
+	}
+
+	main := findTemplate(t, argoWf, "build-step-0").Script
+	if main.Image != "node:20" || !reflect.DeepEqual(main.Command, []string{"node"}) {
+		t.Errorf("image = %q, command = %q, want node:20 node", main.Image, main.Command)
+	}
+	if !strings.HasSuffix(main.Source, `run("/workspace/.github/actions/hello/dist/main.js");`) {
+		t.Errorf("source does not run main entry:\n%s", main.Source)
+	}
+	post := findTemplate(t, argoWf, "build-step-0-post")
+	if !strings.HasSuffix(post.Script.Source, `run("/workspace/.github/actions/hello/dist/post.js");`) {
+		t.Errorf("source does not run post entry:\n%s", post.Script.Source)
+	}
+	if name := post.Annotations[string(wfv1.TemplateAnnotationDisplayName)]; name != "Post ./.github/actions/hello" {
+		t.Errorf("post display name = %q, want Post ./.github/actions/hello", name)
+	}
+
+	optional := true
+	env := make(map[string]corev1.EnvVar)
+	for _, v := range main.Env {
+		env[v.Name] = v
+	}
+	for _, want := range []corev1.EnvVar{
+		{Name: "INPUT_WHO-TO-GREET", Value: "{{workflow.parameters.github-actor}}"},
+		{Name: "INPUT_TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "openeuler-secrets"},
+			Key:                  "GITHUB_TOKEN",
+			Optional:             &optional,
+		}}},
+		{Name: "GITHUB_OUTPUT", Value: "/tmp/argus/steps/hello"},
+		{Name: "GITHUB_STATE", Value: "/tmp/argus/steps/hello@state"},
+		{Name: "GITHUB_ENV", Value: "/tmp/argus/steps/@env"},
+		{Name: "GITHUB_SHA", Value: "{{workflow.parameters.github-sha}}"},
+		{Name: "RUNNER_TOOL_CACHE", Value: "/opt/hostedtoolcache"},
+	} {
+		if !reflect.DeepEqual(env[want.Name], want) {
+			t.Errorf("env %s = %+v, want %+v", want.Name, env[want.Name], want)
+		}
+	}
+
+	// 之后的 shell step 加载 node action 写入的 $GITHUB_ENV 和 $GITHUB_PATH
+	run := findTemplate(t, argoWf, "build-step-1").Script
+	if !strings.HasPrefix(run.Source, runnerFilesScript+"\necho done") {
+		t.Errorf("source = %s", run.Source)
+	}
+}
+
+// TestRunRemoteNodeAction 测试远程 node action 从 action 卷挂载源码，找不到 action 或未配置 action 卷时报错
+func TestRunRemoteNodeAction(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/setup-python@v5
+        with:
+          python-version: "3.12"
+`)
+	// 不在 action 源码目录中的 action 不能跳过，否则 job 会在缺少 action 的情况下执行
+	_, err := NewConverter(wf).Run()
+	if err == nil || !strings.Contains(err.Error(), "action actions/setup-python@v5 is not available, no action source is configured") {
+		t.Errorf("Run() without action source error = %v, want unavailable error", err)
+	}
+	_, err = NewConverter(wf, WithActionSource(fstest.MapFS{})).Run()
+	if err == nil || !strings.Contains(err.Error(), "action actions/setup-python@v5 is not found in the action source") {
+		t.Errorf("Run() with missing action error = %v, want not found error", err)
+	}
+
+	_, err = NewConverter(wf, WithActionSource(nodeActions)).Run()
+	if err == nil || !strings.Contains(err.Error(), "an action volume must be configured") {
+		t.Errorf("Run() error = %v, want action volume error", err)
+	}
+
+	volume := corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "actions"}}
+	argoWf, err := NewConverter(wf,
+		WithActionSource(nodeActions),
+		WithActionVolume(volume),
+		WithNodeImage("registry.example.com/node:20"),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := []corev1.Volume{{Name: "actions", VolumeSource: volume}}; !reflect.DeepEqual(argoWf.Spec.Volumes, want) {
+		t.Errorf("volumes = %+v, want %+v", argoWf.Spec.Volumes, want)
+	}
+
+	script := findTemplate(t, argoWf, "build-step-0").Script
+	if script.Image != "registry.example.com/node:20" {
+		t.Errorf("image = %q", script.Image)
+	}
+	if want := (corev1.VolumeMount{Name: "actions", MountPath: "/argus/actions", ReadOnly: true}); script.VolumeMounts[len(script.VolumeMounts)-1] != want {
+		t.Errorf("volumeMounts = %+v, want action volume", script.VolumeMounts)
+	}
+	if !strings.HasSuffix(script.Source, `run("/argus/actions/actions/setup-python@v5/dist/setup/index.js");`) {
+		t.Errorf("source does not run main entry:\n%s", script.Source)
+	}
+}
+
+const servicesWorkflow = `
+name: test
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    outputs:
+      port: ${{ steps.port.outputs.port }}
+    services:
+      postgres:
+        image: postgres:16
+        env:
+          POSTGRES_PASSWORD: postgres
+        ports:
+          - 5432:5432
+        options: >-
+          --health-cmd "pg_isready -U postgres"
+          --health-interval 10s
+          --health-timeout=5s
+          --health-retries 5
+      redis:
+        image: redis
+        ports:
+          - 6379/tcp
+      minio:
+        image: ${{ false && 'minio/minio' || '' }}
+    steps:
+      - id: port
+        run: echo "port=${{ job.services.redis.ports['6379'] }}" >> "$GITHUB_OUTPUT"
+`
+
+// servicesContainers 是 servicesWorkflow 中服务对应的容器
+var servicesContainers = []corev1.Container{
+	{
+		Name:  "postgres",
+		Image: "postgres:16",
+		Env:   []corev1.EnvVar{{Name: "POSTGRES_PASSWORD", Value: "postgres"}},
+		Ports: []corev1.ContainerPort{{ContainerPort: 5432, Protocol: corev1.ProtocolTCP}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "pg_isready -U postgres"}},
+			},
+			PeriodSeconds:    10,
+			TimeoutSeconds:   5,
+			FailureThreshold: 5,
+		},
+	},
+	{
+		Name:  "redis",
+		Image: "redis",
+		Env:   []corev1.EnvVar{},
+		Ports: []corev1.ContainerPort{{ContainerPort: 6379, Protocol: corev1.ProtocolTCP}},
+	},
+}
+
+// TestRunServices 测试 services 转换为 sidecar，服务名解析到本地，健康检查转换为就绪探针
+func TestRunServices(t *testing.T) {
+	argoWf, err := NewConverter(readTestWorkflow(t, servicesWorkflow)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	template := findTemplate(t, argoWf, "test")
+	var want []wfv1.UserContainer
+	for _, container := range servicesContainers {
+		want = append(want, wfv1.UserContainer{Container: container})
+	}
+	if !reflect.DeepEqual(template.Sidecars, want) {
+		t.Errorf("sidecars = %+v, want %+v", template.Sidecars, want)
+	}
+	wantAliases := []corev1.HostAlias{{IP: "127.0.0.1", Hostnames: []string{"postgres", "redis"}}}
+	if !reflect.DeepEqual(template.HostAliases, wantAliases) {
+		t.Errorf("hostAliases = %+v, want %+v", template.HostAliases, wantAliases)
+	}
+	if script := template.Container.Args[0]; !strings.Contains(script, `echo "port=6379" >> "$GITHUB_OUTPUT"`) {
+		t.Errorf("script = %s", script)
+	}
+}
+
+// TestRunServicesStepTemplates 测试按 step 生成模板时服务由 daemon 任务运行一次，step 等待服务就绪，
+// 通过服务 pod 的 IP 解析服务名
+func TestRunServicesStepTemplates(t *testing.T) {
+	workflow := strings.Replace(servicesWorkflow, "    steps:\n", "    steps:\n      - run: psql -h postgres -c 'create table t (id int)'\n", 1)
+	argoWf, err := NewConverter(readTestWorkflow(t, workflow), WithStepTemplates()).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for _, container := range servicesContainers {
+		daemon := findTemplate(t, argoWf, "test-service-"+container.Name)
+		if daemon.Daemon == nil || !*daemon.Daemon {
+			t.Errorf("template %s is not a daemon", daemon.Name)
+		}
+		if daemon.Container == nil || !reflect.DeepEqual(*daemon.Container, container) {
+			t.Errorf("template %s container = %+v, want %+v", daemon.Name, daemon.Container, container)
+		}
+		if want := activeDeadline(360 * 60); !reflect.DeepEqual(daemon.ActiveDeadlineSeconds, want) {
+			t.Errorf("template %s activeDeadlineSeconds = %v, want %v", daemon.Name, daemon.ActiveDeadlineSeconds, want)
+		}
+	}
+
+	tasks := make(map[string]wfv1.DAGTask)
+	for _, task := range findTemplate(t, argoWf, "test").DAG.Tasks {
+		tasks[task.Name] = task
+	}
+	for name, depends := range map[string]string{
+		"service-postgres": "",
+		"service-redis":    "",
+		"step-0":           "service-postgres.Daemoned && service-redis.Daemoned",
+		"step-1":           "step-0.Succeeded || step-0.Skipped",
+	} {
+		if task, ok := tasks[name]; !ok || task.Depends != depends {
+			t.Errorf("task %s depends = %q, want %q", name, task.Depends, depends)
+		}
+	}
+	for _, name := range []string{"step-0", "step-1"} {
+		args := make(map[string]string)
+		for _, param := range tasks[name].Arguments.Parameters {
+			args[param.Name] = param.Value.String()
+		}
+		if args["service-postgres"] != "{{tasks.service-postgres.ip}}" || args["service-redis"] != "{{tasks.service-redis.ip}}" {
+			t.Errorf("task %s arguments = %v", name, args)
+		}
+	}
+
+	for _, name := range []string{"test-step-0", "test-step-1"} {
+		template := findTemplate(t, argoWf, name)
+		if len(template.Sidecars) != 0 {
+			t.Errorf("template %s has sidecars %+v", name, template.Sidecars)
+		}
+		wantAliases := []corev1.HostAlias{
+			{IP: "{{inputs.parameters.service-postgres}}", Hostnames: []string{"postgres"}},
+			{IP: "{{inputs.parameters.service-redis}}", Hostnames: []string{"redis"}},
+		}
+		if !reflect.DeepEqual(template.HostAliases, wantAliases) {
+			t.Errorf("template %s hostAliases = %+v, want %+v", name, template.HostAliases, wantAliases)
+		}
+	}
+	if script := findTemplate(t, argoWf, "test-step-1").Script.Source; !strings.Contains(script, `echo "port=6379" >> "$GITHUB_OUTPUT"`) {
+		t.Errorf("script = %s", script)
+	}
+	// 只有运行 step 的模板需要服务
+	if outputs := findTemplate(t, argoWf, "test-outputs"); len(outputs.HostAliases) != 0 {
+		t.Errorf("outputs template has hostAliases %+v", outputs.HostAliases)
+	}
+
+	// 服务与 step 不在同一个 pod 中，与 job 容器共享命名卷时转换失败
+	_, err = NewConverter(readTestWorkflow(t, containerWorkflow), WithStepTemplates(),
+		WithImagePullSecrets(map[string]string{"ghcr.io": "ghcr-pull"})).Run()
+	if err == nil || !strings.Contains(err.Error(), "service redis shares volume /data with the job container") {
+		t.Errorf("Run() error = %v, want shared volume error", err)
+	}
+
+	// composite action 的 DAG 模板通过输入参数将服务的 IP 转发给内部的 step
+	workflow = strings.Replace(compositeWorkflow, "    steps:\n", "    services:\n      redis:\n        image: redis\n    steps:\n", 1)
+	argoWf, err = NewConverter(readTestWorkflow(t, workflow),
+		WithWorkspace(compositeActions),
+		WithActionSource(compositeActions),
+		WithStepTemplates(),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, name := range []string{"build-step-0", "build-step-0-step-1"} {
+		dag := findTemplate(t, argoWf, name)
+		if dag.Inputs.GetParameterByName("service-redis") == nil {
+			t.Errorf("template %s inputs = %+v, want service-redis", name, dag.Inputs.Parameters)
+		}
+		for _, task := range dag.DAG.Tasks {
+			if task.Name == outputsTaskName {
+				continue
+			}
+			if param := task.Arguments.GetParameterByName("service-redis"); param == nil || param.Value.String() != "{{inputs.parameters.service-redis}}" {
+				t.Errorf("template %s task %s arguments = %+v", name, task.Name, task.Arguments.Parameters)
+			}
+		}
+	}
+	greet := findTemplate(t, argoWf, "build-step-0-step-1-step-0")
+	if want := []corev1.HostAlias{{IP: "{{inputs.parameters.service-redis}}", Hostnames: []string{"redis"}}}; !reflect.DeepEqual(greet.HostAliases, want) {
+		t.Errorf("hostAliases = %+v, want %+v", greet.HostAliases, want)
+	}
+}
+
+// TestRunServicesErrors 测试无法转换为 sidecar 的服务配置
+func TestRunServicesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		wantErr string
+	}{
+		{"port mapping", "ports: ['8080:80']", "maps to a different host port"},
+		{"unsupported option", "options: --network host", "option --network is not supported"},
+		{"health without command", "options: --health-interval 10s", "health options require --health-cmd"},
+		{"invalid duration", "options: --health-cmd true --health-timeout soon", "invalid --health-timeout"},
+		{"relative volume", "volumes: ['data:data']", "the container path must be absolute"},
+		{"unmapped credentials", "credentials: {username: u, password: p}", "credentials for registry docker.io require an image pull secret mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := readTestWorkflow(t, `
+name: test
+on: push
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    services:
+      web:
+        image: nginx
+        `+tt.service+`
+    steps:
+      - run: curl http://web
+`)
+			_, err := NewConverter(wf).Run()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+const containerWorkflow = `
+name: build
+on: push
+env:
+  LEVEL: workflow
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container:
+      image: ghcr.io/openeuler/builder:latest
+      credentials:
+        username: ${{ github.actor }}
+        password: ${{ secrets.GHCR_TOKEN }}
+      env:
+        LEVEL: container
+        CC: gcc
+      ports:
+        - 8080
+      volumes:
+        - cache:/cache
+        - /var/run/docker.sock:/var/run/docker.sock:ro
+        - /scratch
+      options: --cpus 2 --memory=4g --user 1000:1000 --privileged --shm-size 1g
+    services:
+      redis:
+        image: redis
+        volumes:
+          - cache:/data
+    steps:
+      - run: make
+`
+
+// TestRunJobContainer 测试 job 的 container 配置转换为镜像拉取 Secret、容器环境变量、端口、卷、资源限制和安全上下文
+func TestRunJobContainer(t *testing.T) {
+	for _, stepTemplates := range []bool{false, true} {
+		opts := []Option{WithImagePullSecrets(map[string]string{"ghcr.io": "ghcr-pull"})}
+		name, workflow := "build", containerWorkflow
+		if stepTemplates {
+			// 服务运行在单独的 pod 中，不能与 job 容器共享命名卷
+			opts = append(opts, WithStepTemplates())
+			name, workflow = "build-step-0", strings.Replace(containerWorkflow, "- cache:/data", "- /data", 1)
+		}
+		argoWf, err := NewConverter(readTestWorkflow(t, workflow), opts...).Run()
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if want := []corev1.LocalObjectReference{{Name: "ghcr-pull"}}; !reflect.DeepEqual(argoWf.Spec.ImagePullSecrets, want) {
+			t.Errorf("imagePullSecrets = %+v, want %+v", argoWf.Spec.ImagePullSecrets, want)
+		}
+
+		template := findTemplate(t, argoWf, name)
+		container := template.Container
+		if stepTemplates {
+			container = &template.Script.Container
+		}
+		if container.Image != "ghcr.io/openeuler/builder:latest" {
+			t.Errorf("image = %q", container.Image)
+		}
+
+		// workflow 和 job 的 env 覆盖 container.env
+		env := make(map[string]string)
+		for _, v := range container.Env {
+			if _, ok := env[v.Name]; ok {
+				t.Errorf("stepTemplates=%v: env %s is duplicated", stepTemplates, v.Name)
+			}
+			env[v.Name] = v.Value
+		}
+		if env["LEVEL"] != "workflow" || env["CC"] != "gcc" {
+			t.Errorf("stepTemplates=%v: env = %v", stepTemplates, env)
+		}
+
+		if want := []corev1.ContainerPort{{ContainerPort: 8080, Protocol: corev1.ProtocolTCP}}; !reflect.DeepEqual(container.Ports, want) {
+			t.Errorf("ports = %+v, want %+v", container.Ports, want)
+		}
+		wantLimits := corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("2"),
+			corev1.ResourceMemory: resource.MustParse("4Gi"),
+		}
+		if !reflect.DeepEqual(container.Resources.Limits, wantLimits) {
+			t.Errorf("limits = %v, want %v", container.Resources.Limits, wantLimits)
+		}
+		uid, gid, privileged := int64(1000), int64(1000), true
+		wantSecurity := &corev1.SecurityContext{RunAsUser: &uid, RunAsGroup: &gid, Privileged: &privileged}
+		if !reflect.DeepEqual(container.SecurityContext, wantSecurity) {
+			t.Errorf("securityContext = %+v, want %+v", container.SecurityContext, wantSecurity)
+		}
+
+		var mounts []corev1.VolumeMount
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != workspaceVolumeName("build") {
+				mounts = append(mounts, mount)
+			}
+		}
+		wantMounts := []corev1.VolumeMount{
+			{Name: "container-volume-0", MountPath: "/cache"},
+			{Name: "container-volume-1", MountPath: "/var/run/docker.sock", ReadOnly: true},
+			{Name: "container-volume-2", MountPath: "/scratch"},
+			{Name: "dshm", MountPath: "/dev/shm"},
+		}
+		if !reflect.DeepEqual(mounts, wantMounts) {
+			t.Errorf("stepTemplates=%v: volumeMounts = %+v, want %+v", stepTemplates, mounts, wantMounts)
+		}
+		shmSize := resource.MustParse("1Gi")
+		wantVolumes := []corev1.Volume{
+			{Name: "container-volume-0", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			{Name: "container-volume-1", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/run/docker.sock"}}},
+			{Name: "container-volume-2", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			{Name: "dshm", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: &shmSize}}},
+		}
+		if !reflect.DeepEqual(template.Volumes, wantVolumes) {
+			t.Errorf("stepTemplates=%v: volumes = %+v, want %+v", stepTemplates, template.Volumes, wantVolumes)
+		}
+
+		if stepTemplates {
+			// daemon 任务的 pod 只包含服务挂载的卷
+			daemon := findTemplate(t, argoWf, "build-service-redis")
+			wantServiceMounts := []corev1.VolumeMount{{Name: "container-volume-4", MountPath: "/data"}}
+			if !reflect.DeepEqual(daemon.Container.VolumeMounts, wantServiceMounts) {
+				t.Errorf("service volumeMounts = %+v, want %+v", daemon.Container.VolumeMounts, wantServiceMounts)
+			}
+			wantServiceVolumes := []corev1.Volume{{Name: "container-volume-4", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+			if !reflect.DeepEqual(daemon.Volumes, wantServiceVolumes) {
+				t.Errorf("service volumes = %+v, want %+v", daemon.Volumes, wantServiceVolumes)
+			}
+			continue
+		}
+		// 同名的命名卷在 job 容器和服务之间共享
+		wantServiceMounts := []corev1.VolumeMount{{Name: "container-volume-0", MountPath: "/data"}}
+		if len(template.Sidecars) != 1 || !reflect.DeepEqual(template.Sidecars[0].VolumeMounts, wantServiceMounts) {
+			t.Errorf("sidecars = %+v, want volume mounts %+v", template.Sidecars, wantServiceMounts)
+		}
+	}
+}
+
+// TestRunJobContainerErrors 测试无法转换的 container 配置
+func TestRunJobContainerErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		container string
+		wantErr   string
+	}{
+		{"unsupported option", "options: --network host", "option --network is not supported"},
+		{"user name", "options: --user builder", "only numeric uid[:gid] is supported"},
+		{"invalid memory", "options: --memory lots", "invalid --memory"},
+		{"unmapped credentials", "credentials: {username: u, password: p}", "credentials for registry docker.io require an image pull secret mapping"},
+		{"invalid volume", "volumes: ['a:b:c:d']", "invalid volume"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container:
+      image: node:20
+      `+tt.container+`
+    steps:
+      - run: make
+`)
+			_, err := NewConverter(wf).Run()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+const limitsWorkflow = `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    timeout-minutes: 90
+    strategy:
+      fail-fast: false
+      max-parallel: 2
+      matrix:
+        npu: [910a, 910b]
+    steps:
+      - id: lint
+        run: make lint
+        continue-on-error: true
+      - run: make test
+        timeout-minutes: 0.5
+      - if: failure()
+        run: echo failed
+      - run: make package
+        timeout-minutes: 120
+`
+
+// TestRunLimits 测试 timeout-minutes、continue-on-error 和 matrix 的 fail-fast、max-parallel
+func TestRunLimits(t *testing.T) {
+	argoWf, err := NewConverter(readTestWorkflow(t, limitsWorkflow)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	matrix := findTemplate(t, argoWf, "build")
+	if matrix.DAG.FailFast == nil || *matrix.DAG.FailFast {
+		t.Errorf("failFast = %v, want false", matrix.DAG.FailFast)
+	}
+	if matrix.Parallelism == nil || *matrix.Parallelism != 2 {
+		t.Errorf("parallelism = %v, want 2", matrix.Parallelism)
+	}
+
+	// step 设置了 timeout-minutes，job 按 step 生成模板。Argo 的 DAG 模板不支持 timeout，
+	// 每个 step pod 的运行时间上限是 job 剩余的运行时间，由任务在调度时计算
+	job := findTemplate(t, argoWf, "build-0")
+	if job.Timeout != "" {
+		t.Errorf("build-0 timeout = %q, want none on the DAG template", job.Timeout)
+	}
+	for _, name := range []string{"build-0-step-0", "build-0-step-1", "build-0-step-3"} {
+		if got := findTemplate(t, argoWf, name).ActiveDeadlineSeconds; got == nil || got.StrVal != "{{inputs.parameters.deadline}}" {
+			t.Errorf("%s activeDeadlineSeconds = %v, want the deadline parameter", name, got)
+		}
+	}
+
+	// continue-on-error 的 step 失败时与成功一样，不计入 failure()
+	tasks := make(map[string]wfv1.DAGTask)
+	for _, task := range job.DAG.Tasks {
+		tasks[task.Name] = task
+	}
+
+	// 第一个 step 得到 job 的全部运行时间，之后的 step 扣除第一个 step 开始后经过的时间，且不超过自己的超时
+	remaining := "sprig.max(1, 5400 - (now().Unix() - date(tasks['step-0'].startedAt).Unix()))"
+	for name, want := range map[string]string{
+		"step-0": "5400",
+		"step-1": "{{=sprig.min(30, " + remaining + ")}}",
+		"step-3": "{{=sprig.min(7200, " + remaining + ")}}",
+	} {
+		args := tasks[name].Arguments
+		if got := args.GetParameterByName("deadline"); got == nil || got.Value.String() != want {
+			t.Errorf("%s deadline = %v, want %s", name, got, want)
+		}
+	}
+	args := tasks["step-3"].Arguments
+	deadline := args.GetParameterByName("deadline").Value.String()
+	for elapsed, want := range map[time.Duration]string{30 * time.Minute: "3600", 100 * time.Minute: "1"} {
+		got, err := argotemplate.Replace(strconv.Quote(deadline), map[string]string{
+			"tasks.step-0.startedAt": time.Now().Add(-elapsed).UTC().Format(time.RFC3339),
+		}, false)
+		if err != nil || got != strconv.Quote(want) {
+			t.Errorf("step-3 deadline after %s = %s, %v, want %s", elapsed, got, err, want)
+		}
+	}
+	// Argo 不允许在使用 depends 的 DAG 中设置 continueOn，step 的失败只通过之后任务的 depends 容忍
+	if continueOn := tasks["step-0"].ContinueOn; continueOn != nil {
+		t.Errorf("step-0 continueOn = %+v, want none", continueOn)
+	}
+	if _, ok := tasks["step-0-continued"]; ok {
+		t.Errorf("step-0 has later steps and needs no continued task")
+	}
+	if want := "step-0.Succeeded || step-0.Skipped || step-0.Failed"; tasks["step-1"].Depends != want {
+		t.Errorf("step-1 depends = %q, want %q", tasks["step-1"].Depends, want)
+	}
+	if want := "step-0.Errored || step-1.Failed || step-1.Errored"; tasks["step-2"].Depends != want {
+		t.Errorf("step-2 depends = %q, want %q", tasks["step-2"].Depends, want)
+	}
+}
+
+// TestRunValidWorkflow 测试按 step 生成模板的 job 转换后能通过 Argo 的校验
+func TestRunValidWorkflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		workflow string
+	}{
+		{"step conditions", `
+name: conditions
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: make
+      - if: failure()
+        run: echo failed
+`},
+		{"timeouts", `
+name: timeouts
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    timeout-minutes: 90
+    outputs:
+      version: ${{ steps.ver.outputs.version }}
+    steps:
+      - id: ver
+        timeout-minutes: 5
+        run: echo version=1.0 >> $GITHUB_OUTPUT
+      - run: make
+  deploy:
+    needs: build
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: deploy ${{ needs.build.outputs.version }}
+`},
+		{"continue on error", `
+name: continued
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: make lint
+        continue-on-error: true
+      - if: failure()
+        run: echo failed
+      - run: make test
+        timeout-minutes: 10
+        continue-on-error: true
+`},
+		{"job continue on error", `
+name: continued
+on: push
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    container: alpine
+    continue-on-error: true
+    steps:
+      - run: make lint
+  test:
+    runs-on: ubuntu-latest
+    container: alpine
+    strategy:
+      matrix:
+        go: ['1.23', '1.24']
+    continue-on-error: ${{ matrix.go == '1.24' }}
+    steps:
+      - run: make test
+  build:
+    needs: lint
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: make
+`},
+		{"composite timeouts", `
+name: composite
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    timeout-minutes: 30
+    steps:
+      - run: make
+      - uses: ./.github/actions/setup
+        timeout-minutes: 10
+`},
+	}
+	// composite action 内部的 step 由 DAG 模板的 deadline 参数接收剩余的运行时间
+	actions := WithWorkspaceFiles(map[string]string{".github/actions/setup/action.yml": `
+name: setup
+runs:
+  using: composite
+  steps:
+    - run: ./setup.sh
+      shell: bash
+    - run: ./check.sh
+      shell: bash
+`})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argoWf, err := NewConverter(readTestWorkflow(t, tt.workflow), WithSource([]byte(tt.workflow)), actions).Run()
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if err := validateWorkflow(t, argoWf); err != nil {
+				t.Errorf("ValidateWorkflow() error = %v", err)
+			}
+		})
+	}
+}
+
+// TestRunContinueOnErrorLast 测试最后一个 step 设置了 continue-on-error 时由空任务吸收它的失败
+func TestRunContinueOnErrorLast(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    container: alpine
+    steps:
+      - run: make
+      - run: make lint
+        continue-on-error: true
+`)
+	argoWf, err := NewConverter(wf, WithStepTemplates()).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	build := findTemplate(t, argoWf, "build")
+	last := build.DAG.Tasks[len(build.DAG.Tasks)-1]
+	if last.Name != "step-1-continued" || last.Depends != "step-1.Succeeded || step-1.Skipped || step-1.Failed" {
+		t.Errorf("last task = %+v, want step-1-continued after step-1", last)
+	}
+	if suspend := findTemplate(t, argoWf, last.Template).Suspend; suspend == nil || suspend.Duration != "0" {
+		t.Errorf("%s suspend = %+v, want zero duration", last.Template, suspend)
+	}
+}
+
+// TestRunJobContinueOnError 测试 job 级别的 continue-on-error：依赖它的 job 在它失败时仍然执行，
+// 没有 job 依赖它时由空任务吸收它的失败，matrix 的每个组合分别求值
+func TestRunJobContinueOnError(t *testing.T) {
+	source := `
+name: build
+on: push
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    continue-on-error: true
+    steps:
+      - run: make lint
+  test:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        go: ['1.23', '1.24']
+    continue-on-error: ${{ matrix.go == '1.24' }}
+    steps:
+      - run: make test
+  build:
+    needs: lint
+    if: needs.lint.result == 'success'
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+  report:
+    needs: lint
+    if: failure()
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo failed
+  audit:
+    runs-on: ubuntu-latest
+    continue-on-error: true
+    steps:
+      - run: make audit
+`
+	argoWf, err := NewConverter(readTestWorkflow(t, source), WithSource([]byte(source))).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	tasks := make(map[string]wfv1.DAGTask)
+	for _, task := range findTemplate(t, argoWf, argoWf.Spec.Entrypoint).DAG.Tasks {
+		tasks[task.Name] = task
+	}
+	if got, want := tasks["build"].Depends, "lint.Succeeded || lint.Failed"; got != want {
+		t.Errorf("build depends = %q, want %q", got, want)
+	}
+	if got, want := tasks["report"].Depends, "lint.Errored || lint.Omitted"; got != want {
+		t.Errorf("report depends = %q, want %q", got, want)
+	}
+	// lint 被其他 job 依赖，audit 没有，只有 audit 需要空任务
+	if _, ok := tasks["lint-continued"]; ok {
+		t.Errorf("unexpected task lint-continued")
+	}
+	if got, want := tasks["audit-continued"].Depends, "audit.Succeeded || audit.Skipped || audit.Failed"; got != want {
+		t.Errorf("audit-continued depends = %q, want %q", got, want)
+	}
+
+	var names []string
+	for _, task := range findTemplate(t, argoWf, "test").DAG.Tasks {
+		names = append(names, task.Name)
+	}
+	if want := []string{"test-0", "test-1", "test-1-continued"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("matrix tasks = %v, want %v", names, want)
+	}
+}
+
+// TestRunLimitsConcatenated 测试合并为一个脚本的 job 的超时和 continue-on-error
+func TestRunLimitsConcatenated(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make lint
+        continue-on-error: ${{ github.server_url == 'https://github.com' }}
+      - run: make test
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	template := findTemplate(t, argoWf, "build")
+	// 未设置 timeout-minutes 时与 GitHub 一样为 360 分钟
+	if got := template.ActiveDeadlineSeconds; got == nil || got.IntVal != 21600 {
+		t.Errorf("activeDeadlineSeconds = %v, want 21600", got)
+	}
+	want := jobScriptHeader + "\nset +e\n(\nset -e\n__argus_runner_files\ncd /workspace\nmake lint\n)\nset -e\n(\n__argus_runner_files\ncd /workspace\nmake test\n)"
+	if got := template.Container.Args[0]; got != want {
+		t.Errorf("script = %q, want %q", got, want)
+	}
+}
+
+// TestRunLimitsErrors 测试无法在转换时确定或无效的取值
+func TestRunLimitsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     string
+		step    string
+		wantErr string
+	}{
+		{"runtime timeout", "timeout-minutes: ${{ github.event.inputs.timeout }}", "", "must be resolvable at conversion time"},
+		{"invalid timeout", "timeout-minutes: -1", "", `invalid timeout-minutes "-1"`},
+		{"invalid continue-on-error", "", "continue-on-error: ${{ 'maybe' }}", `invalid continue-on-error "maybe"`},
+		{"invalid max-parallel", "strategy: {max-parallel: 0, matrix: {os: [a]}}", "", `invalid max-parallel "0"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    `+tt.job+`
+    steps:
+      - run: make
+        `+tt.step+`
+`)
+			_, err := NewConverter(wf).Run()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestRunConcurrency 测试 workflow 和 job 的 concurrency 组转换为 Argo 的互斥锁
+func TestRunConcurrency(t *testing.T) {
+	source := `
+name: build
+on: push
+concurrency:
+  group: ci-${{ github.ref }}
+  cancel-in-progress: true
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    concurrency: deploy-${{ matrix.env }}
+    strategy:
+      matrix:
+        env: [staging]
+    steps:
+      - run: make deploy
+`
+	wf := readTestWorkflow(t, source)
+	argoWf, err := NewConverter(wf, WithSource([]byte(source)), WithRepository("org/repo")).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	sync := argoWf.Spec.Synchronization
+	if sync == nil || len(sync.Mutexes) != 1 || sync.Mutexes[0].Name != "org/repo/ci-{{workflow.parameters.github-ref}}" {
+		t.Fatalf("workflow synchronization = %+v, want mutex org/repo/ci-{{workflow.parameters.github-ref}}", sync)
+	}
+	if got := argoWf.Annotations[common.ConcurrencyGroupAnnotation]; got != sync.Mutexes[0].Name {
+		t.Errorf("concurrency group annotation = %q, want %q", got, sync.Mutexes[0].Name)
+	}
+	if got := argoWf.Annotations[common.CancelInProgressAnnotation]; got != "true" {
+		t.Errorf("cancel-in-progress annotation = %q, want true", got)
+	}
+
+	// matrix 的每个组合分别求值
+	template := findTemplate(t, argoWf, "deploy-0")
+	if template.Synchronization == nil || len(template.Synchronization.Mutexes) != 1 {
+		t.Fatalf("job synchronization = %+v, want one mutex", template.Synchronization)
+	}
+	if got := template.Synchronization.Mutexes[0].Name; got != "org/repo/deploy-staging" {
+		t.Errorf("job mutex = %q, want org/repo/deploy-staging", got)
+	}
+}
+
+// TestRunConcurrencySemaphore 测试配置为信号量的 concurrency 组
+func TestRunConcurrencySemaphore(t *testing.T) {
+	source := `
+name: build
+on: push
+concurrency: nightly
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`
+	wf := readTestWorkflow(t, source)
+	argoWf, err := NewConverter(wf, WithSource([]byte(source)), WithConcurrencySemaphores("concurrency-limits", []string{"nightly"})).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	sync := argoWf.Spec.Synchronization
+	if sync == nil || len(sync.Semaphores) != 1 || sync.Semaphores[0].ConfigMapKeyRef == nil {
+		t.Fatalf("workflow synchronization = %+v, want one configmap semaphore", sync)
+	}
+	ref := sync.Semaphores[0].ConfigMapKeyRef
+	if ref.Name != "concurrency-limits" || ref.Key != "nightly" {
+		t.Errorf("semaphore = %s/%s, want concurrency-limits/nightly", ref.Name, ref.Key)
+	}
+	if got := argoWf.Annotations[common.CancelInProgressAnnotation]; got != "false" {
+		t.Errorf("cancel-in-progress annotation = %q, want false", got)
+	}
+}
+
+// TestRunConcurrencyErrors 测试无效的 concurrency 配置
+func TestRunConcurrencyErrors(t *testing.T) {
+	source := `
+name: build
+on: push
+concurrency:
+  group: ci
+  cancel-in-progress: ${{ github.event.inputs.cancel }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`
+	wf := readTestWorkflow(t, source)
+	_, err := NewConverter(wf, WithSource([]byte(source))).Run()
+	if err == nil || !strings.Contains(err.Error(), "must be resolvable at conversion time") {
+		t.Errorf("Run() error = %v, want cancel-in-progress resolution error", err)
+	}
+
+	// job 级别的 cancel-in-progress 无法转换
+	source = `
+name: build
+on: push
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    concurrency:
+      group: deploy
+      cancel-in-progress: true
+    steps:
+      - run: make deploy
+`
+	wf = readTestWorkflow(t, source)
+	_, err = NewConverter(wf, WithSource([]byte(source))).Run()
+	if err == nil || !strings.Contains(err.Error(), "cancel-in-progress of job concurrency group deploy is not supported") {
+		t.Errorf("Run() error = %v, want job cancel-in-progress error", err)
+	}
+
+	// CronWorkflow 和 Sensor 创建的 workflow 不经过提交接口，无法取消旧的运行
+	for on, opts := range map[string][]Option{
+		"schedule:\n    - cron: \"0 2 * * *\"": nil,
+		"push":                                 sensorOptions(""),
+	} {
+		source := "name: build\non:\n  " + on + "\nconcurrency:\n  group: ci\n  cancel-in-progress: true\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n"
+		if _, err := ConvertWorkflow([]byte(source), opts...); err == nil || !strings.Contains(err.Error(), "cancel-in-progress of workflow concurrency is only supported") {
+			t.Errorf("ConvertWorkflow() with on.%s error = %v, want cancel-in-progress error", on, err)
+		}
+	}
+}
+
+// TestRunShellDefaults 测试 run step 继承 workflow 和 job 的 defaults.run，使用其他 shell 的 job 按 step 生成模板
+func TestRunShellDefaults(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+defaults:
+  run:
+    shell: bash
+    working-directory: src
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    defaults:
+      run:
+        working-directory: app
+    steps:
+      - run: make
+      - run: print("done")
+        shell: python
+        working-directory: /tmp
+      - run: say hello
+        shell: perl {0}
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	tests := []struct {
+		template   string
+		command    []string
+		workingDir string
+	}{
+		{"build-step-0", []string{"bash", "--noprofile", "--norc", "-eo", "pipefail"}, "/workspace/app"},
+		{"build-step-1", []string{"python"}, "/tmp"},
+		{"build-step-2", []string{"perl"}, "/workspace/app"},
+	}
+	for _, tt := range tests {
+		script := findTemplate(t, argoWf, tt.template).Script
+		if script == nil {
+			t.Fatalf("%s is not a script template", tt.template)
+		}
+		if !reflect.DeepEqual(script.Command, tt.command) {
+			t.Errorf("%s command = %q, want %q", tt.template, script.Command, tt.command)
+		}
+		if script.WorkingDir != tt.workingDir {
+			t.Errorf("%s workingDir = %q, want %q", tt.template, script.WorkingDir, tt.workingDir)
+		}
+	}
+}
+
+// TestRunForeignShellUntrusted 测试 sh 和 bash 之外的 shell 脚本中不可信的取值通过环境变量传入，
+// PR 标题无法跳出脚本中的字符串
+func TestRunForeignShellUntrusted(t *testing.T) {
+	event := EventContext{
+		EventName: "pull_request",
+		Payload: map[string]interface{}{
+			"number":       float64(7),
+			"pull_request": map[string]interface{}{"number": float64(7), "title": `x"); Remove-Item -Recurse / #`},
+		},
+	}
+	wf := readTestWorkflow(t, `
+name: ci
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - shell: pwsh
+        run: Write-Output "title ${{ github.event.pull_request.title }}"
+`)
+	argoWf, err := NewConverter(wf, WithEventContext(event)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	script := findTemplate(t, argoWf, "build-step-0").Script
+	if want := `Write-Output "title ${env:ARGUS_EXPR_0}"`; script.Source != want {
+		t.Errorf("build-step-0 source = %q, want %q", script.Source, want)
+	}
+	want := corev1.EnvVar{Name: "ARGUS_EXPR_0", Value: `x"); Remove-Item -Recurse / #`}
+	found := false
+	for _, v := range script.Env {
+		found = found || reflect.DeepEqual(v, want)
+	}
+	if !found {
+		t.Errorf("build-step-0 env = %+v, want %+v", script.Env, want)
+	}
+
+	// python 和自定义 shell 没有在字符串中安全读取环境变量的写法，拒绝不可信的取值
+	for _, shell := range []string{"python", "perl {0}"} {
+		wf := readTestWorkflow(t, `
+name: ci
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: print("${{ github.event.pull_request.title }}")
+        shell: `+shell+`
+`)
+		_, err := NewConverter(wf, WithEventContext(event)).Run()
+		if err == nil || !strings.Contains(err.Error(), "untrusted contexts cannot be used in "+shell+" scripts") {
+			t.Errorf("Run() with shell %s error = %v, want untrusted context error", shell, err)
+		}
+	}
+}
+
+// TestStepShellCommand 测试内置 shell 按 GitHub 的模板执行脚本
+func TestStepShellCommand(t *testing.T) {
+	tests := []struct {
+		shell   string
+		command []string
+		posix   bool
+	}{
+		{"", []string{"sh", "-c", `if command -v bash >/dev/null 2>&1; then exec bash -e "$0"; fi; exec sh -e "$0"`}, true},
+		{"sh", []string{"sh", "-e"}, true},
+		{"bash", []string{"bash", "--noprofile", "--norc", "-eo", "pipefail"}, true},
+		{"python", []string{"python"}, false},
+		{"pwsh", []string{"sh", "-c", `script="$(mktemp -d)/script.ps1" && cp "$0" "$script" && exec pwsh -command ". '$script'"`}, false},
+		{"powershell", []string{"sh", "-c", `script="$(mktemp -d)/script.ps1" && cp "$0" "$script" && exec powershell -command ". '$script'"`}, false},
+		{"perl {0}", []string{"perl"}, false},
+		{"/bin/bash -x {0}", []string{"/bin/bash", "-x"}, true},
+	}
+	for _, tt := range tests {
+		command, posix, err := stepShellCommand(tt.shell)
+		if err != nil {
+			t.Errorf("stepShellCommand(%q) error = %v", tt.shell, err)
+			continue
+		}
+		if !reflect.DeepEqual(command, tt.command) || posix != tt.posix {
+			t.Errorf("stepShellCommand(%q) = %q, %v, want %q, %v", tt.shell, command, posix, tt.command, tt.posix)
+		}
+	}
+
+	for shell, want := range map[string]string{
+		"cmd":         "requires a Windows runner",
+		"perl {0} -w": "{0} must be the last argument",
+		"   ":         "is not supported",
+	} {
+		if _, _, err := stepShellCommand(shell); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("stepShellCommand(%q) error = %v, want to contain %q", shell, err, want)
+		}
+	}
+}
+
+// TestRunWorkingDirectoryConcatenated 测试 job 脚本中的 step 在各自的工作目录中执行
+func TestRunWorkingDirectoryConcatenated(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: build
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    defaults:
+      run:
+        shell: sh
+        working-directory: src
+    steps:
+      - run: make
+      - run: ls
+        working-directory: ${{ github.event.inputs.dir }}
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	container := findTemplate(t, argoWf, "build").Container
+	want := strings.Join([]string{
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		`cd "src"`,
+		"make",
+		")",
+		"(",
+		"__argus_runner_files",
+		"cd /workspace",
+		`cd "${ARGUS_EXPR_0}"`,
+		"ls",
+		")",
+	}, "\n")
+	if !strings.HasSuffix(container.Args[0], want) {
+		t.Errorf("script = %s\nwant suffix %s", container.Args[0], want)
+	}
+}
+
+// reusableWorkflows 包含一个本地 reusable workflow 和一个远程 reusable workflow
+var reusableWorkflows = fstest.MapFS{
+	".github/workflows/build.yml": {Data: []byte(`
+name: build
+on:
+  workflow_call:
+    inputs:
+      tag:
+        type: string
+        required: true
+      push:
+        type: boolean
+        default: false
+      registry:
+        type: string
+        default: docker.io
+    outputs:
+      image:
+        value: ${{ jobs.image.outputs.name }}
+jobs:
+  image:
+    if: inputs.push
+    runs-on: ubuntu-latest
+    outputs:
+      name: ${{ steps.build.outputs.name }}
+    steps:
+      - id: build
+        run: echo "name=${{ inputs.registry }}/app:${{ inputs.tag }}" >> $GITHUB_OUTPUT
+        env:
+          TOKEN: ${{ secrets.REGISTRY_TOKEN }}
+`)},
+	"openeuler/infra@v1/.github/workflows/deploy.yml": {Data: []byte(`
+name: deploy
+on:
+  workflow_call:
+    inputs:
+      image:
+        type: string
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    env:
+      TOKEN: ${{ secrets.token }}
+      OTHER: ${{ secrets.OTHER }}
+    steps:
+      - run: deploy ${{ inputs.image }}
+`)},
+}
+
+// TestRunReusableWorkflow 测试调用 reusable workflow 的 job 展开为嵌套 DAG，with、secrets 和 outputs 跨调用传递
+func TestRunReusableWorkflow(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: ci
+on: push
+jobs:
+  version:
+    runs-on: ubuntu-latest
+    outputs:
+      tag: ${{ steps.v.outputs.tag }}
+    steps:
+      - id: v
+        run: echo "tag=1.0" >> $GITHUB_OUTPUT
+  build:
+    needs: version
+    uses: ./.github/workflows/build.yml
+    with:
+      tag: ${{ needs.version.outputs.tag }}
+      push: true
+    secrets: inherit
+  deploy:
+    needs: build
+    uses: openeuler/infra/.github/workflows/deploy.yml@v1
+    with:
+      image: ${{ needs.build.outputs.image }}
+    secrets:
+      token: ${{ secrets.DEPLOY_TOKEN }}
+`)
+	argoWf, err := NewConverter(wf,
+		WithWorkspace(reusableWorkflows),
+		WithActionSource(reusableWorkflows),
+		WithRepository("openeuler/app"),
+		WithSecretMapping(map[string]string{"openeuler": "openeuler-secrets"}),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// 上游 job 的输出经嵌套 DAG 转发给被调用 workflow 的 job
+	build := findTemplate(t, argoWf, "build")
+	if build.DAG == nil || len(build.DAG.Tasks) != 1 {
+		t.Fatalf("build template = %+v, want DAG with one task", build)
+	}
+	task := build.DAG.Tasks[0]
+	if task.Name != "image" || task.Template != "build-image" {
+		t.Errorf("build task = %s -> %s, want image -> build-image", task.Name, task.Template)
+	}
+	wantArgs := []wfv1.Parameter{{Name: "needs-version-outputs-tag", Value: wfv1.AnyStringPtr("{{inputs.parameters.needs-version-outputs-tag}}")}}
+	if !reflect.DeepEqual(task.Arguments.Parameters, wantArgs) {
+		t.Errorf("image arguments = %+v, want %+v", task.Arguments.Parameters, wantArgs)
+	}
+	wantOutputs := []wfv1.Parameter{{Name: "image", ValueFrom: &wfv1.ValueFrom{Parameter: "{{tasks.image.outputs.parameters.name}}"}}}
+	if !reflect.DeepEqual(build.Outputs.Parameters, wantOutputs) {
+		t.Errorf("build outputs = %+v, want %+v", build.Outputs.Parameters, wantOutputs)
+	}
+
+	// with 的取值和输入的默认值作为 inputs 上下文，inherit 使用调用方的 secrets
+	image := findTemplate(t, argoWf, "build-image").Container
+	want := `echo "name=${ARGUS_EXPR_1}/app:${ARGUS_EXPR_2}" >> $GITHUB_OUTPUT`
+	if !strings.Contains(image.Args[0], want) {
+		t.Errorf("build-image script = %s, want %s", image.Args[0], want)
+	}
+	wantEnv := []corev1.EnvVar{
+		{Name: "ARGUS_EXPR_0", ValueFrom: secretValue{Secret: "openeuler-secrets", Key: "REGISTRY_TOKEN"}.keyRef()},
+		{Name: "ARGUS_EXPR_1", Value: "docker.io"},
+		{Name: "ARGUS_EXPR_2", Value: "{{inputs.parameters.needs-version-outputs-tag}}"},
+	}
+	if !reflect.DeepEqual(image.Env, wantEnv) {
+		t.Errorf("build-image env = %+v, want %+v", image.Env, wantEnv)
+	}
+
+	// 显式传入的 secrets 按名称映射，未传入的 secret 为空
+	deploy := findTemplate(t, argoWf, "deploy-deploy").Container
+	for _, want := range []corev1.EnvVar{
+		{Name: "OTHER", Value: ""},
+		{Name: "TOKEN", ValueFrom: secretValue{Secret: "openeuler-secrets", Key: "DEPLOY_TOKEN"}.keyRef()},
+		{Name: "ARGUS_EXPR_0", Value: "{{inputs.parameters.needs-build-outputs-image}}"},
+	} {
+		if !containsEnvVar(deploy.Env, want) {
+			t.Errorf("deploy-deploy env = %+v, want %+v", deploy.Env, want)
+		}
+	}
+	main := findTemplate(t, argoWf, "main")
+	for _, task := range main.DAG.Tasks {
+		if task.Name == "deploy" && (len(task.Arguments.Parameters) != 1 || task.Arguments.Parameters[0].Value.String() != "{{tasks.build.outputs.parameters.image}}") {
+			t.Errorf("deploy arguments = %+v, want build image output", task.Arguments.Parameters)
+		}
+	}
+}
+
+// containsEnvVar 判断 env 中是否包含 want
+func containsEnvVar(env []corev1.EnvVar, want corev1.EnvVar) bool {
+	for _, v := range env {
+		if reflect.DeepEqual(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRunReusableWorkflowErrors 测试无法展开的 reusable workflow 调用
+func TestRunReusableWorkflowErrors(t *testing.T) {
+	source := fstest.MapFS{
+		".github/workflows/build.yml": reusableWorkflows[".github/workflows/build.yml"],
+		".github/workflows/push.yml":  {Data: []byte("on: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n")},
+	}
+	tests := []struct {
+		name    string
+		job     string
+		wantErr string
+	}{
+		{"missing required input", "uses: ./.github/workflows/build.yml", "input tag is required"},
+		{"unknown input", "uses: ./.github/workflows/build.yml\n    with: {tag: v1, arch: arm64}", "input arch is not defined"},
+		{"invalid boolean", "uses: ./.github/workflows/build.yml\n    with: {tag: v1, push: maybe}", "maybe is not a boolean"},
+		{"not callable", "uses: ./.github/workflows/push.yml", "not triggered by workflow_call"},
+		{"not found", "uses: ./.github/workflows/missing.yml", "reusable workflow ./.github/workflows/missing.yml is not found in the repository files"},
+		{"no source", "uses: openeuler/infra/.github/workflows/deploy.yml@v1", "no action source is configured"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wf := readTestWorkflow(t, `
+name: ci
+on: push
+jobs:
+  build:
+    `+tt.job+`
+`)
+			_, err := NewConverter(wf, WithWorkspace(source)).Run()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// 没有提供仓库文件时本地 reusable workflow 无法读取
+	wf := readTestWorkflow(t, "name: ci\non: push\njobs:\n  build:\n    uses: ./.github/workflows/build.yml\n    with: {tag: v1}\n")
+	want := "local reusable workflow ./.github/workflows/build.yml is not available, the repository files are not provided"
+	if _, err := NewConverter(wf).Run(); err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Run() error = %v, want %q", err, want)
+	}
+}
+
+// TestRunTemplate 测试由 workflow_call 触发的 workflow 转换为 WorkflowTemplate
+func TestRunTemplate(t *testing.T) {
+	wf := readTestWorkflow(t, string(reusableWorkflows[".github/workflows/build.yml"].Data))
+	tmpl, err := NewConverter(wf, WithRepository("openeuler/infra"), WithSecretMapping(map[string]string{"openeuler": "openeuler-secrets"})).RunTemplate()
+	if err != nil {
+		t.Fatalf("RunTemplate() error = %v", err)
+	}
+	if tmpl.Kind != "WorkflowTemplate" || tmpl.Name != "build" || tmpl.Spec.Entrypoint != "main" {
+		t.Errorf("template = %s/%s entrypoint %s, want WorkflowTemplate/build entrypoint main", tmpl.Kind, tmpl.Name, tmpl.Spec.Entrypoint)
+	}
+
+	// 必需的输入没有默认值，boolean 输入只能取 true 或 false
+	wantParams := []wfv1.Parameter{
+		{Name: "push", Value: wfv1.AnyStringPtr("false"), Enum: []wfv1.AnyString{"true", "false"}},
+		{Name: "registry", Value: wfv1.AnyStringPtr("docker.io")},
+		{Name: "tag"},
+	}
+	if !reflect.DeepEqual(tmpl.Spec.Arguments.Parameters, wantParams) {
+		t.Errorf("parameters = %+v, want %+v", tmpl.Spec.Arguments.Parameters, wantParams)
+	}
+
+	var main *wfv1.Template
+	for i := range tmpl.Spec.Templates {
+		if tmpl.Spec.Templates[i].Name == "main" {
+			main = &tmpl.Spec.Templates[i]
+		}
+	}
+	wantOutputs := []wfv1.Parameter{{Name: "image", ValueFrom: &wfv1.ValueFrom{Parameter: "{{tasks.image.outputs.parameters.name}}"}}}
+	if main == nil || !reflect.DeepEqual(main.Outputs.Parameters, wantOutputs) {
+		t.Fatalf("main template = %+v, want outputs %+v", main, wantOutputs)
+	}
+
+	// 输入同时是入口模板的输入参数，由 DAG 任务传给引用它们的模板，模板中不再引用 workflow 参数
+	wantInputs := []wfv1.Parameter{{Name: "push"}, {Name: "registry"}, {Name: "tag"}}
+	if !reflect.DeepEqual(main.Inputs.Parameters, wantInputs) {
+		t.Errorf("main inputs = %+v, want %+v", main.Inputs.Parameters, wantInputs)
+	}
+	task := main.DAG.Tasks[0]
+	wantArgs := []wfv1.Parameter{
+		{Name: "registry", Value: wfv1.AnyStringPtr("{{inputs.parameters.registry}}")},
+		{Name: "tag", Value: wfv1.AnyStringPtr("{{inputs.parameters.tag}}")},
+	}
+	if !reflect.DeepEqual(task.Arguments.Parameters, wantArgs) {
+		t.Errorf("image task arguments = %+v, want %+v", task.Arguments.Parameters, wantArgs)
+	}
+	if !strings.Contains(task.When, "inputs.parameters.push") || strings.Contains(task.When, "workflow.parameters") {
+		t.Errorf("image task when = %q, want to reference inputs.parameters.push", task.When)
+	}
+	image := findTemplate(t, &wfv1.Workflow{Spec: tmpl.Spec}, "image")
+	if !reflect.DeepEqual(image.Inputs.Parameters, []wfv1.Parameter{{Name: "registry"}, {Name: "tag"}}) {
+		t.Errorf("image inputs = %+v, want registry and tag", image.Inputs.Parameters)
+	}
+	for _, env := range image.Container.Env {
+		if strings.Contains(env.Value, "workflow.parameters.registry") || strings.Contains(env.Value, "workflow.parameters.tag") {
+			t.Errorf("image env %s = %q, want input parameter references", env.Name, env.Value)
+		}
+	}
+
+	if _, err := NewConverter(readTestWorkflow(t, compositeWorkflow)).RunTemplate(); err == nil || !strings.Contains(err.Error(), "not triggered by workflow_call") {
+		t.Errorf("RunTemplate() error = %v, want workflow_call error", err)
+	}
+}
+
+// TestRunCronWorkflow 测试 on.schedule 转换为按 UTC 调度的 CronWorkflow
+func TestRunCronWorkflow(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: Nightly Build
+on:
+  schedule:
+    - cron: "0 2 * * *"
+    - cron: "30 4 * * MON-FRI"
+  push:
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ github.event_name }}
+`)
+	cronWf, err := NewConverter(wf).RunCronWorkflow()
+	if err != nil {
+		t.Fatalf("RunCronWorkflow() error = %v", err)
+	}
+	if cronWf.Kind != "CronWorkflow" || cronWf.Name != "nightly-build" {
+		t.Errorf("cron workflow = %s/%s, want CronWorkflow/nightly-build", cronWf.Kind, cronWf.Name)
+	}
+	if want := []string{"0 2 * * *", "30 4 * * MON-FRI"}; !reflect.DeepEqual(cronWf.Spec.Schedules, want) {
+		t.Errorf("schedules = %v, want %v", cronWf.Spec.Schedules, want)
+	}
+	if cronWf.Spec.Timezone != "UTC" {
+		t.Errorf("timezone = %q, want UTC", cronWf.Spec.Timezone)
+	}
+	wantParams := []wfv1.Parameter{{Name: "github-event_name", Value: wfv1.AnyStringPtr("schedule")}}
+	if !reflect.DeepEqual(cronWf.Spec.WorkflowSpec.Arguments.Parameters, wantParams) {
+		t.Errorf("parameters = %+v, want %+v", cronWf.Spec.WorkflowSpec.Arguments.Parameters, wantParams)
+	}
+}
+
+// TestRunCronWorkflowErrors 测试不符合 GitHub 语法的 cron 表达式
+func TestRunCronWorkflowErrors(t *testing.T) {
+	tests := []struct {
+		cron    string
+		wantErr string
+	}{
+		{"@daily", "a schedule must have five fields"},
+		{"0 0 * * * *", "a schedule must have five fields"},
+		{"61 * * * *", "invalid cron"},
+		{"0 0 * JANUARY *", "invalid cron"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cron, func(t *testing.T) {
+			wf := readTestWorkflow(t, `
+name: nightly
+on:
+  schedule:
+    - cron: "`+tt.cron+`"
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+			_, err := NewConverter(wf).RunCronWorkflow()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RunCronWorkflow() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestFilterPattern 测试 GitHub 过滤模式与正则表达式的匹配结果
+func TestFilterPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"main", "main", true},
+		{"main", "main2", false},
+		{"releases/*", "releases/v1", true},
+		{"releases/*", "releases/v1/beta", false},
+		{"releases/**", "releases/v1/beta", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "pkg/converter/filter.go", true},
+		{"docs/**/*.md", "docs/README.md", true},
+		{"v[12].*", "v1.0", true},
+		{"v[12].*", "v3.0", false},
+		{"v1.?", "v1", true},
+		{"feature-+", "feature--", true},
+		{`\*.txt`, "*.txt", true},
+		{`\*.txt`, "a.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.value, func(t *testing.T) {
+			re, err := filterPattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("filterPattern() error = %v", err)
+			}
+			if got := regexp.MustCompile("^" + re + "$").MatchString(tt.value); got != tt.want {
+				t.Errorf("%s (%s) matches %s = %v, want %v", tt.pattern, re, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// testWebhookSecret 是测试使用的 GitHub webhook 密钥
+var testWebhookSecret = corev1.SecretKeySelector{
+	LocalObjectReference: corev1.LocalObjectReference{Name: "github-webhook"},
+	Key:                  "secret",
+}
+
+// testRepositoryFilter 是只接受 openeuler/infra 事件的过滤器
+var testRepositoryFilter = DataFilter{Path: "body.repository.full_name", Type: "string", Value: []string{`(?i)^openeuler/infra$`}}
+
+// sensorOptions 返回生成 Sensor 需要的仓库和 webhook 密钥，serviceAccount 是 Sensor 的 ServiceAccount
+func sensorOptions(serviceAccount string) []Option {
+	return []Option{WithRepository("openeuler/infra"), WithEventSensor(serviceAccount, testWebhookSecret)}
+}
+
+// TestRunSensor 测试将 push 和 pull_request 的过滤条件转换为 Sensor 的数据过滤器和触发器
+func TestRunSensor(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: CI Build
+on:
+  push:
+    branches: [main, "releases/**"]
+    paths: ["src/**"]
+  pull_request:
+    types: [opened, labeled]
+    branches-ignore: ["wip/*"]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ github.event_name }} ${{ github.ref }} ${{ github.event.pull_request.number }}
+`)
+	sensor, eventSource, err := NewConverter(wf, sensorOptions("argo-events")...).RunSensor()
+	if err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	if sensor.Kind != "Sensor" || sensor.Name != "ci-build" {
+		t.Errorf("sensor = %s/%s, want Sensor/ci-build", sensor.Kind, sensor.Name)
+	}
+	if sensor.Spec.Template == nil || sensor.Spec.Template.ServiceAccountName != "argo-events" {
+		t.Errorf("sensor template = %+v, want service account argo-events", sensor.Spec.Template)
+	}
+	github, ok := eventSource.Spec.Github["ci-build"]
+	if !ok || github.Webhook.Endpoint != "/ci-build" || github.Webhook.Method != "POST" {
+		t.Errorf("github event source = %+v, want POST /ci-build", eventSource.Spec.Github)
+	}
+	if !reflect.DeepEqual(github.WebhookSecret, &testWebhookSecret) || !reflect.DeepEqual(github.Events, []string{"push", "pull_request"}) ||
+		!reflect.DeepEqual(github.Repositories, []OwnedRepositories{{Owner: "openeuler", Names: []string{"infra"}}}) {
+		t.Errorf("github event source = %+v, want openeuler/infra push and pull_request signed with %+v", github, testWebhookSecret)
+	}
+
+	wantFilters := map[string][]DataFilter{
+		"push": {
+			{Path: "headers.X-Github-Event.0", Type: "string", Value: []string{"^push$"}},
+			testRepositoryFilter,
+			{Path: "body.ref", Type: "string", Value: []string{`^refs/heads/main$`, `^refs/heads/releases/.*$`}},
+			{Path: commitFilesPath, Type: "string", Value: []string{`"src/[^"]*"`}},
+		},
+		"pull_request": {
+			{Path: "headers.X-Github-Event.0", Type: "string", Value: []string{"^pull_request$"}},
+			testRepositoryFilter,
+			{Path: "body.action", Type: "string", Value: []string{"^opened$", "^labeled$"}},
+			{Path: "body.pull_request.base.ref", Type: "string", Value: []string{"^.*$"}},
+			{Path: "body.pull_request.base.ref", Type: "string", Value: []string{"^wip/[^/]*$"}, Comparator: "!="},
+		},
+	}
+	if len(sensor.Spec.Dependencies) != 2 || len(sensor.Spec.Triggers) != 2 {
+		t.Fatalf("sensor has %d dependencies and %d triggers, want 2 each", len(sensor.Spec.Dependencies), len(sensor.Spec.Triggers))
+	}
+	for i, dep := range sensor.Spec.Dependencies {
+		if dep.EventSourceName != "ci-build" || dep.EventName != "ci-build" {
+			t.Errorf("dependency %s event = %s/%s, want ci-build/ci-build", dep.Name, dep.EventSourceName, dep.EventName)
+		}
+		if !reflect.DeepEqual(dep.Filters.Data, wantFilters[dep.Name]) {
+			t.Errorf("dependency %s filters = %+v, want %+v", dep.Name, dep.Filters.Data, wantFilters[dep.Name])
+		}
+
+		trigger := sensor.Spec.Triggers[i].Template
+		if trigger.Conditions != dep.Name || trigger.ArgoWorkflow.Operation != "submit" {
+			t.Errorf("trigger = %+v, want submit on %s", trigger, dep.Name)
+		}
+		resource := trigger.ArgoWorkflow.Source.Resource
+		params := resource.Spec.Arguments.Parameters
+		for j, param := range params {
+			if param.Name == "github-event_name" && param.Value.String() != dep.Name {
+				t.Errorf("trigger %s github-event_name = %s", dep.Name, param.Value)
+			}
+			if param.Name == "github-event-pull_request-number" {
+				want := TriggerParameter{
+					Src:  &TriggerParameterSource{DependencyName: dep.Name, DataKey: "body.pull_request.number", Value: new(string)},
+					Dest: fmt.Sprintf("spec.arguments.parameters.%d.value", j),
+				}
+				if !containsTriggerParameter(trigger.ArgoWorkflow.Parameters, want) {
+					t.Errorf("trigger %s parameters = %+v, want %+v", dep.Name, trigger.ArgoWorkflow.Parameters, want)
+				}
+			}
+		}
+	}
+
+	ref := sensor.Spec.Triggers[1].Template.ArgoWorkflow.Parameters[1].Src
+	if ref.DataTemplate != "refs/pull/{{ .Input.body.number }}/merge" {
+		t.Errorf("pull_request github-ref = %+v, want merge ref", ref)
+	}
+}
+
+// TestRunSensorUnsupportedFilters 测试无法表达为事件过滤器的条件返回错误，而不是被忽略后在 GitHub 不触发时触发
+func TestRunSensorUnsupportedFilters(t *testing.T) {
+	tests := []struct {
+		on   string
+		want string
+	}{
+		{"push:\n    paths-ignore: [\"docs/**\"]", "on.push.paths-ignore is not supported with Sensor generation, the Sensor cannot express it, evaluate the trigger with /api/v1/trigger"},
+		{"push:\n    paths: [\"src/**\", \"!src/docs/**\"]", "negative pattern !src/docs/** of on.push.paths is not supported with Sensor generation, the Sensor cannot express it"},
+		{"push:\n    paths: [\"src/[z-a]\"]", "invalid filter pattern"},
+		{"push:\n    branches: [\"releases/**\", \"!releases/*-rc\", \"releases/v1-rc\"]", "pattern releases/v1-rc after negative pattern !releases/*-rc"},
+		{"pull_request:\n    paths: [\"src/**\"]", "paths filters of on.pull_request"},
+		{"pull_request:\n    paths-ignore: [\"docs/**\"]", "paths filters of on.pull_request"},
+	}
+	for _, tt := range tests {
+		wf := readTestWorkflow(t, "name: ci\non:\n  "+tt.on+"\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n")
+		if _, _, err := NewConverter(wf, sensorOptions("")...).RunSensor(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("RunSensor() with on.%s error = %v, want to contain %q", tt.on, err, tt.want)
+		}
+	}
+}
+
+// TestRunSensorPullRequestSHA 测试 pull_request 的 github.sha 与 EventContext 一样使用合并提交
+func TestRunSensorPullRequestSHA(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: ci
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ github.sha }}
+`)
+	sensor, _, err := NewConverter(wf, sensorOptions("")...).RunSensor()
+	if err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	params := sensor.Spec.Triggers[0].Template.ArgoWorkflow.Parameters
+	if len(params) != 1 || !strings.Contains(params[0].Src.DataTemplate, "merge_commit_sha") {
+		t.Errorf("github-sha parameters = %+v, want merge commit", params)
+	}
+}
+
+// containsTriggerParameter 判断触发器参数中是否有 want
+func containsTriggerParameter(params []TriggerParameter, want TriggerParameter) bool {
+	for _, param := range params {
+		if reflect.DeepEqual(param, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestRunSensorRefs 测试只设置 branches 或 tags 之一时另一类引用不会触发
+func TestRunSensorRefs(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: release
+on:
+  push:
+    tags: ["v*", "!v*-rc*"]
+    branches-ignore: [gh-pages]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	sensor, _, err := NewConverter(wf, sensorOptions("")...).RunSensor()
+	if err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	want := []DataFilter{
+		{Path: "headers.X-Github-Event.0", Type: "string", Value: []string{"^push$"}},
+		testRepositoryFilter,
+		{Path: "body.ref", Type: "string", Value: []string{"^refs/heads/gh-pages$"}, Comparator: "!="},
+		{Path: "body.ref", Type: "string", Value: []string{"^refs/tags/v[^/]*-rc[^/]*$"}, Comparator: "!="},
+		{Path: "body.ref", Type: "string", Value: []string{"^refs/heads/.*$", "^refs/tags/v[^/]*$"}},
+	}
+	if got := sensor.Spec.Dependencies[0].Filters.Data; !reflect.DeepEqual(got, want) {
+		t.Errorf("filters = %+v, want %+v", got, want)
+	}
+	if sensor.Spec.Template != nil {
+		t.Errorf("sensor template = %+v, want nil", sensor.Spec.Template)
+	}
+
+	wf = readTestWorkflow(t, `
+name: nightly
+on:
+  schedule:
+    - cron: "0 2 * * *"
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	if _, _, err := NewConverter(wf, sensorOptions("")...).RunSensor(); err == nil || !strings.Contains(err.Error(), "not triggered by push or pull_request") {
+		t.Errorf("RunSensor() error = %v, want not triggered", err)
+	}
+}
+
+// TestRunSensorTagPaths 测试与 GitHub 一样推送标签时不检查 paths，标签的 push 由单独的依赖和触发器处理
+func TestRunSensorTagPaths(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: release
+on:
+  push:
+    branches: [main]
+    tags: ["v*"]
+    paths: ["src/**"]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: echo ${{ github.ref }}
+`)
+	sensor, _, err := NewConverter(wf, sensorOptions("")...).RunSensor()
+	if err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	event := DataFilter{Path: "headers.X-Github-Event.0", Type: "string", Value: []string{"^push$"}}
+	want := map[string][]DataFilter{
+		"push": {
+			event,
+			testRepositoryFilter,
+			{Path: "body.ref", Type: "string", Value: []string{"^refs/heads/main$"}},
+			{Path: commitFilesPath, Type: "string", Value: []string{`"src/[^"]*"`}},
+		},
+		"push-tags": {
+			event,
+			testRepositoryFilter,
+			{Path: "body.ref", Type: "string", Value: []string{"^refs/tags/v[^/]*$"}},
+		},
+	}
+	if len(sensor.Spec.Dependencies) != 2 || len(sensor.Spec.Triggers) != 2 {
+		t.Fatalf("sensor has %d dependencies and %d triggers, want 2 each", len(sensor.Spec.Dependencies), len(sensor.Spec.Triggers))
+	}
+	for i, dep := range sensor.Spec.Dependencies {
+		if !reflect.DeepEqual(dep.Filters.Data, want[dep.Name]) {
+			t.Errorf("dependency %s filters = %+v, want %+v", dep.Name, dep.Filters.Data, want[dep.Name])
+		}
+		trigger := sensor.Spec.Triggers[i].Template
+		if trigger.Conditions != dep.Name {
+			t.Errorf("trigger conditions = %s, want %s", trigger.Conditions, dep.Name)
+		}
+		for _, param := range trigger.ArgoWorkflow.Parameters {
+			if param.Src.DependencyName != dep.Name {
+				t.Errorf("trigger %s parameter dependency = %s", dep.Name, param.Src.DependencyName)
+			}
+		}
+	}
+
+	// 只设置了 branches 时标签的 push 不触发，不需要标签的依赖
+	wf = readTestWorkflow(t, "name: ci\non:\n  push:\n    branches: [main]\n    paths: [\"src/**\"]\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n")
+	if sensor, _, err = NewConverter(wf, sensorOptions("")...).RunSensor(); err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	if len(sensor.Spec.Dependencies) != 1 || sensor.Spec.Dependencies[0].Name != "push" {
+		t.Errorf("dependencies = %+v, want push only", sensor.Spec.Dependencies)
+	}
+}
+
+// TestRunSensorRepository 测试 Sensor 只接受 workflow 所属仓库签名正确的事件，使用 secrets 时不接受 fork 的 PR
+func TestRunSensorRepository(t *testing.T) {
+	source := "name: ci\non: pull_request\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n"
+	wf := readTestWorkflow(t, source)
+	if _, _, err := NewConverter(wf, WithRepository("openeuler/infra"), WithEventSensor("", corev1.SecretKeySelector{})).RunSensor(); err == nil ||
+		!strings.Contains(err.Error(), "webhook secret of the EventSource is not configured") {
+		t.Errorf("RunSensor() without webhook secret error = %v, want webhook secret error", err)
+	}
+	if _, _, err := NewConverter(wf, WithEventSensor("", testWebhookSecret)).RunSensor(); err == nil ||
+		!strings.Contains(err.Error(), "the repository of workflow ci is unknown") {
+		t.Errorf("RunSensor() without repository error = %v, want repository error", err)
+	}
+
+	// 仓库名不区分大小写，其他仓库和同名的 fork 不匹配
+	re := regexp.MustCompile(testRepositoryFilter.Value[0])
+	for name, want := range map[string]bool{"openeuler/infra": true, "OpenEuler/Infra": true, "attacker/infra": false, "openeuler/infra-fork": false} {
+		if re.MatchString(name) != want {
+			t.Errorf("repository filter matches %s = %v, want %v", name, !want, want)
+		}
+	}
+
+	// 没有 secrets 时 fork 的 PR 可以触发
+	sensor, _, err := NewConverter(wf, sensorOptions("")...).RunSensor()
+	if err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	for _, filter := range sensor.Spec.Dependencies[0].Filters.Data {
+		if filter.Path == headRepositoryPath {
+			t.Errorf("filters = %+v, want no head repository filter without secrets", sensor.Spec.Dependencies[0].Filters.Data)
+		}
+	}
+
+	wf = readTestWorkflow(t, strings.Replace(source, "- run: make", "- run: make\n        env:\n          TOKEN: ${{ secrets.DEPLOY_TOKEN }}", 1))
+	opts := append(sensorOptions(""), WithSecretMapping(map[string]string{"openeuler": "openeuler-secrets"}))
+	if sensor, _, err = NewConverter(wf, opts...).RunSensor(); err != nil {
+		t.Fatalf("RunSensor() error = %v", err)
+	}
+	want := DataFilter{Path: headRepositoryPath, Type: "string", Value: testRepositoryFilter.Value}
+	if filters := sensor.Spec.Dependencies[0].Filters.Data; !reflect.DeepEqual(filters[len(filters)-1], want) {
+		t.Errorf("filters = %+v, want fork pull requests refused with %+v", filters, want)
+	}
+}
+
+// TestConvertWorkflow 测试生成的资源按 Kubernetes 字段名序列化为以 --- 分隔的 YAML 文档
+func TestConvertWorkflow(t *testing.T) {
+	data := []byte(`
+name: CI Build
+on:
+  schedule:
+    - cron: "0 2 * * *"
+  push:
+    branches: [main]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	output, err := ConvertWorkflow(data, sensorOptions("argo-events")...)
+	if err != nil {
+		t.Fatalf("ConvertWorkflow() error = %v", err)
+	}
+	documents := strings.Split(output, "---\n")
+	var kinds []string
+	for _, document := range documents {
+		var meta struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		}
+		if err := k8syaml.Unmarshal([]byte(document), &meta); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		kinds = append(kinds, meta.APIVersion+"/"+meta.Kind)
+	}
+	want := []string{"argoproj.io/v1alpha1/Workflow", "argoproj.io/v1alpha1/CronWorkflow", "argoproj.io/v1alpha1/Sensor", "argoproj.io/v1alpha1/EventSource"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("kinds = %v, want %v", kinds, want)
+	}
+
+	var argoWf wfv1.Workflow
+	if err := k8syaml.UnmarshalStrict([]byte(documents[0]), &argoWf); err != nil {
+		t.Fatalf("UnmarshalStrict() error = %v", err)
+	}
+	if argoWf.Spec.Entrypoint != "main" || len(argoWf.Spec.Templates) == 0 {
+		t.Errorf("workflow spec = %+v, want templates with entrypoint main", argoWf.Spec)
+	}
+	var cronWf wfv1.CronWorkflow
+	if err := k8syaml.UnmarshalStrict([]byte(documents[1]), &cronWf); err != nil {
+		t.Fatalf("UnmarshalStrict() error = %v", err)
+	}
+	if !reflect.DeepEqual(cronWf.Spec.Schedules, []string{"0 2 * * *"}) || cronWf.Spec.WorkflowSpec.Entrypoint != "main" {
+		t.Errorf("cron workflow spec = %+v, want schedule 0 2 * * * with entrypoint main", cronWf.Spec)
+	}
+}
+
+// TestConvertWorkflowWithoutWebhookEvents 测试启用 Sensor 时没有 push 和 pull_request 触发的 workflow 不生成 Sensor
+func TestConvertWorkflowWithoutWebhookEvents(t *testing.T) {
+	for _, on := range []string{"workflow_dispatch", "schedule:\n    - cron: \"0 2 * * *\"", "workflow_call"} {
+		data := []byte("name: ci\non:\n  " + on + "\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n")
+		output, err := ConvertWorkflow(data, sensorOptions("argo-events")...)
+		if err != nil {
+			t.Errorf("ConvertWorkflow() with on.%s error = %v", on, err)
+			continue
+		}
+		if strings.Contains(output, "kind: Sensor") || strings.Contains(output, "kind: EventSource") {
+			t.Errorf("ConvertWorkflow() with on.%s = %s, want no Sensor or EventSource", on, output)
+		}
+	}
+}
+
+// TestRunDispatchInputs 测试 workflow_dispatch 的输入转换为带可选值和默认值的 workflow 参数
+func TestRunDispatchInputs(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: deploy
+on:
+  workflow_dispatch:
+    inputs:
+      target:
+        description: Deploy target
+        type: choice
+        options: [staging, production]
+      dry-run:
+        type: boolean
+        default: true
+      replicas:
+        type: number
+        default: "2"
+      Version:
+        required: true
+      env:
+        type: environment
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    steps:
+      - run: ./deploy.sh ${{ inputs.target }} ${{ github.event.inputs.version }}
+`)
+	argoWf, err := NewConverter(wf).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// 输入名不区分大小写，引用声明的输入时使用声明的名称
+	want := []wfv1.Parameter{
+		{Name: "Version"},
+		{Name: "target", Value: wfv1.AnyStringPtr("staging"), Enum: []wfv1.AnyString{"staging", "production"}, Description: wfv1.AnyStringPtr("Deploy target")},
+		{Name: "dry-run", Value: wfv1.AnyStringPtr("true"), Enum: []wfv1.AnyString{"true", "false"}},
+		{Name: "env", Value: wfv1.AnyStringPtr("")},
+		{Name: "replicas", Value: wfv1.AnyStringPtr("2")},
+	}
+	if got := argoWf.Spec.Arguments.Parameters; !reflect.DeepEqual(got, want) {
+		t.Errorf("parameters = %+v, want %+v", got, want)
+	}
+	env := argoWf.Spec.Templates[0].Container.Env
+	if !containsEnvVar(env, corev1.EnvVar{Name: "ARGUS_EXPR_0", Value: "{{workflow.parameters.target}}"}) ||
+		!containsEnvVar(env, corev1.EnvVar{Name: "ARGUS_EXPR_1", Value: "{{workflow.parameters.Version}}"}) {
+		t.Errorf("env = %+v, want inputs from workflow parameters", env)
+	}
+
+	argoWf, err = NewConverter(wf, WithInputs(map[string]interface{}{
+		"Target":   "production",
+		"dry-run":  false,
+		"replicas": 3.0,
+		"version":  "1.2.0",
+	})).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := make(map[string]string)
+	for _, param := range argoWf.Spec.Arguments.Parameters {
+		got[param.Name] = param.Value.String()
+	}
+	wantValues := map[string]string{"dry-run": "false", "env": "", "replicas": "3", "target": "production", "Version": "1.2.0"}
+	if !reflect.DeepEqual(got, wantValues) {
+		t.Errorf("parameter values = %v, want %v", got, wantValues)
+	}
+}
+
+// TestRunDispatchInputsErrors 测试传入的输入与声明的类型不符时转换失败
+func TestRunDispatchInputsErrors(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: deploy
+on:
+  workflow_dispatch:
+    inputs:
+      target:
+        type: choice
+        options: [staging, production]
+      dry-run:
+        type: boolean
+      replicas:
+        type: number
+      version:
+        required: true
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	tests := []struct {
+		name    string
+		inputs  map[string]interface{}
+		wantErr string
+	}{
+		{"choice", map[string]interface{}{"version": "1", "target": "dev"}, "dev is not one of staging, production"},
+		{"boolean", map[string]interface{}{"version": "1", "dry-run": "yes"}, "yes is not a boolean"},
+		{"number", map[string]interface{}{"version": "1", "replicas": "many"}, "many is not a number"},
+		{"required", map[string]interface{}{"target": "staging"}, "version: the input is required"},
+		{"unknown", map[string]interface{}{"version": "1", "region": "eu"}, "region: not defined in workflow_dispatch"},
+		{"object", map[string]interface{}{"version": map[string]interface{}{}}, "is not a string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewConverter(wf, WithInputs(tt.inputs)).Run()
+			if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Run() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	wf = readTestWorkflow(t, `
+name: deploy
+on:
+  workflow_dispatch:
+    inputs:
+      target:
+        type: choice
+        options: [staging]
+        default: dev
+jobs:
+  deploy:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	if _, err := NewConverter(wf).Run(); err == nil || !strings.Contains(err.Error(), "invalid default of input target") {
+		t.Errorf("Run() error = %v, want invalid default", err)
+	}
+}
+
+// TestRunEventContext 测试由事件计算 github 上下文，并向每个容器提供 GitHub runner 的环境变量
+func TestRunEventContext(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: ci
+on: [push, pull_request]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    env:
+      RUNNER_TEMP: /scratch
+    steps:
+      - run: echo ${{ github.ref_name }} ${{ github.event.head_commit.message }}
+  image:
+    runs-on: [self-hosted, linux, ARM64]
+    steps:
+      - uses: docker://alpine:3.20
+        with:
+          args: echo ${{ github.repository_owner }}
+`)
+	push := EventContext{
+		EventName: "push",
+		Payload: map[string]interface{}{
+			"ref":         "refs/tags/v1.0.0",
+			"after":       "abc123",
+			"repository":  map[string]interface{}{"full_name": "openeuler/argus"},
+			"sender":      map[string]interface{}{"login": "octocat"},
+			"head_commit": map[string]interface{}{"message": "release"},
+		},
+	}
+	argoWf, err := NewConverter(wf, WithEventContext(push)).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	templates := make(map[string]wfv1.Template)
+	for _, tmpl := range argoWf.Spec.Templates {
+		templates[tmpl.Name] = tmpl
+	}
+
+	build := templates["build"].Container
+	for _, want := range []corev1.EnvVar{
+		{Name: "CI", Value: "true"},
+		{Name: "GITHUB_SHA", Value: "abc123"},
+		{Name: "GITHUB_REF", Value: "refs/tags/v1.0.0"},
+		{Name: "GITHUB_REPOSITORY", Value: "openeuler/argus"},
+		{Name: "GITHUB_EVENT_NAME", Value: "push"},
+		{Name: "GITHUB_ACTOR", Value: "octocat"},
+		{Name: "GITHUB_WORKSPACE", Value: "/workspace"},
+		{Name: "GITHUB_RUN_ID", Value: "{{workflow.uid}}"},
+		{Name: "GITHUB_RUN_NUMBER", Value: "{{workflow.creationTimestamp.s}}"},
+		{Name: "RUNNER_OS", Value: "Linux"},
+		{Name: "RUNNER_ARCH", Value: "X64"},
+		{Name: "RUNNER_TEMP", Value: "/scratch"},
+		{Name: "ARGUS_EXPR_0", Value: "v1.0.0"},
+		{Name: "ARGUS_EXPR_1", Value: "release"},
+	} {
+		if !containsEnvVar(build.Env, want) {
+			t.Errorf("build env = %+v, want %+v", build.Env, want)
+		}
+	}
+
+	var docker *corev1.Container
+	for _, tmpl := range argoWf.Spec.Templates {
+		if tmpl.Container != nil && tmpl.Container.Image == "alpine:3.20" {
+			docker = tmpl.Container
+		}
+	}
+	if docker == nil {
+		t.Fatalf("docker step template not found in %+v", argoWf.Spec.Templates)
+	}
+	// runs-on 中的架构标签决定 RUNNER_ARCH
+	if !containsEnvVar(docker.Env, corev1.EnvVar{Name: "GITHUB_SHA", Value: "abc123"}) ||
+		!containsEnvVar(docker.Env, corev1.EnvVar{Name: "RUNNER_ARCH", Value: "ARM64"}) ||
+		!reflect.DeepEqual(docker.Args, []string{"echo", "openeuler"}) {
+		t.Errorf("docker step = %+v, want runner env and resolved args", docker)
+	}
+
+	// run_id 和 run_number 使用 Workflow 的 uid 和创建时间，不需要运行时参数
+	if params := argoWf.Spec.Arguments.Parameters; len(params) != 0 {
+		t.Errorf("parameters = %+v, want none", params)
+	}
+
+	pullRequest := EventContext{
+		EventName:  "pull_request",
+		Repository: "openeuler/argus",
+		Payload: map[string]interface{}{
+			"number": 7,
+			"pull_request": map[string]interface{}{
+				"number":           7,
+				"head":             map[string]interface{}{"ref": "fix", "sha": "def456"},
+				"base":             map[string]interface{}{"ref": "main"},
+				"merge_commit_sha": "fed789",
+			},
+		},
+	}
+	ctx := pullRequest.githubContext()
+	for name, want := range map[string]string{"ref": "refs/pull/7/merge", "ref_name": "7/merge", "sha": "fed789", "head_ref": "fix", "base_ref": "main", "repository_owner": "openeuler"} {
+		if got := toString(ctx[name]); got != want {
+			t.Errorf("github.%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestJobRunnerArch 测试由 runs-on 标签判断 RUNNER_ARCH，没有架构标签时使用配置的默认值
+func TestJobRunnerArch(t *testing.T) {
+	tests := []struct {
+		runsOn []string
+		def    string
+		want   string
+	}{
+		{runsOn: []string{"ubuntu-latest"}, want: "X64"},
+		{runsOn: []string{"ubuntu-24.04-arm"}, want: "ARM64"},
+		{runsOn: []string{"self-hosted", "linux", "aarch64"}, want: "ARM64"},
+		{runsOn: []string{"self-hosted", "ARM"}, want: "ARM"},
+		{runsOn: []string{"openeuler-x86_64"}, def: "ARM64", want: "X64"},
+		{runsOn: []string{"openeuler-910b"}, def: "ARM64", want: "ARM64"},
+	}
+	for _, tt := range tests {
+		if got := NewConverter(&model.Workflow{}, WithRunnerArch(tt.def)).jobRunnerArch(tt.runsOn); got != tt.want {
+			t.Errorf("jobRunnerArch(%v) with default %q = %q, want %q", tt.runsOn, tt.def, got, tt.want)
+		}
+	}
+}
+
+// TestEvaluateTrigger 测试按 GitHub 的规则判断事件是否触发 workflow
+func TestEvaluateTrigger(t *testing.T) {
+	wf := readTestWorkflow(t, `
+name: ci
+on:
+  push:
+    branches: ["releases/**", "!releases/**-alpha", main]
+    tags: ["v*"]
+    paths-ignore: ["docs/**", "**.md"]
+  pull_request:
+    types: [opened, labeled]
+    branches-ignore: ["wip/*"]
+    paths: ["src/**"]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	tests := []struct {
+		name       string
+		event      TriggerEvent
+		want       bool
+		wantReason string
+	}{
+		{"branch", TriggerEvent{EventName: "push", Ref: "refs/heads/main", Files: []string{"main.go"}}, true, "push to refs/heads/main matches"},
+		{"nested branch", TriggerEvent{EventName: "push", Ref: "refs/heads/releases/v1/rc", Files: []string{"main.go"}}, true, "matches"},
+		{"negated branch", TriggerEvent{EventName: "push", Ref: "refs/heads/releases/v2-alpha", Files: []string{"main.go"}}, false, "branch releases/v2-alpha does not match"},
+		{"other branch", TriggerEvent{EventName: "push", Ref: "refs/heads/dev"}, false, "branch dev does not match"},
+		{"tag", TriggerEvent{EventName: "push", Ref: "refs/tags/v1.0", Files: []string{"README.md"}}, true, "matches"},
+		{"other tag", TriggerEvent{EventName: "push", Ref: "refs/tags/release-1"}, false, "tag release-1 does not match v*"},
+		{"ignored paths", TriggerEvent{EventName: "push", Ref: "refs/heads/main", Files: []string{"docs/guide.md", "README.md"}}, false, "all changed files are ignored"},
+		{"partly ignored paths", TriggerEvent{EventName: "push", Ref: "refs/heads/main", Files: []string{"README.md", "Makefile"}}, true, "matches"},
+		{"pull request", TriggerEvent{EventName: "pull_request", Ref: "main", Action: "labeled", Files: []string{"src/a/b.go"}}, true, "pull_request to main matches"},
+		{"pull request type", TriggerEvent{EventName: "pull_request", Ref: "main", Action: "synchronize"}, false, "activity type synchronize is not in types opened, labeled"},
+		{"pull request without action", TriggerEvent{EventName: "pull_request", Ref: "main", Files: []string{"src/a/b.go"}}, false, "activity type is empty, on.pull_request only triggers for types opened, labeled"},
+		{"pull request ignored branch", TriggerEvent{EventName: "pull_request", Ref: "refs/heads/wip/x", Action: "opened"}, false, "branch wip/x is ignored by wip/*"},
+		{"pull request paths", TriggerEvent{EventName: "pull_request", Ref: "main", Action: "opened", Files: []string{"docs/a.md"}}, false, "no changed file matches paths src/**"},
+		{"other event", TriggerEvent{EventName: "release"}, false, "workflow is not triggered by release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := EvaluateTrigger(wf, tt.event)
+			if err != nil {
+				t.Fatalf("EvaluateTrigger() error = %v", err)
+			}
+			if result.Triggered != tt.want || !strings.Contains(result.Reason, tt.wantReason) {
+				t.Errorf("EvaluateTrigger() = %+v, want triggered %v with %q", result, tt.want, tt.wantReason)
+			}
+		})
+	}
+
+	wf = readTestWorkflow(t, `
+name: docs
+on:
+  push:
+    tags: ["v*"]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	result, err := EvaluateTrigger(wf, TriggerEvent{EventName: "push", Ref: "refs/heads/main"})
+	if err != nil || result.Triggered || !strings.Contains(result.Reason, "only tag filters are defined") {
+		t.Errorf("EvaluateTrigger() = %+v, %v, want branch push rejected", result, err)
+	}
+
+	// 未设置 types 时按默认的 types 过滤，缺少 action 的 pull_request 不触发
+	wf = readTestWorkflow(t, `
+name: pr
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	result, err = EvaluateTrigger(wf, TriggerEvent{EventName: "pull_request", Ref: "main"})
+	if err != nil || result.Triggered || !strings.Contains(result.Reason, "types opened, synchronize, reopened") {
+		t.Errorf("EvaluateTrigger() = %+v, %v, want pull_request without action rejected", result, err)
+	}
+	result, err = EvaluateTrigger(wf, TriggerEvent{EventName: "pull_request", Ref: "main", Action: "synchronize"})
+	if err != nil || !result.Triggered {
+		t.Errorf("EvaluateTrigger() = %+v, %v, want synchronize triggered", result, err)
+	}
+
+	// 与 GitHub 一样，paths 和 paths-ignore 不能同时设置
+	wf = readTestWorkflow(t, `
+name: docs
+on:
+  push:
+    paths: ["src/**"]
+    paths-ignore: ["docs/**"]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+`)
+	_, err = EvaluateTrigger(wf, TriggerEvent{EventName: "push", Ref: "refs/heads/main", Files: []string{"docs/a.md"}})
+	if err == nil || !strings.Contains(err.Error(), "cannot use both paths and paths-ignore") {
+		t.Errorf("EvaluateTrigger() error = %v, want paths and paths-ignore error", err)
+	}
+	_, err = evaluatePathFilters(eventFilter{Paths: []string{"src/**"}, PathsIgnore: []string{"docs/**"}}, []string{"docs/a.md"})
+	if err == nil || !strings.Contains(err.Error(), "cannot use both paths and paths-ignore") {
+		t.Errorf("evaluatePathFilters() error = %v, want paths and paths-ignore error", err)
+	}
+
+	// branches 和 branches-ignore、tags 和 tags-ignore 同样不能同时设置
+	_, _, err = evaluateRefFilters(eventFilter{Branches: []string{"main"}, BranchesIgnore: []string{"wip/*"}}, "refs/heads/main")
+	if err == nil || !strings.Contains(err.Error(), "cannot use both branches and branches-ignore") {
+		t.Errorf("evaluateRefFilters() error = %v, want branches and branches-ignore error", err)
+	}
+	_, _, err = evaluateRefFilters(eventFilter{Tags: []string{"v*"}, TagsIgnore: []string{"v*-rc*"}}, "refs/tags/v1.0")
+	if err == nil || !strings.Contains(err.Error(), "cannot use both tags and tags-ignore") {
+		t.Errorf("evaluateRefFilters() error = %v, want tags and tags-ignore error", err)
+	}
+
+	// 无效的模式返回错误而不是 panic
+	_, err = evaluatePathFilters(eventFilter{Paths: []string{"src/[z-a]/**"}}, []string{"src/a/b.go"})
+	if err == nil || !strings.Contains(err.Error(), "invalid filter pattern") {
+		t.Errorf("evaluatePathFilters() error = %v, want invalid filter pattern error", err)
+	}
+}
+
+// TestRunEnvironmentApproval 测试部署到需要审批的环境的 job 在审批任务之后执行，并使用环境的 secrets 和 vars
+func TestRunEnvironmentApproval(t *testing.T) {
+	source := `
+name: release
+on: push
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - run: make
+  deploy:
+    needs: build
+    runs-on: ubuntu-latest
+    environment:
+      name: Production
+      url: https://example.com
+    env:
+      TOKEN: ${{ secrets.deploy_token }}
+      NPM_TOKEN: ${{ secrets.NPM_TOKEN }}
+      REGION: ${{ vars.REGION }}
+      OWNER: ${{ vars.OWNER }}
+    steps:
+      - run: ./deploy.sh
+  docs:
+    runs-on: ubuntu-latest
+    environment: staging
+    steps:
+      - run: make docs
+`
+	wf := readTestWorkflow(t, source)
+	argoWf, err := NewConverter(wf,
+		WithSource([]byte(source)),
+		WithRepository("openeuler/argus"),
+		WithSecretMapping(map[string]string{"openeuler": "org-secrets"}),
+		WithEnvironments(map[string]Environment{
+			"production": {RequireApproval: true, Secret: "production-secrets", Secrets: []string{"DEPLOY_TOKEN"}, Vars: map[string]string{"region": "eu-west"}},
+			"staging":    {},
+		}),
+	).Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	templates := make(map[string]wfv1.Template)
+	for _, tmpl := range argoWf.Spec.Templates {
+		templates[tmpl.Name] = tmpl
+	}
+	if approval, ok := templates["deploy-approval"]; !ok || approval.Suspend == nil {
+		t.Errorf("deploy-approval template = %+v, want suspend", approval)
+	} else if param := approval.Inputs.GetParameterByName(common.ApprovalEnvironmentsParameter); param == nil || param.Value.String() != `["Production"]` {
+		t.Errorf("deploy-approval environments = %+v, want [\"Production\"]", param)
+	}
+	if _, ok := templates["docs-approval"]; ok {
+		t.Errorf("docs should not need approval")
+	}
+
+	var tasks []string
+	for _, task := range templates["main"].DAG.Tasks {
+		tasks = append(tasks, task.Name+":"+task.Depends)
+	}
+	wantTasks := []string{"build:", "docs:", "deploy-approval:build.Succeeded", "deploy:deploy-approval.Succeeded"}
+	if !reflect.DeepEqual(tasks, wantTasks) {
+		t.Errorf("tasks = %v, want %v", tasks, wantTasks)
+	}
+
+	env := templates["deploy"].Container.Env
+	for _, want := range []corev1.EnvVar{
+		{Name: "TOKEN", ValueFrom: secretValue{Secret: "production-secrets", Key: "DEPLOY_TOKEN"}.keyRef()},
+		{Name: "NPM_TOKEN", ValueFrom: secretValue{Secret: "org-secrets", Key: "NPM_TOKEN"}.keyRef()},
+		{Name: "REGION", Value: "eu-west"},
+		{Name: "OWNER", Value: "{{workflow.parameters.vars-owner}}"},
+	} {
+		if !containsEnvVar(env, want) {
+			t.Errorf("deploy env = %+v, want %+v", env, want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	"github.com/robfig/cron/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// scheduleTimezone 是 GitHub 计算 schedule 的时区
+const scheduleTimezone = "UTC"
+
+// cronParser 按 GitHub 支持的 POSIX cron 语法解析 schedule，只有五个字段，不支持 @daily 等宏
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// workflowSchedules 返回 on.schedule 中的 cron 表达式，没有 schedule 时返回空
+func workflowSchedules(wf *model.Workflow) ([]string, error) {
+	raw := wf.OnEvent("schedule")
+	if raw == nil {
+		return nil, nil
+	}
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("on.schedule must be a list of cron entries")
+	}
+
+	var schedules []string
+	for _, entry := range entries {
+		fields, _ := entry.(map[string]interface{})
+		expr, _ := fields["cron"].(string)
+		expr = strings.TrimSpace(expr)
+		if len(strings.Fields(expr)) != 5 {
+			return nil, fmt.Errorf("invalid cron %q, a schedule must have five fields", expr)
+		}
+		if _, err := cronParser.Parse(expr); err != nil {
+			return nil, fmt.Errorf("invalid cron %q: %w", expr, err)
+		}
+		schedules = append(schedules, expr)
+	}
+	return schedules, nil
+}
+
+// RunCronWorkflow 将带有 on.schedule 的 workflow 转换为 CronWorkflow，所有 cron 表达式合并到一个
+// CronWorkflow 中，与 GitHub 一样按 UTC 时区调度
+func (c *WorkflowConverter) RunCronWorkflow() (*wfv1.CronWorkflow, error) {
+	argoWf, err := c.Run()
+	if err != nil {
+		return nil, err
+	}
+	return c.cronWorkflow(argoWf.ObjectMeta, argoWf.Spec)
+}
+
+// cronWorkflow 按 on.schedule 创建定时运行转换结果的 CronWorkflow，meta 中的注解添加到每次运行的 Workflow。
+// 定时运行的 github.event_name 为 schedule
+func (c *WorkflowConverter) cronWorkflow(meta metav1.ObjectMeta, spec wfv1.WorkflowSpec) (*wfv1.CronWorkflow, error) {
+	schedules, err := workflowSchedules(c.githubWorkflow)
+	if err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return nil, fmt.Errorf("workflow %s has no schedule", c.githubWorkflow.Name)
+	}
+
+	spec = *spec.DeepCopy()
+	for i, param := range spec.Arguments.Parameters {
+		if param.Name == "github-event_name" {
+			spec.Arguments.Parameters[i].Value = wfv1.AnyStringPtr("schedule")
+		}
+	}
+
+	cronWf := &wfv1.CronWorkflow{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "argoproj.io/v1alpha1",
+			Kind:       "CronWorkflow",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: templateName(c.githubWorkflow.Name),
+		},
+		Spec: wfv1.CronWorkflowSpec{
+			WorkflowSpec: spec,
+			Schedules:    schedules,
+			Timezone:     scheduleTimezone,
+		},
+	}
+	if len(meta.Annotations) > 0 {
+		cronWf.Spec.WorkflowMetadata = &metav1.ObjectMeta{Annotations: meta.Annotations}
+	}
+	return cronWf, nil
+}
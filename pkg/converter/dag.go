@@ -0,0 +1,125 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// jobNeeds 返回 job 去重后的 needs 列表，保持声明顺序
+func jobNeeds(job *model.Job) []string {
+	var needs []string
+	seen := make(map[string]bool)
+	for _, need := range job.Needs() {
+		if seen[need] {
+			continue
+		}
+		seen[need] = true
+		needs = append(needs, need)
+	}
+	return needs
+}
+
+// validateJobNeeds 校验所有 needs 都指向已存在的 job，并且依赖图中没有环
+func validateJobNeeds(wf *model.Workflow) error {
+	jobIDs := sortedJobIDs(wf)
+
+	for _, jobID := range jobIDs {
+		for _, need := range jobNeeds(wf.Jobs[jobID]) {
+			if _, ok := wf.Jobs[need]; !ok {
+				return fmt.Errorf("job %s needs unknown job %s", jobID, need)
+			}
+		}
+	}
+
+	// 深度优先遍历查找环，state: 0 未访问，1 访问中，2 已完成
+	state := make(map[string]int)
+	var path []string
+	var visit func(jobID string) error
+	visit = func(jobID string) error {
+		switch state[jobID] {
+		case 1:
+			start := 0
+			for i, id := range path {
+				if id == jobID {
+					start = i
+					break
+				}
+			}
+			cycle := append(append([]string{}, path[start:]...), jobID)
+			return fmt.Errorf("job dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		case 2:
+			return nil
+		}
+
+		state[jobID] = 1
+		path = append(path, jobID)
+		for _, need := range jobNeeds(wf.Jobs[jobID]) {
+			if err := visit(need); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[jobID] = 2
+		return nil
+	}
+
+	for _, jobID := range jobIDs {
+		if err := visit(jobID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jobStages 按照 needs 将 job 分层，分层方式与 act planner 的 createStages 一致：
+// 每一层只包含依赖已全部出现在之前各层中的 job。层内按 job ID 排序以保证输出稳定
+func jobStages(wf *model.Workflow) ([][]string, error) {
+	if err := validateJobNeeds(wf); err != nil {
+		return nil, err
+	}
+
+	placed := make(map[string]bool)
+	remaining := sortedJobIDs(wf)
+	var stages [][]string
+
+	for len(remaining) > 0 {
+		var stage, next []string
+		for _, jobID := range remaining {
+			ready := true
+			for _, need := range jobNeeds(wf.Jobs[jobID]) {
+				if !placed[need] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				stage = append(stage, jobID)
+			} else {
+				next = append(next, jobID)
+			}
+		}
+		if len(stage) == 0 {
+			return nil, fmt.Errorf("unable to build dependency graph for jobs: %s", strings.Join(next, ", "))
+		}
+		for _, jobID := range stage {
+			placed[jobID] = true
+		}
+		stages = append(stages, stage)
+		remaining = next
+	}
+
+	return stages, nil
+}
+
+func sortedJobIDs(wf *model.Workflow) []string {
+	jobIDs := make([]string, 0, len(wf.Jobs))
+	for jobID := range wf.Jobs {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+	return jobIDs
+}
@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+)
+
+// ErrInvalidInput 表示传入的 workflow_dispatch 输入与 workflow 的声明不符
+var ErrInvalidInput = errors.New("invalid workflow_dispatch input")
+
+// WithInputs 设置手动触发 workflow 时传入的 workflow_dispatch 输入，取值按声明的类型校验后作为对应
+// workflow 参数的值。设置后缺少必需的输入或传入未声明的输入时转换失败
+func WithInputs(inputs map[string]interface{}) Option {
+	return func(c *WorkflowConverter) {
+		c.inputs = inputs
+	}
+}
+
+// dispatchParameters 将 workflow_dispatch 的 inputs 声明为 workflow 参数，inputs.<name> 和
+// github.event.inputs.<name> 在模板中引用同名参数。boolean 和 choice 类型的输入转换为参数的可选值，
+// 通过 WithInputs 传入的取值覆盖默认值
+func (c *WorkflowConverter) dispatchParameters(params []wfv1.Parameter, config *model.WorkflowDispatch) ([]wfv1.Parameter, error) {
+	declared := make(map[string]string, len(config.Inputs))
+	for name := range config.Inputs {
+		declared[strings.ToLower(name)] = name
+	}
+	values := make(map[string]interface{}, len(c.inputs))
+	for name, value := range c.inputs {
+		if _, ok := declared[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("%w %s: not defined in workflow_dispatch", ErrInvalidInput, name)
+		}
+		values[strings.ToLower(name)] = value
+	}
+
+	index := make(map[string]int, len(params))
+	for i, param := range params {
+		index[param.Name] = i
+	}
+	for _, key := range sortedKeys(declared) {
+		name := declared[key]
+		input := config.Inputs[name]
+		param := wfv1.Parameter{Name: name}
+		switch input.Type {
+		case "boolean":
+			param.Enum = []wfv1.AnyString{"true", "false"}
+		case "choice":
+			if len(input.Options) == 0 {
+				return nil, fmt.Errorf("choice input %s has no options", name)
+			}
+			for _, option := range input.Options {
+				param.Enum = append(param.Enum, wfv1.AnyString(option))
+			}
+		case "", "string", "number", "environment":
+		default:
+			return nil, fmt.Errorf("input %s has unsupported type %s", name, input.Type)
+		}
+		if input.Description != "" {
+			param.Description = wfv1.AnyStringPtr(input.Description)
+		}
+
+		if input.Default != "" {
+			value, err := dispatchValue(input, input.Default)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default of input %s: %w", name, err)
+			}
+			param.Value = wfv1.AnyStringPtr(value)
+		} else if !input.Required {
+			// 与 GitHub 一样，未设置默认值的 choice 输入默认选择第一项
+			value := toString(inputZero(input.Type))
+			if input.Type == "choice" {
+				value = input.Options[0]
+			}
+			param.Value = wfv1.AnyStringPtr(value)
+		}
+
+		if raw, ok := values[key]; ok {
+			value, err := dispatchValue(input, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w %s: %v", ErrInvalidInput, name, err)
+			}
+			param.Value = wfv1.AnyStringPtr(value)
+		} else if c.inputs != nil && param.Value == nil {
+			return nil, fmt.Errorf("%w %s: the input is required", ErrInvalidInput, name)
+		}
+
+		if i, ok := index[name]; ok {
+			params[i] = param
+		} else {
+			params = append(params, param)
+		}
+	}
+	return params, nil
+}
+
+// dispatchValue 按输入的类型校验取值，返回参数中使用的字符串
+func dispatchValue(input model.WorkflowDispatchInput, value interface{}) (string, error) {
+	switch input.Type {
+	case "boolean", "number":
+		typed, err := inputValue(input.Type, value)
+		if err != nil {
+			return "", err
+		}
+		return toString(typed), nil
+	case "choice":
+		s := toString(value)
+		if !containsString(input.Options, s) {
+			return "", fmt.Errorf("%s is not one of %s", s, strings.Join(input.Options, ", "))
+		}
+		return s, nil
+	}
+	switch value.(type) {
+	case string, bool, int, float64:
+		return toString(value), nil
+	}
+	return "", fmt.Errorf("%v is not a string", value)
+}
@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/kballard/go-shellquote"
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const dockerPrefix = "docker://"
+
+// isDockerStep 判断 step 是否直接使用 Docker 镜像（uses: docker://image）
+func isDockerStep(step *model.Step) bool {
+	return strings.HasPrefix(step.Uses, dockerPrefix)
+}
+
+// inputEnvName 按 GitHub 的规则返回 action 输入对应的环境变量名，
+// 例如 who to-greet 对应 INPUT_WHO_TO-GREET
+func inputEnvName(name string) string {
+	return "INPUT_" + strings.ToUpper(strings.ReplaceAll(name, " ", "_"))
+}
+
+// convertDockerStep 将 uses: docker://image 的 step 转换为独立的容器模板。with.args 和 with.entrypoint
+// 分别作为容器参数和入口命令，其余输入作为 INPUT_* 环境变量传入
+func (c *WorkflowConverter) convertDockerStep(name, jobName, key string, step *model.Step, scope *stepScope, base *corev1.Container) (*wfv1.Template, error) {
+	eval := scope.eval
+	jobEnv, _ := eval.contexts["env"].(map[string]interface{})
+	stepEnv, err := evaluateEnv(eval, jobEnv, step.Environment())
+	if err != nil {
+		return nil, err
+	}
+	eval = eval.withContext("env", stepEnv)
+
+	// 输入和 env 一样求值后作为 INPUT_* 环境变量，同名时以输入为准
+	containerEnv := make(map[string]interface{}, len(stepEnv)+len(step.With))
+	for name, value := range stepEnv {
+		containerEnv[name] = value
+	}
+	for _, key := range sortedKeys(step.With) {
+		if key == "args" || key == "entrypoint" {
+			continue
+		}
+		value, err := eval.interpolateValue(step.With[key])
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate input %s: %w", key, err)
+		}
+		containerEnv[inputEnvName(key)] = value
+	}
+	vars, err := envVars(containerEnv)
+	if err != nil {
+		return nil, err
+	}
+	vars = append(vars, corev1.EnvVar{Name: "GITHUB_OUTPUT", Value: stepOutputFile(key)})
+	vars = append(vars, runnerFileVars()...)
+
+	container := stepContainer(base, jobName, nil, vars)
+	container.Image = strings.TrimPrefix(step.Uses, dockerPrefix)
+
+	if raw, ok := step.With["entrypoint"]; ok {
+		entrypoint, err := eval.interpolate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate entrypoint: %w", err)
+		}
+		container.Command = []string{entrypoint}
+	}
+	if raw, ok := step.With["args"]; ok {
+		args, err := eval.interpolate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate args: %w", err)
+		}
+		if container.Args, err = shellquote.Split(args); err != nil {
+			return nil, fmt.Errorf("invalid args %q: %w", args, err)
+		}
+	}
+
+	return &wfv1.Template{
+		Name: name,
+		Annotations: map[string]string{
+			string(wfv1.TemplateAnnotationDisplayName): stepDisplayName(step),
+		},
+		Container: &container,
+	}, nil
+}
@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// envNamePattern 是 shell 中可以 export 的环境变量名
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// evaluateEnv 按名称顺序对 env 中的取值求值，结果合并到 base 的副本中，同名变量覆盖 base
+func evaluateEnv(eval *evaluator, base map[string]interface{}, env map[string]string) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(base)+len(env))
+	for name, value := range base {
+		merged[name] = value
+	}
+	for _, name := range sortedKeys(env) {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid env name %q", name)
+		}
+		value, err := eval.interpolateValue(env[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate env %s: %w", name, err)
+		}
+		merged[name] = value
+	}
+	return merged, nil
+}
+
+// jobEnv 按 GitHub 的优先级合并 workflow 和 job 的 env，job 覆盖 workflow
+func (c *WorkflowConverter) jobEnv(job *model.Job, eval *evaluator) (map[string]interface{}, error) {
+	env, err := evaluateEnv(eval, nil, c.githubWorkflow.Env)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateEnv(eval.withContext("env", env), env, job.Environment())
+}
+
+// envVars 将 env 转换为按名称排序的容器环境变量，运行时引用由 Argo 替换，
+// secret 通过 secretKeyRef 注入
+func envVars(env map[string]interface{}) ([]corev1.EnvVar, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]corev1.EnvVar, 0, len(names))
+	for _, name := range names {
+		switch v := env[name].(type) {
+		case shellValue:
+			return nil, fmt.Errorf("env %s: %s is only available in sh or bash run scripts", name, v)
+		case secretValue:
+			vars = append(vars, corev1.EnvVar{Name: name, ValueFrom: v.keyRef()})
+		default:
+			vars = append(vars, corev1.EnvVar{Name: name, Value: toString(v)})
+		}
+	}
+	return vars, nil
+}
+
+// mergeEnvVars 将 vars 合并到 base 的副本中，同名变量覆盖 base 中的取值
+func mergeEnvVars(base, vars []corev1.EnvVar) []corev1.EnvVar {
+	merged := append([]corev1.EnvVar(nil), base...)
+	index := make(map[string]int, len(merged))
+	for i, v := range merged {
+		index[v.Name] = i
+	}
+	for _, v := range vars {
+		if i, ok := index[v.Name]; ok {
+			merged[i] = v
+			continue
+		}
+		index[v.Name] = len(merged)
+		merged = append(merged, v)
+	}
+	return merged
+}
+
+// stepEnvExports 返回在 step 脚本开头导出 step env 的语句，以及 step 脚本中可见的 env 上下文。
+// 导出后的变量在脚本中直接以 ${NAME} 引用
+func stepEnvExports(step *model.Step, eval *evaluator, env *scriptEnv) ([]string, map[string]interface{}, error) {
+	jobEnv, _ := eval.contexts["env"].(map[string]interface{})
+	stepEnv := step.Environment()
+
+	context := make(map[string]interface{}, len(jobEnv)+len(stepEnv))
+	for name, value := range jobEnv {
+		context[name] = value
+	}
+
+	var exports []string
+	for _, name := range sortedKeys(stepEnv) {
+		if !envNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid env name %q", name)
+		}
+		word, err := eval.interpolateShellWord(stepEnv[name], env)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to evaluate env %s: %w", name, err)
+		}
+		exports = append(exports, fmt.Sprintf("export %s=%s", name, word))
+		context[name] = shellValue("${" + name + "}")
+	}
+	return exports, context, nil
+}
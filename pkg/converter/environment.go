@@ -0,0 +1,135 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	"github.com/opensourceways/argus-worker/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment 是部署环境的配置，对应 GitHub 仓库设置中的 environment
+type Environment struct {
+	// RequireApproval 为 true 时部署到该环境的 job 需要审批后才能执行
+	RequireApproval bool `json:"requireApproval,omitempty"`
+	// Secret 是环境 secrets 所在的 Kubernetes Secret，Secrets 是其中的 secret 名称，这些 secret 覆盖仓库的同名 secret
+	Secret  string   `json:"secret,omitempty"`
+	Secrets []string `json:"secrets,omitempty"`
+	// Vars 是环境的变量，覆盖仓库的同名变量
+	Vars map[string]string `json:"vars,omitempty"`
+	// Approvers 是可以审批部署到该环境的 job 的审批人，为空时所有审批人都可以审批
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// WithEnvironments 设置部署环境的配置，键为环境名，与 GitHub 一样不区分大小写。
+// 没有配置的环境不需要审批，也没有环境级别的 secrets 和 vars
+func WithEnvironments(environments map[string]Environment) Option {
+	return func(c *WorkflowConverter) {
+		c.environments = make(map[string]Environment, len(environments))
+		for name, env := range environments {
+			c.environments[strings.ToLower(name)] = env
+		}
+	}
+}
+
+// jobEnvironment 是 job 的 environment 配置，可以只写环境名
+type jobEnvironment struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+func (e *jobEnvironment) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		e.Name = node.Value
+		return nil
+	}
+	type plain jobEnvironment
+	return node.Decode((*plain)(e))
+}
+
+// useEnvironment 按 job 的 environment 选择环境级别的 secrets 和 vars，需要审批的环境记录到 approvals 中。
+// 环境名在每个 matrix 组合中分别求值，必须在转换时确定
+func (c *WorkflowConverter) useEnvironment(job *model.Job, eval *evaluator) error {
+	var env *jobEnvironment
+	for id, j := range c.githubWorkflow.Jobs {
+		if j == job {
+			env = c.raw.Jobs[id].Environment
+		}
+	}
+	if env == nil || strings.TrimSpace(env.Name) == "" || len(c.environments) == 0 {
+		return nil
+	}
+	name, err := eval.interpolate(env.Name)
+	if err != nil {
+		return fmt.Errorf("failed to evaluate environment: %w", err)
+	}
+	if strings.Contains(name, "{{") {
+		return fmt.Errorf("environment %q must be resolvable at conversion time", env.Name)
+	}
+	config, ok := c.environments[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+
+	if config.RequireApproval && !containsString(c.approvals[job], name) {
+		c.approvals[job] = append(c.approvals[job], name)
+	}
+
+	repoSecrets := eval.resolvers["secrets"]
+	eval.resolvers["secrets"] = func(path []string) (interface{}, error) {
+		if len(path) == 2 && config.Secret != "" {
+			for _, secret := range config.Secrets {
+				if strings.EqualFold(secret, path[1]) {
+					return secretValue{Secret: config.Secret, Key: strings.ToUpper(path[1])}, nil
+				}
+			}
+		}
+		return repoSecrets(path)
+	}
+	eval.resolvers["vars"] = func(path []string) (interface{}, error) {
+		if len(path) == 2 {
+			for key, value := range config.Vars {
+				if strings.EqualFold(key, path[1]) {
+					return value, nil
+				}
+			}
+		}
+		param, ok := c.contextParameterName(path)
+		if !ok {
+			return nil, fmt.Errorf("%s is not supported, only vars.<name> can be referenced", strings.Join(path, "."))
+		}
+		return runtimeValue(c.workflowParameter(param)), nil
+	}
+	return nil
+}
+
+// approvalTask 为需要审批的 job 创建 suspend 模板和在 job 之前执行的审批任务，审批任务继承 job 的依赖和条件，
+// job 只在审批通过后执行。suspend 模板的输入参数记录 job 部署的环境，审批结果由 common.ResolveApproval 写入 suspend 节点
+func (c *WorkflowConverter) approvalTask(jobName, prefix string, environments []string, task *wfv1.DAGTask) (wfv1.Template, wfv1.DAGTask, error) {
+	name := jobName + common.ApprovalSuffix
+	if _, ok := c.githubWorkflow.Jobs[name]; ok {
+		return wfv1.Template{}, wfv1.DAGTask{}, fmt.Errorf("job %s conflicts with the approval task of job %s", name, jobName)
+	}
+	value, err := json.Marshal(environments)
+	if err != nil {
+		return wfv1.Template{}, wfv1.DAGTask{}, err
+	}
+	template := wfv1.Template{
+		Name: prefix + name,
+		Inputs: wfv1.Inputs{
+			Parameters: []wfv1.Parameter{{Name: common.ApprovalEnvironmentsParameter, Value: wfv1.AnyStringPtr(string(value))}},
+		},
+		Suspend: &wfv1.SuspendTemplate{},
+	}
+	approval := wfv1.DAGTask{
+		Name:     name,
+		Template: prefix + name,
+		Depends:  task.Depends,
+		When:     task.When,
+	}
+	task.Depends = name + ".Succeeded"
+	return template, approval, nil
+}
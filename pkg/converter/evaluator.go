@@ -0,0 +1,893 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/rhysd/actionlint"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// runtimeValue 是转换时无法求值、需要由 Argo 在运行时替换的引用，值为 Argo 模板表达式，
+// 例如 {{workflow.parameters.github-sha}}
+type runtimeValue string
+
+// shellValue 是只能在脚本执行时取值的引用，值为 shell 表达式，例如读取 step 输出的命令替换。
+// 命令替换的结果不会被 shell 再次解析，因此可以直接拼接进脚本
+type shellValue string
+
+// deferredRef 判断取值是否为运行时引用，返回引用文本
+func deferredRef(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case runtimeValue:
+		return string(v), true
+	case shellValue:
+		return string(v), true
+	case secretValue:
+		return v.String(), true
+	}
+	return "", false
+}
+
+// filteredArray 是 foo.*.bar 这类对象过滤表达式的中间结果
+type filteredArray []interface{}
+
+// untrustedContexts 中的取值来自事件或调用方，拼接进脚本前需要通过环境变量传递。
+// env 的取值可能由这些上下文拼接而来，同样按不可信处理
+var untrustedContexts = map[string]bool{
+	"env":     true,
+	"github":  true,
+	"inputs":  true,
+	"vars":    true,
+	"needs":   true,
+	"steps":   true,
+	"secrets": true,
+}
+
+// evaluator 在转换时对 GitHub 表达式求值。contexts 中是转换时已知的上下文，
+// 其余可在运行时获得的上下文改写为 Argo 参数引用
+type evaluator struct {
+	converter *WorkflowConverter
+	contexts  map[string]interface{}
+	// resolvers 解析只能在运行时取值的上下文，例如 needs、steps
+	resolvers map[string]func(path []string) (interface{}, error)
+	// untrusted 记录最近一次求值是否读取了不可信上下文
+	untrusted bool
+}
+
+func (c *WorkflowConverter) newEvaluator(contexts map[string]interface{}) *evaluator {
+	eval := &evaluator{
+		converter: c,
+		contexts:  contexts,
+		resolvers: map[string]func(path []string) (interface{}, error){
+			"github":  c.githubResolver,
+			"secrets": c.secretsResolver,
+		},
+	}
+	// reusable workflow 中的 inputs 和 secrets 由调用方传入
+	if c.call != nil {
+		if _, ok := contexts["inputs"]; !ok {
+			contexts["inputs"] = c.call.inputs
+		}
+		if !c.call.inherit {
+			eval.resolvers["secrets"] = c.call.secretsResolver
+		}
+	}
+	return eval
+}
+
+// withContext 返回增加或替换了一个已知上下文的求值器副本
+func (e *evaluator) withContext(name string, value interface{}) *evaluator {
+	contexts := make(map[string]interface{}, len(e.contexts)+1)
+	for k, v := range e.contexts {
+		contexts[k] = v
+	}
+	contexts[name] = value
+
+	clone := *e
+	clone.contexts = contexts
+	return &clone
+}
+
+// withResolver 返回增加或替换了一个运行时上下文解析器的求值器副本
+func (e *evaluator) withResolver(name string, resolver func(path []string) (interface{}, error)) *evaluator {
+	resolvers := make(map[string]func(path []string) (interface{}, error), len(e.resolvers)+1)
+	for k, v := range e.resolvers {
+		resolvers[k] = v
+	}
+	resolvers[name] = resolver
+
+	clone := *e
+	clone.resolvers = resolvers
+	return &clone
+}
+
+// evaluate 解析并求值单个表达式
+func (e *evaluator) evaluate(expr string) (interface{}, error) {
+	node, err := parseExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	e.untrusted = false
+	return e.eval(node)
+}
+
+// interpolate 替换字符串中的所有 ${{ }} 表达式，运行时引用保留为 Argo 模板表达式
+func (e *evaluator) interpolate(s string) (string, error) {
+	return e.interpolateWith(s, nil, func(value interface{}, _ bool) (string, error) {
+		switch v := value.(type) {
+		case shellValue:
+			return "", fmt.Errorf("%s is only available in sh or bash run scripts", v)
+		case secretValue:
+			return "", fmt.Errorf("%s is only available in run scripts and env", v)
+		}
+		return toString(value), nil
+	})
+}
+
+// interpolateValue 对 env 等配置项求值。整个字符串是单个表达式时保留求值结果本身，
+// 否则按字符串插值，插值结果包含运行时引用时仍作为运行时引用
+func (e *evaluator) interpolateValue(s string) (interface{}, error) {
+	var values []interface{}
+	deferred := false
+	out, err := e.interpolateWith(s, nil, func(value interface{}, _ bool) (string, error) {
+		values = append(values, value)
+		if _, ok := value.(runtimeValue); ok {
+			deferred = true
+		}
+		return toString(value), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	src := strings.TrimSpace(s)
+	if len(values) == 1 && strings.HasPrefix(src, "${{") && strings.HasSuffix(src, "}}") {
+		return values[0], nil
+	}
+	for _, value := range values {
+		switch v := value.(type) {
+		case shellValue:
+			return nil, fmt.Errorf("%s can only be used as the whole value", v)
+		case secretValue:
+			return nil, fmt.Errorf("%s can only be used as the whole value", v)
+		}
+	}
+	if deferred {
+		return runtimeValue(out), nil
+	}
+	return out, nil
+}
+
+// interpolateScript 替换 run 脚本中的 ${{ }} 表达式。读取了不可信上下文的表达式不直接
+// 拼接进脚本，而是通过 env 中的环境变量传入，避免 shell 注入
+func (e *evaluator) interpolateScript(s string, env *scriptEnv) (string, error) {
+	return e.interpolateWith(s, nil, func(value interface{}, untrusted bool) (string, error) {
+		switch v := value.(type) {
+		case shellValue:
+			env.readsStepOutputs = true
+			return string(v), nil
+		case secretValue:
+			return env.bindSecret(v), nil
+		}
+		if !untrusted {
+			return toString(value), nil
+		}
+		return env.bind(toString(value)), nil
+	})
+}
+
+// interpolateForeignScript 替换 sh 和 bash 之外的 shell 脚本中的 ${{ }} 表达式。读取了不可信上下文的表达式和
+// secret 通过 env 中的环境变量传入，脚本按 env.reference 给出的 shell 语法读取；shell 没有可以在字符串中
+// 安全读取环境变量的语法时 env.reference 为 nil，这类表达式报错
+func (e *evaluator) interpolateForeignScript(s, shell string, env *scriptEnv) (string, error) {
+	return e.interpolateWith(s, nil, func(value interface{}, untrusted bool) (string, error) {
+		switch v := value.(type) {
+		case shellValue:
+			return "", fmt.Errorf("%s is only available in sh or bash run scripts", v)
+		case secretValue:
+			if env.reference == nil {
+				return "", fmt.Errorf("%s cannot be used in %s scripts, pass it through the step env and read the environment variable instead", v, shell)
+			}
+			return env.bindSecret(v), nil
+		}
+		if !untrusted {
+			return toString(value), nil
+		}
+		if env.reference == nil {
+			return "", fmt.Errorf("untrusted contexts cannot be used in %s scripts, pass the value through the step env and read the environment variable instead", shell)
+		}
+		return env.bind(toString(value)), nil
+	})
+}
+
+// interpolateShellWord 将字符串转换为一个双引号包裹的 shell 参数，字面部分和转换时
+// 已知的取值会被转义，不可信的取值通过 env 中的环境变量传入
+func (e *evaluator) interpolateShellWord(s string, env *scriptEnv) (string, error) {
+	word, err := e.interpolateWith(s, escapeDoubleQuoted, func(value interface{}, untrusted bool) (string, error) {
+		switch v := value.(type) {
+		case shellValue:
+			env.readsStepOutputs = true
+			return string(v), nil
+		case secretValue:
+			return env.bindSecret(v), nil
+		}
+		if !untrusted {
+			return escapeDoubleQuoted(toString(value)), nil
+		}
+		return env.bind(toString(value)), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return `"` + word + `"`, nil
+}
+
+// escapeDoubleQuoted 转义在 shell 双引号字符串中有特殊含义的字符
+func escapeDoubleQuoted(s string) string {
+	var out strings.Builder
+	for _, ch := range s {
+		switch ch {
+		case '\\', '"', '$', '`':
+			out.WriteRune('\\')
+		}
+		out.WriteRune(ch)
+	}
+	return out.String()
+}
+
+// interpolateWith 替换字符串中的表达式，literal 处理表达式之外的字面部分（为 nil 时原样输出），
+// emit 决定表达式取值如何输出
+func (e *evaluator) interpolateWith(s string, literal func(string) string, emit func(value interface{}, untrusted bool) (string, error)) (string, error) {
+	if literal == nil {
+		literal = func(s string) string { return s }
+	}
+
+	var out strings.Builder
+	for {
+		idx := strings.Index(s, "${{")
+		if idx == -1 {
+			out.WriteString(literal(s))
+			return out.String(), nil
+		}
+		out.WriteString(literal(s[:idx]))
+		s = s[idx+3:]
+
+		lexer := actionlint.NewExprLexer(s)
+		node, exprErr := actionlint.NewExprParser().Parse(lexer)
+		if exprErr != nil {
+			return "", fmt.Errorf("invalid expression in %q: %s", "${{"+s, exprErr.Message)
+		}
+		src := strings.TrimSpace(s[:lexer.Offset()-2])
+		s = s[lexer.Offset():]
+
+		e.untrusted = false
+		value, err := e.eval(node)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate ${{ %s }}: %w", src, err)
+		}
+		text, err := emit(value, e.untrusted)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate ${{ %s }}: %w", src, err)
+		}
+		out.WriteString(text)
+	}
+}
+
+func (e *evaluator) eval(node actionlint.ExprNode) (interface{}, error) {
+	if path, ok := contextPath(node); ok {
+		return e.resolve(path)
+	}
+
+	switch n := node.(type) {
+	case *actionlint.NullNode:
+		return nil, nil
+	case *actionlint.BoolNode:
+		return n.Value, nil
+	case *actionlint.IntNode:
+		return float64(n.Value), nil
+	case *actionlint.FloatNode:
+		return n.Value, nil
+	case *actionlint.StringNode:
+		return n.Value, nil
+	case *actionlint.ObjectDerefNode:
+		receiver, err := e.eval(n.Receiver)
+		if err != nil {
+			return nil, err
+		}
+		return property(receiver, n.Property)
+	case *actionlint.ArrayDerefNode:
+		receiver, err := e.eval(n.Receiver)
+		if err != nil {
+			return nil, err
+		}
+		return filter(receiver)
+	case *actionlint.IndexAccessNode:
+		operand, err := e.eval(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		index, err := e.eval(n.Index)
+		if err != nil {
+			return nil, err
+		}
+		return indexAccess(operand, index)
+	case *actionlint.NotOpNode:
+		operand, err := e.eval(n.Operand)
+		if err != nil {
+			return nil, err
+		}
+		truthy, err := toBool(operand)
+		if err != nil {
+			return nil, err
+		}
+		return !truthy, nil
+	case *actionlint.LogicalOpNode:
+		left, err := e.eval(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		truthy, err := toBool(left)
+		if err != nil {
+			// 运行时取值都是字符串，x || '' 的结果总是 x 本身，常用于给可能为空的取值提供默认值
+			if _, ok := deferredRef(left); ok && n.Kind == actionlint.LogicalOpNodeKindOr {
+				if right, rightErr := e.eval(n.Right); rightErr == nil && (right == nil || right == "") {
+					return left, nil
+				}
+			}
+			return nil, err
+		}
+		// && 和 || 按 GitHub 规则返回操作数本身而不是布尔值
+		if (n.Kind == actionlint.LogicalOpNodeKindAnd) != truthy {
+			return left, nil
+		}
+		return e.eval(n.Right)
+	case *actionlint.CompareOpNode:
+		left, err := e.eval(n.Left)
+		if err != nil {
+			return nil, err
+		}
+		right, err := e.eval(n.Right)
+		if err != nil {
+			return nil, err
+		}
+		return compare(n.Kind, left, right)
+	case *actionlint.FuncCallNode:
+		args := make([]interface{}, 0, len(n.Args))
+		for _, arg := range n.Args {
+			value, err := e.eval(arg)
+			if err != nil {
+				return nil, err
+			}
+			// 过滤结果作为函数参数时就是普通数组
+			if list, ok := value.(filteredArray); ok {
+				value = []interface{}(list)
+			}
+			args = append(args, value)
+		}
+		return e.call(n.Callee, args)
+	}
+	return nil, fmt.Errorf("unsupported expression node %T", node)
+}
+
+// resolve 解析上下文引用：转换时已知的上下文直接取值，运行时上下文改写为 workflow 参数
+// handles 判断上下文是否由转换时已知的取值或 resolvers 提供
+func (e *evaluator) handles(context string) bool {
+	if _, ok := e.contexts[context]; ok {
+		return true
+	}
+	_, ok := e.resolvers[context]
+	return ok
+}
+
+func (e *evaluator) resolve(path []string) (interface{}, error) {
+	if untrustedContexts[path[0]] {
+		e.untrusted = true
+	}
+
+	if value, ok := e.contexts[path[0]]; ok {
+		value = normalizeValue(value)
+		for _, key := range path[1:] {
+			next, err := property(value, key)
+			if err != nil {
+				return nil, err
+			}
+			value = next
+		}
+		return value, nil
+	}
+
+	if resolver, ok := e.resolvers[path[0]]; ok {
+		return resolver(path)
+	}
+
+	if name, ok := e.converter.contextParameterName(path); ok {
+		return runtimeValue(e.converter.workflowParameter(name)), nil
+	}
+	return nil, fmt.Errorf("context %s is not available", strings.Join(path, "."))
+}
+
+func (e *evaluator) call(name string, args []interface{}) (interface{}, error) {
+	for _, arg := range args {
+		if secret, ok := arg.(secretValue); ok {
+			return nil, fmt.Errorf("%s() cannot use %s, secrets can only be used as a whole value", name, secret)
+		}
+		if ref, ok := deferredRef(arg); ok && !stringFunctions[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%s() cannot use %s, which is only known at runtime", name, ref)
+		}
+	}
+
+	switch strings.ToLower(name) {
+	case "contains":
+		if err := checkArgs(name, args, 2, 2); err != nil {
+			return nil, err
+		}
+		if list, ok := args[0].([]interface{}); ok {
+			for _, item := range list {
+				if looseEqual(item, args[1]) {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		return strings.Contains(strings.ToLower(toString(args[0])), strings.ToLower(toString(args[1]))), nil
+	case "startswith":
+		if err := checkArgs(name, args, 2, 2); err != nil {
+			return nil, err
+		}
+		return strings.HasPrefix(strings.ToLower(toString(args[0])), strings.ToLower(toString(args[1]))), nil
+	case "endswith":
+		if err := checkArgs(name, args, 2, 2); err != nil {
+			return nil, err
+		}
+		return strings.HasSuffix(strings.ToLower(toString(args[0])), strings.ToLower(toString(args[1]))), nil
+	case "format":
+		if err := checkArgs(name, args, 1, -1); err != nil {
+			return nil, err
+		}
+		return format(toString(args[0]), args[1:])
+	case "join":
+		if err := checkArgs(name, args, 1, 2); err != nil {
+			return nil, err
+		}
+		sep := ","
+		if len(args) == 2 {
+			sep = toString(args[1])
+		}
+		list, ok := args[0].([]interface{})
+		if !ok {
+			return toString(args[0]), nil
+		}
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, toString(item))
+		}
+		return strings.Join(items, sep), nil
+	case "tojson":
+		if err := checkArgs(name, args, 1, 1); err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(args[0], "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("toJSON() failed: %w", err)
+		}
+		return string(data), nil
+	case "fromjson":
+		if err := checkArgs(name, args, 1, 1); err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(toString(args[0])), &value); err != nil {
+			return nil, fmt.Errorf("fromJSON() failed: %w", err)
+		}
+		return value, nil
+	case "hashfiles":
+		if err := checkArgs(name, args, 1, -1); err != nil {
+			return nil, err
+		}
+		patterns := make([]string, 0, len(args))
+		for _, arg := range args {
+			patterns = append(patterns, toString(arg))
+		}
+		return hashFiles(e.converter.workspace, patterns)
+	case "success", "failure", "always", "cancelled":
+		return nil, fmt.Errorf("status function %s() is only allowed in if conditions", name)
+	}
+	return nil, fmt.Errorf("unknown function %s()", name)
+}
+
+// stringFunctions 中的函数只把参数当作字符串拼接，运行时引用可以原样保留
+var stringFunctions = map[string]bool{
+	"format": true,
+	"join":   true,
+}
+
+func checkArgs(name string, args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("wrong number of arguments for %s(): %d", name, len(args))
+	}
+	return nil
+}
+
+// format 实现 format('{0} {1}', a, b)，{{ 和 }} 分别转义为 { 和 }
+func format(tmpl string, args []interface{}) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(tmpl); i++ {
+		ch := tmpl[i]
+		switch {
+		case ch == '{' && i+1 < len(tmpl) && tmpl[i+1] == '{':
+			out.WriteByte('{')
+			i++
+		case ch == '}' && i+1 < len(tmpl) && tmpl[i+1] == '}':
+			out.WriteByte('}')
+			i++
+		case ch == '{':
+			end := strings.IndexByte(tmpl[i:], '}')
+			if end == -1 {
+				return "", fmt.Errorf("format() string %q has an unclosed placeholder", tmpl)
+			}
+			index, err := strconv.Atoi(tmpl[i+1 : i+end])
+			if err != nil || index < 0 || index >= len(args) {
+				return "", fmt.Errorf("format() string %q has an invalid placeholder %s", tmpl, tmpl[i:i+end+1])
+			}
+			out.WriteString(toString(args[index]))
+			i += end
+		case ch == '}':
+			return "", fmt.Errorf("format() string %q has an unmatched '}'", tmpl)
+		default:
+			out.WriteByte(ch)
+		}
+	}
+	return out.String(), nil
+}
+
+// hashFiles 按 GitHub 的算法计算匹配文件的 SHA-256：逐个文件计算摘要后再整体求摘要，
+// 以 ! 开头的模式用于排除文件，没有匹配文件时返回空字符串
+func hashFiles(workspace fs.FS, patterns []string) (string, error) {
+	if workspace == nil {
+		return "", fmt.Errorf("hashFiles() requires a workspace to be configured")
+	}
+
+	var matched []string
+	err := fs.WalkDir(workspace, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		include := false
+		for _, pattern := range patterns {
+			exclude := strings.HasPrefix(pattern, "!")
+			pattern = strings.TrimPrefix(strings.TrimPrefix(pattern, "!"), "./")
+			if ok, _ := doublestar.Match(pattern, path); ok {
+				include = !exclude
+			}
+		}
+		if include {
+			matched = append(matched, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("hashFiles() failed: %w", err)
+	}
+	if len(matched) == 0 {
+		return "", nil
+	}
+
+	sort.Strings(matched)
+	result := sha256.New()
+	for _, path := range matched {
+		data, err := fs.ReadFile(workspace, path)
+		if err != nil {
+			return "", fmt.Errorf("hashFiles() failed: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		result.Write(sum[:])
+	}
+	return hex.EncodeToString(result.Sum(nil)), nil
+}
+
+// normalizeValue 将 YAML/JSON 解析出的各种数字类型统一为 float64，与表达式字面量保持一致
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case map[string]string:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[k] = item
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[k] = normalizeValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalizeValue(item)
+		}
+		return result
+	}
+	return value
+}
+
+// property 按 GitHub 规则读取对象属性，属性名不区分大小写，不存在时返回 null
+func property(value interface{}, key string) (interface{}, error) {
+	if ref, ok := deferredRef(value); ok {
+		return nil, fmt.Errorf("cannot read property %s of %s, which is only known at runtime", key, ref)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if item, ok := v[key]; ok {
+			return item, nil
+		}
+		for k, item := range v {
+			if strings.EqualFold(k, key) {
+				return item, nil
+			}
+		}
+	case filteredArray:
+		var result filteredArray
+		for _, item := range v {
+			if next, _ := property(item, key); next != nil {
+				result = append(result, next)
+			}
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+func filter(value interface{}) (interface{}, error) {
+	if ref, ok := deferredRef(value); ok {
+		return nil, fmt.Errorf("cannot filter %s, which is only known at runtime", ref)
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		return filteredArray(v), nil
+	case map[string]interface{}:
+		result := make(filteredArray, 0, len(v))
+		for _, item := range v {
+			result = append(result, item)
+		}
+		return result, nil
+	}
+	return filteredArray{}, nil
+}
+
+func indexAccess(operand, index interface{}) (interface{}, error) {
+	if key, ok := index.(string); ok {
+		return property(operand, key)
+	}
+	if ref, ok := deferredRef(operand); ok {
+		return nil, fmt.Errorf("cannot index %s, which is only known at runtime", ref)
+	}
+
+	switch v := operand.(type) {
+	case []interface{}:
+		i := toNumber(index)
+		if i >= 0 && int(i) < len(v) && i == math.Trunc(i) {
+			return v[int(i)], nil
+		}
+	case filteredArray:
+		return indexAccess([]interface{}(v), index)
+	}
+	return nil, nil
+}
+
+func compare(kind actionlint.CompareOpNodeKind, left, right interface{}) (interface{}, error) {
+	for _, v := range []interface{}{left, right} {
+		if ref, ok := deferredRef(v); ok {
+			return nil, fmt.Errorf("cannot compare %s, which is only known at runtime", ref)
+		}
+	}
+
+	switch kind {
+	case actionlint.CompareOpNodeKindEq:
+		return looseEqual(left, right), nil
+	case actionlint.CompareOpNodeKindNotEq:
+		return !looseEqual(left, right), nil
+	}
+
+	// 两侧都是字符串时不区分大小写按字典序比较，否则按数字比较
+	var cmp int
+	ls, lok := left.(string)
+	rs, rok := right.(string)
+	if lok && rok {
+		cmp = strings.Compare(strings.ToUpper(ls), strings.ToUpper(rs))
+	} else {
+		l, r := toNumber(left), toNumber(right)
+		if math.IsNaN(l) || math.IsNaN(r) {
+			return false, nil
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	}
+
+	switch kind {
+	case actionlint.CompareOpNodeKindLess:
+		return cmp < 0, nil
+	case actionlint.CompareOpNodeKindLessEq:
+		return cmp <= 0, nil
+	case actionlint.CompareOpNodeKindGreater:
+		return cmp > 0, nil
+	case actionlint.CompareOpNodeKindGreaterEq:
+		return cmp >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown comparison operator %s", kind)
+}
+
+// looseEqual 实现 GitHub 的宽松相等：类型不同时转换为数字比较，字符串比较不区分大小写
+func looseEqual(left, right interface{}) bool {
+	switch l := left.(type) {
+	case nil:
+		if right == nil {
+			return true
+		}
+	case string:
+		if r, ok := right.(string); ok {
+			return strings.EqualFold(l, r)
+		}
+	case bool:
+		if r, ok := right.(bool); ok {
+			return l == r
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			return l == r
+		}
+	case map[string]interface{}, []interface{}, filteredArray:
+		// 对象和数组只有引用相同才相等，转换时无法判断，视为不相等
+		return false
+	}
+
+	switch right.(type) {
+	case map[string]interface{}, []interface{}, filteredArray:
+		return false
+	}
+	l, r := toNumber(left), toNumber(right)
+	return !math.IsNaN(l) && !math.IsNaN(r) && l == r
+}
+
+// toBool 按 GitHub 规则判断真值：false、0、-0、""、null 和 NaN 为假
+func toBool(value interface{}) (bool, error) {
+	if ref, ok := deferredRef(value); ok {
+		return false, fmt.Errorf("cannot use %s as a condition, which is only known at runtime", ref)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0 && !math.IsNaN(v), nil
+	case string:
+		return v != "", nil
+	}
+	return true, nil
+}
+
+// toNumber 按 GitHub 规则转换为数字，无法转换时返回 NaN
+func toNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if strings.HasPrefix(s, "0x") {
+			if n, err := strconv.ParseInt(s[2:], 16, 64); err == nil {
+				return float64(n)
+			}
+		}
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			return n
+		}
+	}
+	return math.NaN()
+}
+
+// toString 按 GitHub 规则将取值转换为字符串，运行时引用保留为 Argo 模板表达式
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case runtimeValue:
+		return string(v)
+	case shellValue:
+		return string(v)
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) && math.Abs(v) < 1e15 {
+			return strconv.FormatInt(int64(v), 10)
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case []interface{}, filteredArray:
+		return "Array"
+	case map[string]interface{}:
+		return "Object"
+	}
+	return fmt.Sprint(value)
+}
+
+// scriptEnv 收集脚本中需要通过环境变量传入的表达式取值
+type scriptEnv struct {
+	vars []corev1.EnvVar
+	// readsStepOutputs 记录脚本中是否有读取 step 输出的命令替换
+	readsStepOutputs bool
+	// secrets 记录是否引用了 secret，可以在求值前重置
+	secrets bool
+	// reference 返回脚本中读取环境变量的写法，为 nil 时使用 sh 的 ${NAME}
+	reference func(name string) string
+}
+
+// ref 返回脚本中读取环境变量 name 的写法
+func (s *scriptEnv) ref(name string) string {
+	if s.reference != nil {
+		return s.reference(name)
+	}
+	return "${" + name + "}"
+}
+
+// bind 为取值分配环境变量并返回脚本中引用它的写法，相同取值复用同一个变量
+func (s *scriptEnv) bind(value string) string {
+	for _, v := range s.vars {
+		if v.ValueFrom == nil && v.Value == value {
+			return s.ref(v.Name)
+		}
+	}
+	name := fmt.Sprintf("ARGUS_EXPR_%d", len(s.vars))
+	s.vars = append(s.vars, corev1.EnvVar{Name: name, Value: value})
+	return s.ref(name)
+}
+
+// bindSecret 为 secret 分配通过 secretKeyRef 注入的环境变量，相同 secret 复用同一个变量
+func (s *scriptEnv) bindSecret(secret secretValue) string {
+	s.secrets = true
+	for _, v := range s.vars {
+		if v.ValueFrom != nil && reflect.DeepEqual(v.ValueFrom, secret.keyRef()) {
+			return s.ref(v.Name)
+		}
+	}
+	name := fmt.Sprintf("ARGUS_EXPR_%d", len(s.vars))
+	s.vars = append(s.vars, corev1.EnvVar{Name: name, ValueFrom: secret.keyRef()})
+	return s.ref(name)
+}
@@ -0,0 +1,184 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// jobTempDir 是 job 容器中的 $RUNNER_TEMP，node action 使用共享卷上的 runnerTempDir
+const jobTempDir = "/tmp"
+
+// EventContext 是触发 workflow 的事件，payload 是事件的 webhook 请求体。repository 和 sha 为空时从 payload 中读取
+type EventContext struct {
+	EventName  string                 `json:"event_name"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+	Repository string                 `json:"repository,omitempty"`
+	SHA        string                 `json:"sha,omitempty"`
+}
+
+// WithEventContext 设置触发 workflow 的事件。事件中的取值在转换时替换 github.* 表达式，并与 GitHub runner 一样
+// 以 GITHUB_*、RUNNER_* 和 CI 环境变量提供给每个 job 容器；未设置 WithRepository 时使用事件所属的仓库。
+// github.run_id 和 github.run_number 不从事件中读取：run_id 是 Workflow 的 uid，run_number 是 Workflow 创建时间的
+// Unix 秒数，它随运行递增，但同一秒内创建的运行取值相同，也不像 GitHub 那样按 workflow 从 1 开始连续编号
+func WithEventContext(event EventContext) Option {
+	return func(c *WorkflowConverter) {
+		c.event = event.githubContext()
+		if repository, ok := c.event["repository"].(string); ok && c.repository == "" {
+			c.repository = repository
+		}
+	}
+}
+
+// githubContext 按 GitHub 的规则由事件计算 github 上下文，无法从事件得到的字段不设置，仍作为运行时参数传入
+func (e EventContext) githubContext() map[string]interface{} {
+	payload := e.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	ctx := map[string]interface{}{
+		"event":     payload,
+		"workspace": workspaceDir,
+	}
+	if e.EventName != "" {
+		ctx["event_name"] = e.EventName
+	}
+
+	repository := e.Repository
+	if repository == "" {
+		repository = payloadString(payload, "repository", "full_name")
+	}
+	if repository != "" {
+		ctx["repository"] = repository
+		ctx["repository_owner"], _, _ = strings.Cut(repository, "/")
+	}
+	if actor := payloadString(payload, "sender", "login"); actor != "" {
+		ctx["actor"] = actor
+		ctx["triggering_actor"] = actor
+	}
+
+	sha, ref := e.SHA, payloadString(payload, "ref")
+	if number := payloadString(payload, "pull_request", "number"); number != "" {
+		// pull_request 事件在合并提交上运行
+		ref = fmt.Sprintf("refs/pull/%s/merge", number)
+		ctx["head_ref"] = payloadString(payload, "pull_request", "head", "ref")
+		ctx["base_ref"] = payloadString(payload, "pull_request", "base", "ref")
+		// 与 GitHub 一样使用合并提交，PR 无法合并时没有合并提交，使用源分支的提交
+		if sha == "" {
+			sha = payloadString(payload, "pull_request", "merge_commit_sha")
+		}
+		if sha == "" {
+			sha = payloadString(payload, "pull_request", "head", "sha")
+		}
+	}
+	if sha == "" {
+		sha = payloadString(payload, "after")
+	}
+	if sha != "" {
+		ctx["sha"] = sha
+	}
+	if ref != "" {
+		ctx["ref"] = ref
+		ctx["ref_type"] = "branch"
+		name := strings.TrimPrefix(ref, "refs/heads/")
+		if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+			name = tag
+			ctx["ref_type"] = "tag"
+		}
+		ctx["ref_name"] = strings.TrimPrefix(name, "refs/pull/")
+	}
+	return ctx
+}
+
+// payloadString 返回 payload 中 path 对应的取值，不存在时返回空字符串
+func payloadString(payload map[string]interface{}, path ...string) string {
+	var value interface{} = payload
+	for _, key := range path {
+		value, _ = property(value, key)
+	}
+	return toString(normalizeValue(value))
+}
+
+// eventValue 返回事件中 github.<path> 的取值，事件没有提供该字段时 ok 为 false
+func (c *WorkflowConverter) eventValue(path []string) (interface{}, bool) {
+	value, ok := c.event[path[0]]
+	if !ok {
+		return nil, false
+	}
+	value = normalizeValue(value)
+	for _, key := range path[1:] {
+		value, _ = property(value, key)
+		value = normalizeValue(value)
+	}
+	return value, true
+}
+
+// jobRunnerEnv 返回 GitHub runner 为每个 job 提供的 GITHUB_*、RUNNER_* 和 CI 环境变量，arch 是 job 的节点架构
+func jobRunnerEnv(eval *evaluator, arch string) (map[string]interface{}, error) {
+	env := map[string]interface{}{
+		"CI":                "true",
+		"GITHUB_ACTIONS":    "true",
+		"GITHUB_WORKSPACE":  workspaceDir,
+		"GITHUB_SERVER_URL": githubServerURL,
+		"GITHUB_API_URL":    githubAPIURL,
+		"RUNNER_OS":         "Linux",
+		"RUNNER_ARCH":       arch,
+		"RUNNER_TEMP":       jobTempDir,
+	}
+	for _, name := range runnerGithubContexts {
+		value, err := eval.resolve([]string{"github", name})
+		if err != nil {
+			return nil, err
+		}
+		env["GITHUB_"+strings.ToUpper(name)] = value
+	}
+	return env, nil
+}
+
+// workflowRunRefs 是 github.run_id 和 github.run_number 对应的 Argo workflow 变量。每次运行的 Workflow
+// 有唯一的 uid；run_number 需要是随运行递增的数字，使用 Workflow 创建时间的 Unix 秒数，它不像 GitHub 那样从 1 开始连续编号
+var workflowRunRefs = map[string]string{
+	"run_id":     "{{workflow.uid}}",
+	"run_number": "{{workflow.creationTimestamp.s}}",
+}
+
+// defaultRunnerArch 是 RUNNER_ARCH 的默认取值
+const defaultRunnerArch = "X64"
+
+// runnerArchLabels 是 runs-on 标签中表示节点架构的部分
+var runnerArchLabels = map[string]string{
+	"x64":     "X64",
+	"amd64":   "X64",
+	"x86_64":  "X64",
+	"arm64":   "ARM64",
+	"aarch64": "ARM64",
+}
+
+// WithRunnerArch 设置 runs-on 中没有架构标签时 RUNNER_ARCH 的取值，默认为 X64
+func WithRunnerArch(arch string) Option {
+	return func(c *WorkflowConverter) {
+		c.runnerArch = arch
+	}
+}
+
+// jobRunnerArch 由 runs-on 标签判断 job 的节点架构，例如 ubuntu-24.04-arm64、[self-hosted, ARM64]。
+// 与 GitHub 托管的 runner 一样，以 -arm 结尾的标签表示 ARM64，单独的 ARM 标签表示 32 位 ARM
+func (c *WorkflowConverter) jobRunnerArch(runsOn []string) string {
+	for _, label := range runsOn {
+		label = strings.ToLower(label)
+		if label == "arm" {
+			return "ARM"
+		}
+		if strings.HasSuffix(label, "-arm") {
+			return "ARM64"
+		}
+		for _, part := range strings.FieldsFunc(label, func(r rune) bool { return r == '-' || r == ' ' }) {
+			if arch, ok := runnerArchLabels[part]; ok {
+				return arch
+			}
+		}
+	}
+	if c.runnerArch != "" {
+		return c.runnerArch
+	}
+	return defaultRunnerArch
+}
@@ -0,0 +1,542 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// sensorWebhookPort 是 GitHub EventSource 监听的端口
+	sensorWebhookPort = "12000"
+	// githubEventHeader 是 GitHub EventSource 事件中 GitHub 事件类型请求头的路径
+	githubEventHeader = "headers.X-Github-Event.0"
+	// headRepositoryPath 是 pull_request 事件中源分支所在仓库的路径，与目标仓库不同时 PR 来自 fork
+	headRepositoryPath = "body.pull_request.head.repo.full_name"
+	// commitFilesPath 是 push 事件中所有提交新增、修改和删除的文件列表的路径
+	commitFilesPath = "[body.commits.#.added,body.commits.#.modified,body.commits.#.removed]"
+)
+
+// sensorFilterHint 提示无法表达为 Sensor 事件过滤器的 workflow 改由 API 判断是否触发并提交
+const sensorFilterHint = "the Sensor cannot express it, evaluate the trigger with /api/v1/trigger and submit the workflow through /api/v1/workflows/{namespace} instead"
+
+// sensorEvents 是可以转换为 Sensor 的触发事件
+var sensorEvents = []string{"push", "pull_request"}
+
+// defaultPullRequestTypes 是 on.pull_request 未设置 types 时触发的 action，与 GitHub 相同
+var defaultPullRequestTypes = []string{"opened", "synchronize", "reopened"}
+
+// Sensor 是 Argo Events 的 Sensor，只包含转换用到的字段
+type Sensor struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              SensorSpec `json:"spec"`
+}
+
+// SensorSpec 是 Sensor 的配置
+type SensorSpec struct {
+	Template     *SensorTemplate   `json:"template,omitempty"`
+	Dependencies []EventDependency `json:"dependencies"`
+	Triggers     []Trigger         `json:"triggers"`
+}
+
+// SensorTemplate 是运行 Sensor 的 Pod 的配置
+type SensorTemplate struct {
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// EventDependency 是 Sensor 依赖的事件，filters 中的条件全部满足时事件才会触发
+type EventDependency struct {
+	Name            string                 `json:"name"`
+	EventSourceName string                 `json:"eventSourceName"`
+	EventName       string                 `json:"eventName"`
+	Filters         *EventDependencyFilter `json:"filters,omitempty"`
+}
+
+// EventDependencyFilter 是事件的过滤条件
+type EventDependencyFilter struct {
+	Data []DataFilter `json:"data,omitempty"`
+}
+
+// DataFilter 按事件数据中 path 的取值过滤事件，取值与 value 中任一正则表达式匹配即满足条件，
+// comparator 为 != 时取反
+type DataFilter struct {
+	Path       string   `json:"path"`
+	Type       string   `json:"type"`
+	Value      []string `json:"value"`
+	Comparator string   `json:"comparator,omitempty"`
+}
+
+// Trigger 是 Sensor 在依赖的事件满足时执行的动作
+type Trigger struct {
+	Template *TriggerTemplate `json:"template"`
+}
+
+// TriggerTemplate 是提交 Argo Workflow 的触发器，conditions 是触发需要满足的依赖
+type TriggerTemplate struct {
+	Name         string               `json:"name"`
+	Conditions   string               `json:"conditions,omitempty"`
+	ArgoWorkflow *ArgoWorkflowTrigger `json:"argoWorkflow"`
+}
+
+// ArgoWorkflowTrigger 对 source 中的 Workflow 执行 operation，parameters 将事件数据写入 Workflow
+type ArgoWorkflowTrigger struct {
+	Operation  string             `json:"operation"`
+	Source     *ArtifactLocation  `json:"source"`
+	Parameters []TriggerParameter `json:"parameters,omitempty"`
+}
+
+// ArtifactLocation 是触发器使用的资源
+type ArtifactLocation struct {
+	Resource *wfv1.Workflow `json:"resource"`
+}
+
+// TriggerParameter 将 src 中的事件数据写入资源中 dest 指定的字段
+type TriggerParameter struct {
+	Src  *TriggerParameterSource `json:"src"`
+	Dest string                  `json:"dest"`
+}
+
+// TriggerParameterSource 是事件数据的来源，dataKey 是事件数据的路径，dataTemplate 是基于事件数据的
+// Go 模板，事件数据中没有对应的字段时使用 value
+type TriggerParameterSource struct {
+	DependencyName string  `json:"dependencyName"`
+	DataKey        string  `json:"dataKey,omitempty"`
+	DataTemplate   string  `json:"dataTemplate,omitempty"`
+	Value          *string `json:"value,omitempty"`
+}
+
+// EventSource 是 Argo Events 的 EventSource，只包含 GitHub 事件源
+type EventSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              EventSourceSpec `json:"spec"`
+}
+
+// EventSourceSpec 是 EventSource 的配置，github 以事件名为键
+type EventSourceSpec struct {
+	Github map[string]GithubEventSource `json:"github"`
+}
+
+// GithubEventSource 接收 GitHub webhook，用 webhookSecret 校验请求的签名，签名不正确的请求不会产生事件。
+// 没有配置 API token，EventSource 不会在 GitHub 上创建 webhook，需要在仓库中手动配置
+type GithubEventSource struct {
+	Repositories  []OwnedRepositories       `json:"repositories"`
+	Webhook       *WebhookContext           `json:"webhook"`
+	Events        []string                  `json:"events"`
+	WebhookSecret *corev1.SecretKeySelector `json:"webhookSecret"`
+	ContentType   string                    `json:"contentType"`
+}
+
+// OwnedRepositories 是 owner 下的仓库
+type OwnedRepositories struct {
+	Owner string   `json:"owner"`
+	Names []string `json:"names"`
+}
+
+// WebhookContext 是接收 GitHub webhook 的 HTTP 服务
+type WebhookContext struct {
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	Port     string `json:"port"`
+}
+
+// WithEventSensor 让 ConvertWorkflow 同时生成 Argo Events 的 Sensor 和 GitHub EventSource，
+// Sensor 使用 serviceAccount 提交 Workflow，为空时使用默认的 ServiceAccount；webhookSecret 是
+// GitHub webhook 的密钥，EventSource 用它校验请求的签名
+func WithEventSensor(serviceAccount string, webhookSecret corev1.SecretKeySelector) Option {
+	return func(c *WorkflowConverter) {
+		c.eventSensor = true
+		c.sensorServiceAccount = serviceAccount
+		c.webhookSecret = webhookSecret
+	}
+}
+
+// hasSensorEvents 判断 workflow 是否由可以转换为 Sensor 的事件触发
+func hasSensorEvents(wf *model.Workflow) bool {
+	for _, event := range sensorEvents {
+		if containsString(wf.On(), event) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunSensor 将 workflow 的 on.push 和 on.pull_request 转换为 Argo Events 的 Sensor，以及接收 GitHub
+// webhook 的 EventSource。Sensor 按触发条件过滤事件，并提交转换得到的 Workflow
+func (c *WorkflowConverter) RunSensor() (*Sensor, *EventSource, error) {
+	argoWf, err := c.Run()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.sensor(argoWf.ObjectMeta, argoWf.Spec)
+}
+
+// sensor 创建 Sensor 和 EventSource，每个触发事件对应一个依赖和一个提交 Workflow 的触发器，
+// 事件数据按 workflow 参数名写入对应的参数，github.event_name 为触发的事件。
+// 事件的仓库必须是 workflow 所属的仓库，否则其他仓库的事件会用本仓库的 secrets 运行其他仓库的代码
+func (c *WorkflowConverter) sensor(meta metav1.ObjectMeta, spec wfv1.WorkflowSpec) (*Sensor, *EventSource, error) {
+	if c.webhookSecret.Name == "" || c.webhookSecret.Key == "" {
+		return nil, nil, fmt.Errorf("the GitHub webhook secret of the EventSource is not configured, unsigned requests could trigger the workflow")
+	}
+	owner, repo, ok := strings.Cut(c.repository, "/")
+	if !ok || owner == "" || repo == "" {
+		return nil, nil, fmt.Errorf("the repository of workflow %s is unknown, the Sensor can only accept events of the workflow's own repository", c.githubWorkflow.Name)
+	}
+	name := templateName(c.githubWorkflow.Name)
+	sensor := &Sensor{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "argoproj.io/v1alpha1",
+			Kind:       "Sensor",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+	}
+	if c.sensorServiceAccount != "" {
+		sensor.Spec.Template = &SensorTemplate{ServiceAccountName: c.sensorServiceAccount}
+	}
+
+	var events []string
+	for _, event := range sensorEvents {
+		filter, ok, err := workflowEventFilter(c.githubWorkflow, event)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		events = append(events, event)
+		dependencies, err := eventDependencies(event, filter, c.repository, usesSecrets(spec))
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, dep := range dependencies {
+			sensor.Spec.Dependencies = append(sensor.Spec.Dependencies, EventDependency{
+				Name:            dep.name,
+				EventSourceName: name,
+				EventName:       name,
+				Filters:         &EventDependencyFilter{Data: dep.filters},
+			})
+			sensor.Spec.Triggers = append(sensor.Spec.Triggers, Trigger{
+				Template: &TriggerTemplate{
+					Name:         dep.name,
+					Conditions:   dep.name,
+					ArgoWorkflow: eventWorkflowTrigger(event, dep.name, name, meta, spec),
+				},
+			})
+		}
+	}
+	if len(sensor.Spec.Dependencies) == 0 {
+		return nil, nil, fmt.Errorf("workflow %s is not triggered by push or pull_request", c.githubWorkflow.Name)
+	}
+
+	eventSource := &EventSource{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "argoproj.io/v1alpha1",
+			Kind:       "EventSource",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: EventSourceSpec{
+			Github: map[string]GithubEventSource{
+				name: {
+					Repositories:  []OwnedRepositories{{Owner: owner, Names: []string{repo}}},
+					Webhook:       &WebhookContext{Endpoint: "/" + name, Method: "POST", Port: sensorWebhookPort},
+					Events:        events,
+					WebhookSecret: &c.webhookSecret,
+					ContentType:   "json",
+				},
+			},
+		},
+	}
+	return sensor, eventSource, nil
+}
+
+// usesSecrets 判断 Workflow 的容器是否引用了 Kubernetes Secret
+func usesSecrets(spec wfv1.WorkflowSpec) bool {
+	for _, tmpl := range spec.Templates {
+		var containers []*corev1.Container
+		if tmpl.Container != nil {
+			containers = append(containers, tmpl.Container)
+		}
+		if tmpl.Script != nil {
+			containers = append(containers, &tmpl.Script.Container)
+		}
+		for i := range tmpl.InitContainers {
+			containers = append(containers, &tmpl.InitContainers[i].Container)
+		}
+		for i := range tmpl.Sidecars {
+			containers = append(containers, &tmpl.Sidecars[i].Container)
+		}
+		for _, container := range containers {
+			for _, env := range container.Env {
+				if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+					return true
+				}
+			}
+			for _, from := range container.EnvFrom {
+				if from.SecretRef != nil {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// eventWorkflowTrigger 创建 event 的依赖 dependency 满足时提交 Workflow 的触发器
+func eventWorkflowTrigger(event, dependency, name string, meta metav1.ObjectMeta, spec wfv1.WorkflowSpec) *ArgoWorkflowTrigger {
+	spec = *spec.DeepCopy()
+	var params []TriggerParameter
+	for i, param := range spec.Arguments.Parameters {
+		if param.Name == "github-event_name" {
+			spec.Arguments.Parameters[i].Value = wfv1.AnyStringPtr(event)
+			continue
+		}
+		src, ok := eventParameterSource(event, param.Name)
+		if !ok {
+			continue
+		}
+		src.DependencyName = dependency
+		src.Value = new(string)
+		params = append(params, TriggerParameter{
+			Src:  src,
+			Dest: fmt.Sprintf("spec.arguments.parameters.%d.value", i),
+		})
+	}
+
+	return &ArgoWorkflowTrigger{
+		Operation: "submit",
+		Source: &ArtifactLocation{
+			Resource: &wfv1.Workflow{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "argoproj.io/v1alpha1",
+					Kind:       "Workflow",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					GenerateName: name + "-",
+					Annotations:  meta.Annotations,
+				},
+				Spec: spec,
+			},
+		},
+		Parameters: params,
+	}
+}
+
+// eventParameterSource 返回 workflow 参数在 event 的 webhook 数据中的来源，github.event.* 对应请求体中的
+// 同名字段，其他 github 上下文按 GitHub 的规则由请求体计算；无法从事件得到的参数返回 false
+func eventParameterSource(event, param string) (*TriggerParameterSource, bool) {
+	if field, ok := strings.CutPrefix(param, "github-event-"); ok {
+		return &TriggerParameterSource{DataKey: "body." + strings.ReplaceAll(field, "-", ".")}, true
+	}
+
+	pullRequest := event == "pull_request"
+	switch param {
+	case "github-repository":
+		return &TriggerParameterSource{DataKey: "body.repository.full_name"}, true
+	case "github-repository_owner":
+		return &TriggerParameterSource{DataKey: "body.repository.owner.login"}, true
+	case "github-actor", "github-triggering_actor":
+		return &TriggerParameterSource{DataKey: "body.sender.login"}, true
+	case "github-sha":
+		// 与 EventContext 一样使用合并提交，PR 无法合并时使用源分支的提交
+		if pullRequest {
+			return &TriggerParameterSource{DataTemplate: "{{ if .Input.body.pull_request.merge_commit_sha }}{{ .Input.body.pull_request.merge_commit_sha }}{{ else }}{{ .Input.body.pull_request.head.sha }}{{ end }}"}, true
+		}
+		return &TriggerParameterSource{DataKey: "body.after"}, true
+	case "github-ref":
+		if pullRequest {
+			return &TriggerParameterSource{DataTemplate: "refs/pull/{{ .Input.body.number }}/merge"}, true
+		}
+		return &TriggerParameterSource{DataKey: "body.ref"}, true
+	case "github-ref_name":
+		if pullRequest {
+			return &TriggerParameterSource{DataTemplate: "{{ .Input.body.number }}/merge"}, true
+		}
+		return &TriggerParameterSource{DataTemplate: `{{ .Input.body.ref | trimPrefix "refs/heads/" | trimPrefix "refs/tags/" }}`}, true
+	case "github-ref_type":
+		if pullRequest {
+			return &TriggerParameterSource{DataTemplate: "branch"}, true
+		}
+		return &TriggerParameterSource{DataTemplate: `{{ if hasPrefix "refs/tags/" .Input.body.ref }}tag{{ else }}branch{{ end }}`}, true
+	case "github-head_ref":
+		if pullRequest {
+			return &TriggerParameterSource{DataKey: "body.pull_request.head.ref"}, true
+		}
+	case "github-base_ref":
+		if pullRequest {
+			return &TriggerParameterSource{DataKey: "body.pull_request.base.ref"}, true
+		}
+	}
+	return nil, false
+}
+
+// sensorDependency 是 Sensor 中的一个事件依赖，name 同时是依赖和触发器的名称
+type sensorDependency struct {
+	name    string
+	filters []DataFilter
+}
+
+// eventDependencies 将 event 的过滤条件转换为 Sensor 的依赖，GitHub 事件类型由请求头过滤，只接受
+// repository 的事件（GitHub 的仓库名不区分大小写）。与 GitHub 一样推送标签时不检查 paths，设置了 paths 的
+// push 对分支和标签分别生成依赖。GitHub 运行 fork 的 PR 时不提供 secrets，Sensor 无法按事件去掉 Workflow 中
+// 的 secrets，secrets 为 true 时只接受源分支在 repository 中的 PR，fork 的 PR 不会触发
+func eventDependencies(event string, filter eventFilter, repository string, secrets bool) ([]sensorDependency, error) {
+	repositoryPattern := []string{"(?i)^" + regexp.QuoteMeta(repository) + "$"}
+	filters := []DataFilter{
+		{Path: githubEventHeader, Type: "string", Value: []string{"^" + regexp.QuoteMeta(event) + "$"}},
+		{Path: "body.repository.full_name", Type: "string", Value: repositoryPattern},
+	}
+
+	if event == "push" {
+		return pushDependencies(filters, filter)
+	}
+
+	types := filter.Types
+	if len(types) == 0 {
+		types = defaultPullRequestTypes
+	}
+	actions := make([]string, 0, len(types))
+	for _, t := range types {
+		actions = append(actions, "^"+regexp.QuoteMeta(t)+"$")
+	}
+	filters = append(filters, DataFilter{Path: "body.action", Type: "string", Value: actions})
+	if secrets {
+		filters = append(filters, DataFilter{Path: headRepositoryPath, Type: "string", Value: repositoryPattern})
+	}
+
+	if len(filter.Branches) > 0 || len(filter.BranchesIgnore) > 0 {
+		include, excludes, err := refFilters("body.pull_request.base.ref", "", filter.Branches, filter.BranchesIgnore)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, DataFilter{Path: "body.pull_request.base.ref", Type: "string", Value: include})
+		filters = append(filters, excludes...)
+	}
+	// pull_request 事件中没有变更的文件列表
+	if len(filter.Paths) > 0 || len(filter.PathsIgnore) > 0 {
+		return nil, fmt.Errorf("paths filters of on.pull_request cannot be expressed as Sensor event filters because the webhook payload has no changed files, %s", sensorFilterHint)
+	}
+	return []sensorDependency{{name: event, filters: filters}}, nil
+}
+
+// pushDependencies 将 on.push 的过滤条件转换为 Sensor 的依赖，base 是事件类型的过滤器。
+// 只设置了 branches 或 tags 之一时，另一类引用的 push 不会触发 workflow
+func pushDependencies(base []DataFilter, filter eventFilter) ([]sensorDependency, error) {
+	branchFilters := len(filter.Branches) > 0 || len(filter.BranchesIgnore) > 0
+	tagFilters := len(filter.Tags) > 0 || len(filter.TagsIgnore) > 0
+	var branchValues, tagValues []string
+	var branchExcludes, tagExcludes []DataFilter
+	var err error
+	if branchFilters {
+		if branchValues, branchExcludes, err = refFilters("body.ref", "refs/heads/", filter.Branches, filter.BranchesIgnore); err != nil {
+			return nil, err
+		}
+	}
+	if tagFilters {
+		if tagValues, tagExcludes, err = refFilters("body.ref", "refs/tags/", filter.Tags, filter.TagsIgnore); err != nil {
+			return nil, err
+		}
+	}
+
+	// 没有 paths 时分支和标签的过滤条件在同一个依赖中
+	if len(filter.Paths) == 0 && len(filter.PathsIgnore) == 0 {
+		filters := append(append(base, branchExcludes...), tagExcludes...)
+		if values := append(branchValues, tagValues...); len(values) > 0 {
+			filters = append(filters, DataFilter{Path: "body.ref", Type: "string", Value: values})
+		}
+		return []sensorDependency{{name: "push", filters: filters}}, nil
+	}
+
+	// 文件列表是 JSON 数组，模式匹配其中带引号的任一文件名。过滤器只能判断是否有文件匹配，无法表达所有文件
+	// 都被忽略和排除已匹配的文件：RE2 没有否定的前瞻，“存在不匹配的文件名”不能直接写成正则表达式。这类条件
+	// 不能转换，否则 Sensor 会在 GitHub 不触发时触发，需要由 /api/v1/trigger 判断是否触发
+	if len(filter.PathsIgnore) > 0 {
+		return nil, fmt.Errorf("on.push.paths-ignore is not supported with Sensor generation, %s", sensorFilterHint)
+	}
+	if _, err := compilePatterns(filter.Paths); err != nil {
+		return nil, fmt.Errorf("invalid on.push.paths: %w", err)
+	}
+	paths := make([]string, 0, len(filter.Paths))
+	for _, pattern := range filter.Paths {
+		if strings.HasPrefix(pattern, "!") {
+			return nil, fmt.Errorf("negative pattern %s of on.push.paths is not supported with Sensor generation, %s", pattern, sensorFilterHint)
+		}
+		re, err := globPattern(pattern, `"`)
+		if err != nil {
+			return nil, fmt.Errorf("invalid on.push.paths: %w", err)
+		}
+		paths = append(paths, `"`+re+`"`)
+	}
+
+	var dependencies []sensorDependency
+	if branchFilters || !tagFilters {
+		if len(branchValues) == 0 {
+			branchValues = []string{"^refs/heads/.*$"}
+		}
+		filters := append(append([]DataFilter{}, base...), branchExcludes...)
+		filters = append(filters,
+			DataFilter{Path: "body.ref", Type: "string", Value: branchValues},
+			DataFilter{Path: commitFilesPath, Type: "string", Value: paths})
+		dependencies = append(dependencies, sensorDependency{name: "push", filters: filters})
+	}
+	if tagFilters || !branchFilters {
+		if len(tagValues) == 0 {
+			tagValues = []string{"^refs/tags/.*$"}
+		}
+		filters := append(append([]DataFilter{}, base...), tagExcludes...)
+		filters = append(filters, DataFilter{Path: "body.ref", Type: "string", Value: tagValues})
+		dependencies = append(dependencies, sensorDependency{name: "push-tags", filters: filters})
+	}
+	return dependencies, nil
+}
+
+// refFilters 将 branches 或 tags 的过滤模式转换为 path 取值的正则表达式，prefix 是引用名的前缀。
+// include 为空时匹配所有带 prefix 的引用，ignore 和以 ! 开头的模式转换为取反的过滤器。
+// 过滤器之间没有顺序，! 模式之后的模式重新包含已排除的引用时无法转换
+func refFilters(path, prefix string, include, ignore []string) ([]string, []DataFilter, error) {
+	for _, patterns := range [][]string{include, ignore} {
+		if _, err := compilePatterns(patterns); err != nil {
+			return nil, nil, err
+		}
+	}
+	var values []string
+	negated := ""
+	for _, pattern := range include {
+		if !strings.HasPrefix(pattern, "!") && negated != "" {
+			return nil, nil, fmt.Errorf("pattern %s after negative pattern %s cannot be expressed as Sensor event filters", pattern, negated)
+		}
+		if strings.HasPrefix(pattern, "!") {
+			negated = pattern
+			ignore = append(ignore, pattern[1:])
+			continue
+		}
+		re, err := filterPattern(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, "^"+regexp.QuoteMeta(prefix)+re+"$")
+	}
+	if len(values) == 0 {
+		values = []string{"^" + regexp.QuoteMeta(prefix) + ".*$"}
+	}
+
+	var excludes []DataFilter
+	for _, pattern := range ignore {
+		re, err := filterPattern(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		excludes = append(excludes, DataFilter{
+			Path:       path,
+			Type:       "string",
+			Value:      []string{"^" + regexp.QuoteMeta(prefix) + re + "$"},
+			Comparator: "!=",
+		})
+	}
+	return values, excludes, nil
+}
@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/rhysd/actionlint"
+)
+
+// parseExpression 解析 GitHub 表达式，表达式可以带也可以不带 ${{ }} 包裹
+func parseExpression(expr string) (actionlint.ExprNode, error) {
+	src := strings.TrimSpace(expr)
+	if strings.HasPrefix(src, "${{") && strings.HasSuffix(src, "}}") {
+		src = strings.TrimSpace(src[3 : len(src)-2])
+	}
+
+	// actionlint 的词法分析器以 }} 作为表达式结束标记
+	node, exprErr := actionlint.NewExprParser().Parse(actionlint.NewExprLexer(src + "}}"))
+	if exprErr != nil {
+		return nil, fmt.Errorf("invalid expression %q: %s", expr, exprErr.Message)
+	}
+	return node, nil
+}
+
+// contextPath 将 github.event.inputs.x、github['ref'] 这类上下文引用展开为属性路径，
+// 上下文名称统一为小写。不是纯属性访问的节点返回 false
+func contextPath(node actionlint.ExprNode) ([]string, bool) {
+	switch n := node.(type) {
+	case *actionlint.VariableNode:
+		return []string{strings.ToLower(n.Name)}, true
+	case *actionlint.ObjectDerefNode:
+		path, ok := contextPath(n.Receiver)
+		if !ok {
+			return nil, false
+		}
+		return append(path, n.Property), true
+	case *actionlint.IndexAccessNode:
+		index, ok := n.Index.(*actionlint.StringNode)
+		if !ok {
+			return nil, false
+		}
+		path, ok := contextPath(n.Operand)
+		if !ok {
+			return nil, false
+		}
+		return append(path, index.Value), true
+	}
+	return nil, false
+}
+
+// contextParameterName 返回运行时上下文引用对应的 workflow 参数名。
+// Argo 参数名不允许出现 '.'，因此 github.event_name 对应参数 github-event_name，
+// inputs.x 和 github.event.inputs.x 直接对应参数 x。输入名与 GitHub 一样不区分大小写，
+// 与声明的输入对应时使用声明的名称
+func (c *WorkflowConverter) contextParameterName(path []string) (string, bool) {
+	if len(path) < 2 {
+		return "", false
+	}
+
+	switch path[0] {
+	case "inputs":
+		return c.declaredInput(strings.Join(path[1:], "-")), true
+	case "github":
+		if len(path) > 3 && path[1] == "event" && path[2] == "inputs" {
+			return c.declaredInput(strings.Join(path[3:], "-")), true
+		}
+		return strings.Join(path, "-"), true
+	case "vars":
+		return strings.Join(path, "-"), true
+	}
+	return "", false
+}
+
+// declaredInput 返回 workflow_dispatch 或 workflow_call 中与 name 只有大小写不同的输入名，没有声明时返回 name
+func (c *WorkflowConverter) declaredInput(name string) string {
+	var names []string
+	if dispatch := c.githubWorkflow.WorkflowDispatchConfig(); dispatch != nil {
+		names = append(names, sortedKeys(dispatch.Inputs)...)
+	}
+	if isCallable(c.githubWorkflow) {
+		names = append(names, sortedKeys(c.githubWorkflow.WorkflowCallConfig().Inputs)...)
+	}
+	for _, declared := range names {
+		if strings.EqualFold(declared, name) {
+			return declared
+		}
+	}
+	return name
+}
+
+// workflowParameter 登记一个运行时 workflow 参数，并返回 Argo 中引用它的模板表达式
+func (c *WorkflowConverter) workflowParameter(name string) string {
+	if c.parameters == nil {
+		c.parameters = make(map[string]bool)
+	}
+	c.parameters[name] = true
+	return fmt.Sprintf("{{workflow.parameters.%s}}", name)
+}
+
+// workflowParameters 返回已登记的 workflow 参数，按名称排序，默认值为空字符串
+func (c *WorkflowConverter) workflowParameters() []wfv1.Parameter {
+	names := make([]string, 0, len(c.parameters))
+	for name := range c.parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []wfv1.Parameter
+	for _, name := range names {
+		params = append(params, wfv1.Parameter{
+			Name:  name,
+			Value: wfv1.AnyStringPtr(""),
+		})
+	}
+	return params
+}
@@ -0,0 +1,129 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// eventFilter 是 on.push 或 on.pull_request 中的过滤条件，未设置的条件为空
+type eventFilter struct {
+	Branches       []string
+	BranchesIgnore []string
+	Tags           []string
+	TagsIgnore     []string
+	Paths          []string
+	PathsIgnore    []string
+	Types          []string
+}
+
+// workflowEventFilter 返回 workflow 对 event 的过滤条件，workflow 不由 event 触发时 ok 为 false
+func workflowEventFilter(wf *model.Workflow, event string) (filter eventFilter, ok bool, err error) {
+	if !containsString(wf.On(), event) {
+		return filter, false, nil
+	}
+	raw, _ := wf.OnEvent(event).(map[string]interface{})
+	fields := map[string]*[]string{
+		"branches":        &filter.Branches,
+		"branches-ignore": &filter.BranchesIgnore,
+		"tags":            &filter.Tags,
+		"tags-ignore":     &filter.TagsIgnore,
+		"paths":           &filter.Paths,
+		"paths-ignore":    &filter.PathsIgnore,
+		"types":           &filter.Types,
+	}
+	for _, name := range sortedKeys(raw) {
+		field, known := fields[name]
+		if !known {
+			continue
+		}
+		values, err := filterValues(raw[name])
+		if err != nil {
+			return filter, false, fmt.Errorf("invalid on.%s.%s: %w", event, name, err)
+		}
+		*field = values
+	}
+	if len(filter.Branches) > 0 && len(filter.BranchesIgnore) > 0 {
+		return filter, false, fmt.Errorf("on.%s cannot use both branches and branches-ignore", event)
+	}
+	if len(filter.Tags) > 0 && len(filter.TagsIgnore) > 0 {
+		return filter, false, fmt.Errorf("on.%s cannot use both tags and tags-ignore", event)
+	}
+	if len(filter.Paths) > 0 && len(filter.PathsIgnore) > 0 {
+		return filter, false, fmt.Errorf("on.%s cannot use both paths and paths-ignore", event)
+	}
+	return filter, true, nil
+}
+
+// filterValues 将过滤条件转换为字符串列表，单个字符串视为只有一项的列表
+func filterValues(raw interface{}) ([]string, error) {
+	switch v := raw.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", item)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("must be a string or a list of strings")
+}
+
+// filterPattern 将 GitHub 的 branches、tags 和 paths 过滤模式转换为正则表达式，不含首尾锚点。
+// * 匹配除 / 以外的任意字符，** 匹配任意字符，?、+ 和 [] 与正则表达式含义相同，\ 转义特殊字符
+func filterPattern(pattern string) (string, error) {
+	return globPattern(pattern, "")
+}
+
+// globPattern 将过滤模式转换为正则表达式，通配符不匹配 exclude 中的字符
+func globPattern(pattern, exclude string) (string, error) {
+	anyChar := "."
+	if exclude != "" {
+		anyChar = "[^" + exclude + "]"
+	}
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// **/ 可以匹配零层目录
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(" + anyChar + "*/)?")
+				} else {
+					b.WriteString(anyChar + "*")
+				}
+			} else {
+				b.WriteString("[^/" + exclude + "]*")
+			}
+		case '?', '+':
+			b.WriteByte(ch)
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				return "", fmt.Errorf("invalid filter pattern %q, missing ]", pattern)
+			}
+			b.WriteString(pattern[i : i+end+1])
+			i += end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+			}
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	if _, err := regexp.Compile(b.String()); err != nil {
+		return "", fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+	}
+	return b.String(), nil
+}
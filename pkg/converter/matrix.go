@@ -0,0 +1,98 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+)
+
+// expandMatrix 返回 job 的 matrix 组合（已处理 include/exclude），非 matrix job 返回 nil
+func expandMatrix(job *model.Job) ([]map[string]interface{}, error) {
+	if job.Strategy == nil || job.Matrix() == nil {
+		return nil, nil
+	}
+
+	matrixes, err := job.GetMatrixes()
+	if err != nil {
+		return nil, err
+	}
+
+	// act 生成笛卡尔积时依赖 map 遍历顺序，这里排序保证输出稳定
+	sort.SliceStable(matrixes, func(i, j int) bool {
+		return matrixKey(matrixes[i]) < matrixKey(matrixes[j])
+	})
+
+	return matrixes, nil
+}
+
+// matrixKey 生成 matrix 组合的稳定描述，例如 "cann=8.0, python=3.9"
+func matrixKey(matrix map[string]interface{}) string {
+	keys := make([]string, 0, len(matrix))
+	for k := range matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, formatMatrixValue(matrix[k])))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// matrixTaskName 返回 matrix 组合对应的任务和模板名
+func matrixTaskName(jobName string, index int) string {
+	return fmt.Sprintf("%s-%d", jobName, index)
+}
+
+// formatMatrixValue 按 GitHub 的规则将 matrix 取值转换为字符串，对象和数组输出为 JSON
+func formatMatrixValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// applyStrategy 将 matrix 的 fail-fast 和 max-parallel 转换为扇出 DAG 的 failFast 和 parallelism，
+// 未设置时使用 Argo 的默认值：任一组合失败后不再启动新的组合，并发数不限
+func (c *WorkflowConverter) applyStrategy(template *wfv1.Template, strategy *model.Strategy) error {
+	eval := c.newEvaluator(map[string]interface{}{})
+	if strings.TrimSpace(strategy.FailFastString) != "" {
+		value, err := constantValue(eval, "fail-fast", strategy.FailFastString)
+		if err != nil {
+			return err
+		}
+		failFast, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid fail-fast %q", value)
+		}
+		template.DAG.FailFast = &failFast
+	}
+	if strings.TrimSpace(strategy.MaxParallelString) != "" {
+		value, err := constantValue(eval, "max-parallel", strategy.MaxParallelString)
+		if err != nil {
+			return err
+		}
+		parallelism, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parallelism < 1 {
+			return fmt.Errorf("invalid max-parallel %q", value)
+		}
+		template.Parallelism = &parallelism
+	}
+	return nil
+}
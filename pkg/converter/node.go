@@ -0,0 +1,259 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultNodeImage 是运行 JavaScript action 的默认镜像
+const defaultNodeImage = "node:20"
+
+// node action 的 pre、main 和 post 入口分别作为独立的 step 执行
+const (
+	nodePre  = "pre"
+	nodeMain = "main"
+	nodePost = "post"
+)
+
+// node action 运行时使用的目录和文件。工具缓存和 $GITHUB_ENV、$GITHUB_PATH 文件位于共享卷上，
+// 之后的 step 可以使用 setup-* 类 action 安装的工具
+const (
+	actionsVolume   = "actions"
+	actionsDir      = "/argus/actions"
+	runnerToolCache = "/opt/hostedtoolcache"
+	runnerTempDir   = "/tmp/argus/temp"
+	runnerEnvFile   = stepOutputsDir + "/@env"
+	runnerPathFile  = stepOutputsDir + "/@path"
+)
+
+// WithNodeImage 设置运行 JavaScript action 的 Node 镜像，默认为 node:20
+func WithNodeImage(image string) Option {
+	return func(c *WorkflowConverter) {
+		c.nodeImage = image
+	}
+}
+
+// WithActionVolume 设置包含远程 action 源码的卷，目录结构与 WithActionSource 相同。
+// 使用远程 node action 时该卷以只读方式挂载到 step 容器中
+func WithActionVolume(source corev1.VolumeSource) Option {
+	return func(c *WorkflowConverter) {
+		c.actionVolume = &source
+	}
+}
+
+// postTask 是等待在作用域内所有 step 之后执行的 post 入口
+type postTask struct {
+	// task 是 main 入口的 DAG 任务名
+	task      string
+	template  *wfv1.Template
+	condition string
+	// timeout 是 step 的 timeout-minutes 对应的秒数，post 入口同样受它限制
+	timeout int32
+}
+
+// runnerFilesScript 是注入到 sh 或 bash 的 step 脚本开头的命令，
+// 加载之前的 step 通过 $GITHUB_PATH 和 $GITHUB_ENV 添加的 PATH 和环境变量
+const runnerFilesScript = `if [ -f '` + runnerPathFile + `' ]; then
+while IFS= read -r __argus_dir; do [ -z "$__argus_dir" ] || PATH="$__argus_dir:$PATH"; done < '` + runnerPathFile + `'
+export PATH
+fi
+if [ -f '` + runnerEnvFile + `' ]; then
+eval "$(awk -v q="'" '
+function quote(s) { gsub(q, q "\"" q "\"" q, s); return q s q }
+delim != "" { if ($0 == delim) { delim = ""; if (name ~ /^[A-Za-z_][A-Za-z0-9_]*$/) print "export " name "=" quote(buf) } else { buf = started ? buf "\n" $0 : $0; started = 1 } next }
+{ i = index($0, "<<"); j = index($0, "=") }
+i > 0 && (j == 0 || i < j) { name = substr($0, 1, i - 1); delim = substr($0, i + 2); buf = ""; started = 0; next }
+j > 0 { name = substr($0, 1, j - 1); if (name ~ /^[A-Za-z_][A-Za-z0-9_]*$/) print "export " name "=" quote(substr($0, j + 1)) }
+' '` + runnerEnvFile + `')"
+fi`
+
+// runnerFilesFunction 是 job 脚本中加载 $GITHUB_ENV 和 $GITHUB_PATH 的 shell 函数，每个 step 的子 shell 开头调用
+const runnerFilesFunction = "__argus_runner_files() {\n" + runnerFilesScript + "\n}"
+
+// runnerFileVars 返回 step 写入 PATH 和环境变量的 $GITHUB_PATH 和 $GITHUB_ENV，文件在 job 的 step 之间共享
+func runnerFileVars() []corev1.EnvVar {
+	return []corev1.EnvVar{{Name: "GITHUB_ENV", Value: runnerEnvFile}, {Name: "GITHUB_PATH", Value: runnerPathFile}}
+}
+
+// nodeBootstrap 是 node action 入口的启动脚本：创建 GitHub 的命令文件，按 $GITHUB_STATE 设置
+// STATE_* 环境变量，加载之前的 step 写入的 $GITHUB_ENV 和 $GITHUB_PATH，然后加载入口模块
+const nodeBootstrap = `const fs = require("fs");
+const path = require("path");
+const { pathToFileURL } = require("url");
+
+function parse(file, set) {
+  const lines = fs.readFileSync(file, "utf8").split(/\r?\n/);
+  for (let i = 0; i < lines.length; i++) {
+    const line = lines[i], h = line.indexOf("<<"), e = line.indexOf("=");
+    if (h > 0 && (e === -1 || h < e)) {
+      const delim = line.slice(h + 2), value = [];
+      for (i++; i < lines.length && lines[i] !== delim; i++) value.push(lines[i]);
+      set(line.slice(0, h), value.join("\n"));
+    } else if (e > 0) {
+      set(line.slice(0, e), line.slice(e + 1));
+    }
+  }
+}
+
+function run(entry) {
+  for (const name of ["GITHUB_OUTPUT", "GITHUB_STATE", "GITHUB_ENV", "GITHUB_PATH"]) {
+    fs.appendFileSync(process.env[name], "");
+  }
+  fs.mkdirSync(process.env.RUNNER_TEMP, { recursive: true });
+  parse(process.env.GITHUB_STATE, (name, value) => { process.env["STATE_" + name] = value; });
+  parse(process.env.GITHUB_ENV, (name, value) => { process.env[name] = value; });
+  for (const dir of fs.readFileSync(process.env.GITHUB_PATH, "utf8").split(/\r?\n/)) {
+    if (dir) process.env.PATH = dir + path.delimiter + process.env.PATH;
+  }
+  import(pathToFileURL(entry).href).catch((err) => {
+    console.error(err);
+    process.exit(1);
+  });
+}
+`
+
+// runnerGithubContexts 是以 GITHUB_* 环境变量传给 node action 的 github 上下文
+var runnerGithubContexts = []string{"repository", "sha", "ref", "event_name", "actor", "run_id", "run_number"}
+
+// containerSteps 返回 steps 中（包括 composite action 内部）是否有 Docker step 和 node action，
+// 这两类 step 需要在独立的容器中执行
+func (c *WorkflowConverter) containerSteps(steps []*model.Step, depth int) (docker, node bool, err error) {
+	// 超过嵌套层数限制的 composite action 在展开时报错
+	if depth > maxActionDepth {
+		return false, false, nil
+	}
+	for _, step := range steps {
+		if isDockerStep(step) {
+			docker = true
+			continue
+		}
+		action, _, err := c.stepAction(step)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to load action of step %s: %w", step.String(), err)
+		}
+		switch {
+		case action == nil:
+		case action.Runs.Using.IsNode():
+			node = true
+		default:
+			innerDocker, innerNode, err := c.containerSteps(actionSteps(action), depth+1)
+			if err != nil {
+				return false, false, err
+			}
+			docker, node = docker || innerDocker, node || innerNode
+		}
+	}
+	return docker, node, nil
+}
+
+// runnerEnv 返回 node action 需要的 GITHUB_* 和 RUNNER_* 环境变量，arch 是 job 的节点架构，
+// dir 是 action 的目录，key 是 step 的输出文件名
+func runnerEnv(eval *evaluator, arch, dir, key string) (map[string]interface{}, error) {
+	env := map[string]interface{}{
+		"CI":                 "true",
+		"GITHUB_ACTIONS":     "true",
+		"GITHUB_ACTION_PATH": dir,
+		"GITHUB_WORKSPACE":   workspaceDir,
+		"GITHUB_SERVER_URL":  githubServerURL,
+		"GITHUB_API_URL":     githubAPIURL,
+		"GITHUB_OUTPUT":      stepOutputFile(key),
+		"GITHUB_STATE":       stepOutputFile(key + "@state"),
+		"GITHUB_ENV":         runnerEnvFile,
+		"GITHUB_PATH":        runnerPathFile,
+		"RUNNER_OS":          "Linux",
+		"RUNNER_ARCH":        arch,
+		"RUNNER_TEMP":        runnerTempDir,
+		"RUNNER_TOOL_CACHE":  runnerToolCache,
+	}
+	for _, name := range runnerGithubContexts {
+		value, err := eval.resolve([]string{"github", name})
+		if err != nil {
+			return nil, err
+		}
+		env["GITHUB_"+strings.ToUpper(name)] = value
+	}
+	return env, nil
+}
+
+// convertNodeStep 将 node action 的 step 转换为在 Node 镜像中执行的脚本模板，pre、main 和 post
+// 入口各生成一个模板，返回的 map 以入口名为键，main 模板名为 name。输入以 INPUT_* 环境变量传入，
+// 远程 action 的源码从 action 卷挂载
+func (c *WorkflowConverter) convertNodeStep(name, jobName, key, dir string, step *model.Step, action *model.Action, scope *stepScope, base *corev1.Container) (map[string]*wfv1.Template, error) {
+	if action.Runs.Main == "" {
+		return nil, fmt.Errorf("action %s does not define runs.main", step.Uses)
+	}
+	remote := strings.HasPrefix(dir, actionsDir+"/")
+	if remote && c.actionVolume == nil {
+		return nil, fmt.Errorf("action %s is not in the workspace, an action volume must be configured to run it", step.Uses)
+	}
+
+	jobEnv, _ := scope.eval.contexts["env"].(map[string]interface{})
+	stepEnv, err := evaluateEnv(scope.eval, jobEnv, step.Environment())
+	if err != nil {
+		return nil, err
+	}
+	eval := scope.eval.withContext("env", stepEnv)
+	inputs, err := actionInputs(step, action, eval)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := runnerEnv(eval, scope.pod.arch, dir, key)
+	if err != nil {
+		return nil, err
+	}
+
+	containerEnv := make(map[string]interface{}, len(stepEnv)+len(inputs)+len(runner))
+	for name, value := range stepEnv {
+		containerEnv[name] = value
+	}
+	for name, value := range inputs {
+		containerEnv[inputEnvName(name)] = value
+	}
+	for name, value := range runner {
+		containerEnv[name] = value
+	}
+	vars, err := envVars(containerEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	phases := make(map[string]*wfv1.Template)
+	for phase, entry := range map[string]string{nodePre: action.Runs.Pre, nodeMain: action.Runs.Main, nodePost: action.Runs.Post} {
+		if entry == "" {
+			continue
+		}
+		entryPath, err := json.Marshal(dir + "/" + entry)
+		if err != nil {
+			return nil, err
+		}
+
+		container := stepContainer(base, jobName, []string{"node"}, vars)
+		container.Image = c.nodeImage
+		if remote {
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: actionsVolume, MountPath: actionsDir, ReadOnly: true})
+			c.usesActionVolume = true
+		}
+
+		templateName, displayName := name, stepDisplayName(step)
+		if phase != nodeMain {
+			templateName = name + "-" + phase
+			displayName = strings.ToUpper(phase[:1]) + phase[1:] + " " + displayName
+		}
+		phases[phase] = &wfv1.Template{
+			Name: templateName,
+			Annotations: map[string]string{
+				string(wfv1.TemplateAnnotationDisplayName): displayName,
+			},
+			Script: &wfv1.ScriptTemplate{
+				Container: container,
+				Source:    nodeBootstrap + "run(" + string(entryPath) + ");",
+			},
+		}
+	}
+	return phases, nil
+}
@@ -0,0 +1,213 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+)
+
+// 脚本运行时保存 step 输出和 job 输出的目录，stepParamsDir 是 step 模板写出输出参数的目录
+const (
+	stepOutputsDir = "/tmp/argus/steps"
+	jobOutputsDir  = "/tmp/argus/outputs"
+	stepParamsDir  = "/tmp/argus/params"
+)
+
+// stepOutputFunction 是注入到脚本开头的 shell 函数，按 $GITHUB_OUTPUT 的格式
+// （name=value 或 name<<DELIMITER 多行写法）读取 step 输出，同名输出以最后一次写入为准
+const stepOutputFunction = `__argus_step_output() {
+[ -f "` + stepOutputsDir + `/$1" ] || return 0
+awk -v name="$2" '
+delim != "" { if ($0 == delim) { delim = ""; if (cur == name) value = buf } else { buf = started ? buf "\n" $0 : $0; started = 1 } next }
+{ i = index($0, "<<"); j = index($0, "=") }
+i > 0 && (j == 0 || i < j) { cur = substr($0, 1, i - 1); delim = substr($0, i + 2); buf = ""; started = 0; next }
+j > 0 && substr($0, 1, j - 1) == name { value = substr($0, j + 1) }
+END { printf "%s", value }
+' "` + stepOutputsDir + `/$1"
+}`
+
+// stepKey 返回 step 输出文件名，没有 id 的 step 使用序号
+func stepKey(index int, step *model.Step) string {
+	if step.ID != "" {
+		return step.ID
+	}
+	return fmt.Sprintf("__step%d", index)
+}
+
+// stepOutputFile 返回 step 的 $GITHUB_OUTPUT 文件路径
+func stepOutputFile(key string) string {
+	return stepOutputsDir + "/" + key
+}
+
+// stepOutputSetup 返回 step 执行前设置 $GITHUB_OUTPUT 的脚本
+func stepOutputSetup(key string) string {
+	file := shellQuote(stepOutputFile(key))
+	return fmt.Sprintf("mkdir -p %s && : > %s && export GITHUB_OUTPUT=%s", stepOutputsDir, file, file)
+}
+
+// stepsResolver 将 steps.<id>.outputs.<name> 解析为读取 step 输出的命令替换，
+// defined 中是当前位置之前已经执行过的 step id，prefix 是 step 输出文件名的前缀
+func stepsResolver(prefix string, defined map[string]bool) func(path []string) (interface{}, error) {
+	return func(path []string) (interface{}, error) {
+		if len(path) != 4 || path[2] != "outputs" {
+			return nil, fmt.Errorf("%s is not supported, only steps.<id>.outputs.<name> can be referenced", strings.Join(path, "."))
+		}
+		if !defined[path[1]] {
+			return nil, fmt.Errorf("step %s is not defined before it is referenced", path[1])
+		}
+		return shellValue(fmt.Sprintf("$(__argus_step_output %s %s)", shellQuote(prefix+path[1]), shellQuote(path[3]))), nil
+	}
+}
+
+// stepTask 是带 id 的 step 在 DAG 中的任务
+type stepTask struct {
+	// name 是 DAG 任务名，key 是 step 输出文件名
+	name string
+	key  string
+	// script 表示 step 由脚本模板执行，只有脚本模板可以将输出写出为输出参数
+	script bool
+	// outputs 是之后的 step 的 if 条件引用的输出
+	outputs []string
+}
+
+// outputParameter 返回 if 条件中 steps.<id>.outputs.<name> 对应的任务输出参数，并记录 step 需要写出的输出
+func (t *stepTask) outputParameter(id, output string) (string, error) {
+	if !t.script {
+		return "", fmt.Errorf("steps.%s.outputs cannot be used in if conditions, only outputs of run steps and JavaScript actions are available", id)
+	}
+	if !parameterNamePattern.MatchString(output) {
+		return "", fmt.Errorf("output %s of step %s cannot be used in if conditions, the name is not a valid parameter name", output, id)
+	}
+	if !containsString(t.outputs, output) {
+		t.outputs = append(t.outputs, output)
+	}
+	return fmt.Sprintf("{{tasks.%s.outputs.parameters.%s}}", t.name, output), nil
+}
+
+// parameterNamePattern 匹配 Argo 允许的参数名
+var parameterNamePattern = regexp.MustCompile(`^[-a-zA-Z0-9_]+$`)
+
+// exposeStepOutputs 让 step 的脚本模板在脚本结束后将 $GITHUB_OUTPUT 中的 names 写出为输出参数，未写入的输出为空字符串。
+// 脚本由原来的命令执行，失败时同样写出输出并保留退出码
+func exposeStepOutputs(template *wfv1.Template, key string, names []string) {
+	lines := []string{stepOutputFunction, `"$@"`, "__argus_status=$?", "mkdir -p " + stepParamsDir}
+	for _, name := range names {
+		file := stepParamsDir + "/" + name
+		lines = append(lines, fmt.Sprintf("__argus_step_output %s %s > %s", shellQuote(key), shellQuote(name), shellQuote(file)))
+		template.Outputs.Parameters = append(template.Outputs.Parameters, wfv1.Parameter{
+			Name:      name,
+			ValueFrom: &wfv1.ValueFrom{Path: file, Default: wfv1.AnyStringPtr("")},
+		})
+	}
+	lines = append(lines, `exit "$__argus_status"`)
+	template.Script.Command = append([]string{"sh", "-c", strings.Join(lines, "\n"), "sh"}, template.Script.Command...)
+}
+
+// needsParameterName 返回下游 job 模板中接收 needs.<job>.outputs.<name> 的输入参数名
+func needsParameterName(job, output string) string {
+	return fmt.Sprintf("needs-%s-outputs-%s", job, output)
+}
+
+// needsResolver 将 needs.<job>.outputs.<name> 解析为模板输入参数，并在 inputs 中记录
+// DAG 任务需要传入的取值 {{tasks.<job>.outputs.parameters.<name>}}
+func (c *WorkflowConverter) needsResolver(job *model.Job, inputs map[string]string) func(path []string) (interface{}, error) {
+	return func(path []string) (interface{}, error) {
+		if len(path) != 4 || path[2] != "outputs" {
+			return nil, fmt.Errorf("%s is not supported, only needs.<job>.outputs.<name> can be referenced", strings.Join(path, "."))
+		}
+		need, output := path[1], path[3]
+		if !containsString(jobNeeds(job), need) {
+			return nil, fmt.Errorf("needs.%s references a job that is not listed in needs", need)
+		}
+		outputs, err := c.jobOutputs(c.githubWorkflow.Jobs[need])
+		if err != nil {
+			return nil, err
+		}
+		if !containsString(outputs, output) {
+			return nil, fmt.Errorf("job %s does not declare output %s", need, output)
+		}
+
+		name := needsParameterName(need, output)
+		inputs[name] = fmt.Sprintf("{{tasks.%s.outputs.parameters.%s}}", need, output)
+		return runtimeValue(fmt.Sprintf("{{inputs.parameters.%s}}", name)), nil
+	}
+}
+
+// jobOutputScript 返回在所有 step 之后写出 job 输出文件的脚本
+func jobOutputScript(job *model.Job, eval *evaluator, env *scriptEnv) ([]string, error) {
+	var lines []string
+	for _, name := range sortedKeys(job.Outputs) {
+		env.secrets = false
+		word, err := eval.interpolateShellWord(job.Outputs[name], env)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate output %s: %w", name, err)
+		}
+		// 输出参数会保存在 Workflow 状态中，不能包含 secret
+		if env.secrets {
+			return nil, fmt.Errorf("output %s must not reference secrets", name)
+		}
+		lines = append(lines, fmt.Sprintf("printf '%%s' %s > %s", word, shellQuote(jobOutputsDir+"/"+name)))
+	}
+	return lines, nil
+}
+
+// jobOutputParameters 返回 job 模板的输出参数，输出文件不存在时为空字符串
+func jobOutputParameters(job *model.Job) []wfv1.Parameter {
+	var params []wfv1.Parameter
+	for _, name := range sortedKeys(job.Outputs) {
+		params = append(params, wfv1.Parameter{
+			Name: name,
+			ValueFrom: &wfv1.ValueFrom{
+				Path:    jobOutputsDir + "/" + name,
+				Default: wfv1.AnyStringPtr(""),
+			},
+		})
+	}
+	return params
+}
+
+// taskOutputParameters 返回 DAG 模板的输出参数 names，取值来自子任务 task 的同名输出
+func taskOutputParameters(names []string, task string) []wfv1.Parameter {
+	var params []wfv1.Parameter
+	for _, name := range names {
+		params = append(params, wfv1.Parameter{
+			Name: name,
+			ValueFrom: &wfv1.ValueFrom{
+				Parameter: fmt.Sprintf("{{tasks.%s.outputs.parameters.%s}}", task, name),
+			},
+		})
+	}
+	return params
+}
+
+// inputParameters 将参数名和取值转换为按名称排序的 Argo 参数列表，
+// valueOf 决定每个参数的取值，为 nil 时只声明参数
+func inputParameters(inputs map[string]string, valueOf func(name string) string) []wfv1.Parameter {
+	var params []wfv1.Parameter
+	for _, name := range sortedKeys(inputs) {
+		param := wfv1.Parameter{Name: name}
+		if valueOf != nil {
+			param.Value = wfv1.AnyStringPtr(valueOf(name))
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote 将字符串转义为 shell 单引号字符串
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
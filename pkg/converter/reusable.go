@@ -0,0 +1,284 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+)
+
+// maxWorkflowDepth 是 reusable workflow 嵌套调用的最大层数，与 GitHub 的限制相同
+const maxWorkflowDepth = 10
+
+// workflowCall 是正在展开的 reusable workflow 的调用信息
+type workflowCall struct {
+	// inputs 是被调用 workflow 的 inputs 上下文，取值在调用方 job 中求值
+	inputs map[string]interface{}
+	// secrets 是调用方传入的 secrets，键为大写的 secret 名称；inherit 为 true 时使用调用方的 secrets
+	secrets map[string]interface{}
+	inherit bool
+	// depth 是 reusable workflow 的嵌套层数
+	depth int
+}
+
+// secretsResolver 解析被调用 workflow 中的 secrets.<name>，未传入的 secret 与 GitHub 一样为空字符串
+func (w *workflowCall) secretsResolver(path []string) (interface{}, error) {
+	if len(path) != 2 {
+		return nil, fmt.Errorf("%s is not supported, only secrets.<name> can be referenced", strings.Join(path, "."))
+	}
+	if value, ok := w.secrets[strings.ToUpper(path[1])]; ok {
+		return value, nil
+	}
+	return "", nil
+}
+
+// loadReusableWorkflow 读取 job uses 引用的 reusable workflow 及其原始 YAML。本地 workflow（uses: ./path）
+// 从 WithWorkspace 或 WithWorkspaceFiles 设置的仓库文件中读取，owner/repo/path@ref 从 WithActionSource 设置的目录中的
+// owner/repo@ref/path 读取，没有对应的来源时返回错误
+func (c *WorkflowConverter) loadReusableWorkflow(uses string) (*model.Workflow, []byte, error) {
+	var source fs.FS
+	var file, origin string
+	if strings.HasPrefix(uses, "./") {
+		if c.workspace == nil {
+			return nil, nil, fmt.Errorf("local reusable workflow %s is not available, the repository files are not provided", uses)
+		}
+		source, file, origin = c.workspace, path.Clean(uses), "the repository files"
+	} else {
+		idx := strings.LastIndex(uses, "@")
+		parts := strings.SplitN(uses[:max(idx, 0)], "/", 3)
+		if idx == -1 || len(parts) != 3 {
+			return nil, nil, fmt.Errorf("invalid reusable workflow %q", uses)
+		}
+		if c.actionSource == nil {
+			return nil, nil, fmt.Errorf("reusable workflow %s is not available, no action source is configured", uses)
+		}
+		source, file, origin = c.actionSource, path.Join(parts[0]+"/"+parts[1]+"@"+uses[idx+1:], parts[2]), "the action source"
+	}
+	if !fs.ValidPath(file) {
+		return nil, nil, fmt.Errorf("invalid reusable workflow path %q", uses)
+	}
+
+	f, err := source.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, fmt.Errorf("reusable workflow %s is not found in %s", uses, origin)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open reusable workflow %s: %w", uses, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read reusable workflow %s: %w", uses, err)
+	}
+	wf, err := model.ReadWorkflow(bytes.NewReader(data), false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse reusable workflow %s: %w", uses, err)
+	}
+	if !isCallable(wf) {
+		return nil, nil, fmt.Errorf("workflow %s is not triggered by workflow_call and cannot be reused", uses)
+	}
+	return wf, data, nil
+}
+
+// jobOutputs 返回 job 声明的输出名，调用 reusable workflow 的 job 的输出是被调用 workflow 的 workflow_call 输出
+func (c *WorkflowConverter) jobOutputs(job *model.Job) ([]string, error) {
+	if job.Uses == "" {
+		return sortedKeys(job.Outputs), nil
+	}
+	called, _, err := c.loadReusableWorkflow(job.Uses)
+	if err != nil {
+		return nil, err
+	}
+	return sortedKeys(called.WorkflowCallConfig().Outputs), nil
+}
+
+// convertReusableJob 将调用 reusable workflow 的 job 展开为嵌套的 DAG 模板，被调用 workflow 的 job 模板以
+// jobName 为前缀。with 和 secrets 在调用方 job 中求值后作为被调用 workflow 的 inputs 和 secrets 上下文，
+// workflow_call 的 outputs 转换为 DAG 模板的输出参数。
+// 被调用 workflow 需要调用方的 secrets 映射、工作区卷和 uses 中指定的版本，因此不通过 templateRef 引用 WorkflowTemplate
+func (c *WorkflowConverter) convertReusableJob(jobName string, job *model.Job, eval *evaluator) ([]wfv1.Template, error) {
+	depth := 1
+	if c.call != nil {
+		depth = c.call.depth + 1
+	}
+	if depth > maxWorkflowDepth {
+		return nil, fmt.Errorf("reusable workflows are nested more than %d levels", maxWorkflowDepth)
+	}
+
+	called, source, err := c.loadReusableWorkflow(job.Uses)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := parseRawWorkflow(source)
+	if err != nil {
+		return nil, err
+	}
+	config := called.WorkflowCallConfig()
+	inputs, err := callInputs(job, config, eval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", job.Uses, err)
+	}
+	call := &workflowCall{inputs: inputs, inherit: job.InheritSecrets(), depth: depth}
+	if !call.inherit {
+		call.secrets = make(map[string]interface{})
+		secrets := job.Secrets()
+		for _, name := range sortedKeys(secrets) {
+			value, err := eval.interpolateValue(secrets[name])
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate secret %s: %w", name, err)
+			}
+			call.secrets[strings.ToUpper(name)] = value
+		}
+	}
+
+	// 被调用 workflow 的 job、env 和 defaults 只在展开期间生效
+	caller, callerRaw, callerCall := c.githubWorkflow, c.raw, c.call
+	c.githubWorkflow, c.raw, c.call = called, raw, call
+	defer func() {
+		c.githubWorkflow, c.raw, c.call = caller, callerRaw, callerCall
+	}()
+
+	templates, dag, err := c.convertJobs(jobName, jobName+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand %s: %w", job.Uses, err)
+	}
+
+	if dag.Outputs.Parameters, err = c.callOutputs(config); err != nil {
+		return nil, fmt.Errorf("failed to expand %s: %w", job.Uses, err)
+	}
+	return append(templates, dag), nil
+}
+
+// callOutputs 将 workflow_call 的 outputs 转换为执行 job 的 DAG 模板的输出参数
+func (c *WorkflowConverter) callOutputs(config *model.WorkflowCall) ([]wfv1.Parameter, error) {
+	eval := c.newEvaluator(map[string]interface{}{}).withResolver("jobs", c.jobsResolver)
+	var params []wfv1.Parameter
+	for _, name := range sortedKeys(config.Outputs) {
+		value, err := eval.interpolateValue(config.Outputs[name].Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate output %s: %w", name, err)
+		}
+		// 输出参数会保存在 Workflow 状态中，不能包含 secret
+		if _, ok := value.(secretValue); ok {
+			return nil, fmt.Errorf("output %s must not reference secrets", name)
+		}
+		params = append(params, wfv1.Parameter{
+			Name:      name,
+			ValueFrom: &wfv1.ValueFrom{Parameter: toString(value)},
+		})
+	}
+	return params, nil
+}
+
+// jobsResolver 将被调用 workflow 的 outputs 中的 jobs.<job>.outputs.<name> 解析为对应任务的输出参数
+func (c *WorkflowConverter) jobsResolver(path []string) (interface{}, error) {
+	if len(path) != 4 || path[2] != "outputs" {
+		return nil, fmt.Errorf("%s is not supported, only jobs.<job>.outputs.<name> can be referenced", strings.Join(path, "."))
+	}
+	job, ok := c.githubWorkflow.Jobs[path[1]]
+	if !ok {
+		return nil, fmt.Errorf("jobs.%s references an unknown job", path[1])
+	}
+	outputs, err := c.jobOutputs(job)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(outputs, path[3]) {
+		return nil, fmt.Errorf("job %s does not declare output %s", path[1], path[3])
+	}
+	return runtimeValue(fmt.Sprintf("{{tasks.%s.outputs.parameters.%s}}", path[1], path[3])), nil
+}
+
+// callInputs 在调用方 job 中对 with 求值，得到被调用 workflow 的 inputs 上下文。未传入的输入使用默认值，
+// 没有默认值时为对应类型的零值；缺少必需的输入或传入未声明的输入时报错
+func callInputs(job *model.Job, config *model.WorkflowCall, eval *evaluator) (map[string]interface{}, error) {
+	declared := make(map[string]string, len(config.Inputs))
+	for name := range config.Inputs {
+		declared[strings.ToLower(name)] = name
+	}
+	with := make(map[string]interface{}, len(job.With))
+	for name, value := range job.With {
+		if _, ok := declared[strings.ToLower(name)]; !ok {
+			return nil, fmt.Errorf("input %s is not defined in the called workflow", name)
+		}
+		with[strings.ToLower(name)] = value
+	}
+
+	inputs := make(map[string]interface{}, len(declared))
+	for _, key := range sortedKeys(declared) {
+		input := config.Inputs[declared[key]]
+		value, ok := with[key]
+		switch {
+		case ok:
+		case input.Required:
+			return nil, fmt.Errorf("input %s is required", declared[key])
+		case input.Default.Kind == 0:
+			value = inputZero(input.Type)
+		default:
+			value = input.Default.Value
+		}
+		if s, ok := value.(string); ok {
+			evaluated, err := eval.interpolateValue(s)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate input %s: %w", declared[key], err)
+			}
+			value = evaluated
+		}
+		typed, err := inputValue(input.Type, value)
+		if err != nil {
+			return nil, fmt.Errorf("input %s: %w", declared[key], err)
+		}
+		inputs[key] = typed
+	}
+	return inputs, nil
+}
+
+// inputZero 返回未传入且没有默认值的输入的取值
+func inputZero(inputType string) interface{} {
+	switch inputType {
+	case "boolean":
+		return false
+	case "number":
+		return 0.0
+	}
+	return ""
+}
+
+// inputValue 按输入的类型转换取值，运行时才能确定的取值保持不变
+func inputValue(inputType string, value interface{}) (interface{}, error) {
+	if _, ok := deferredRef(value); ok {
+		return value, nil
+	}
+	switch inputType {
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a boolean", value)
+	case "number":
+		switch v := value.(type) {
+		case int:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a number", value)
+	}
+	return toString(value), nil
+}
@@ -0,0 +1,114 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// secretValue 是 secrets.<name> 的引用，取值只能在运行时通过 Kubernetes Secret 注入，
+// 不会出现在生成的 Workflow 中
+type secretValue struct {
+	// Secret 是 Kubernetes Secret 名称
+	Secret string
+	// Key 是 Secret 中的键，即 GitHub secret 名称
+	Key string
+	// Optional 为 true 时 Secret 或键不存在不影响 pod 启动
+	Optional bool
+}
+
+func (s secretValue) String() string {
+	return "secrets." + s.Key
+}
+
+// keyRef 返回引用该 secret 的环境变量来源
+func (s secretValue) keyRef() *corev1.EnvVarSource {
+	ref := &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: s.Secret},
+		Key:                  s.Key,
+	}
+	if s.Optional {
+		ref.Optional = &s.Optional
+	}
+	return &corev1.EnvVarSource{SecretKeyRef: ref}
+}
+
+// WithRepository 设置 workflow 所属的仓库，格式为 owner/repo
+func WithRepository(repository string) Option {
+	return func(c *WorkflowConverter) {
+		c.repository = repository
+	}
+}
+
+// WithSecretMapping 设置 secrets 对应的 Kubernetes Secret。键为仓库（owner/repo）或组织（owner），
+// 值为 Secret 名称，仓库级别的映射优先于组织级别
+func WithSecretMapping(mapping map[string]string) Option {
+	return func(c *WorkflowConverter) {
+		c.secretMapping = mapping
+	}
+}
+
+// secretName 返回当前仓库的 secrets 所在的 Kubernetes Secret 名称
+func (c *WorkflowConverter) secretName() (string, bool) {
+	if c.repository == "" {
+		return "", false
+	}
+	if name, ok := c.secretMapping[c.repository]; ok {
+		return name, true
+	}
+	owner := strings.SplitN(c.repository, "/", 2)[0]
+	name, ok := c.secretMapping[owner]
+	return name, ok
+}
+
+// secretsResolver 将 secrets.<name> 解析为 Kubernetes Secret 引用。GitHub 的 secret 名称
+// 不区分大小写，Secret 中的键统一使用大写。GITHUB_TOKEN 由 GitHub 自动提供，与 github.token 相同
+func (c *WorkflowConverter) secretsResolver(path []string) (interface{}, error) {
+	if len(path) != 2 {
+		return nil, fmt.Errorf("%s is not supported, only secrets.<name> can be referenced", strings.Join(path, "."))
+	}
+	key := strings.ToUpper(path[1])
+	if key == "GITHUB_TOKEN" {
+		return c.githubResolver([]string{"github", "token"})
+	}
+	secret, ok := c.secretName()
+	if !ok {
+		repository := c.repository
+		if repository == "" {
+			repository = "<unknown>"
+		}
+		return nil, fmt.Errorf("secret %s is referenced but repository %s is not mapped to a Kubernetes Secret", key, repository)
+	}
+	return secretValue{Secret: secret, Key: key}, nil
+}
+
+// githubResolver 解析 github 上下文。服务地址是常量，github.token 是映射的 Kubernetes Secret 中
+// 可选的 GITHUB_TOKEN（没有映射时为空字符串），run_id 和 run_number 是 Workflow 的 uid 和创建时间，
+// 其余取值优先从 WithEventContext 设置的事件中读取，事件中没有时作为 workflow 参数在运行时传入
+func (c *WorkflowConverter) githubResolver(path []string) (interface{}, error) {
+	if len(path) == 2 {
+		if ref, ok := workflowRunRefs[path[1]]; ok {
+			return runtimeValue(ref), nil
+		}
+		switch path[1] {
+		case "server_url":
+			return githubServerURL, nil
+		case "api_url":
+			return githubAPIURL, nil
+		case "token":
+			if secret, ok := c.secretName(); ok {
+				return secretValue{Secret: secret, Key: "GITHUB_TOKEN", Optional: true}, nil
+			}
+			return "", nil
+		}
+	}
+	if value, ok := c.eventValue(path[1:]); ok {
+		return value, nil
+	}
+	name, ok := c.contextParameterName(path)
+	if !ok {
+		return nil, fmt.Errorf("context %s is not available", strings.Join(path, "."))
+	}
+	return runtimeValue(c.workflowParameter(name)), nil
+}
@@ -0,0 +1,270 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// serviceHost 是服务容器的地址，sidecar 与 job 容器共享 pod 的网络，服务名解析到本地
+const serviceHost = "127.0.0.1"
+
+// serviceNamePattern 是可以作为 sidecar 容器名的服务名
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// reservedContainerNames 是 Argo 在 pod 中使用的容器名，服务不能使用
+var reservedContainerNames = map[string]bool{"main": true, "wait": true, "init": true}
+
+// convertServices 将 job 的 services 转换为 pod 中的 sidecar，返回表达式中的 job.services 上下文。
+// 镜像求值为空的服务与 GitHub 一样不启动，options 中的 --health-* 转换为就绪探针。
+// 按 step 生成模板时服务不作为 sidecar，见 serviceTasks
+func (c *WorkflowConverter) convertServices(job *model.Job, eval *evaluator, pod *jobPod) (map[string]interface{}, error) {
+	context := make(map[string]interface{})
+	var hostnames []string
+	for _, name := range sortedKeys(job.Services) {
+		spec := job.Services[name]
+		if spec == nil {
+			continue
+		}
+		if !serviceNamePattern.MatchString(name) || reservedContainerNames[name] {
+			return nil, fmt.Errorf("service name %q is not a valid container name", name)
+		}
+
+		image, err := eval.interpolate(spec.Image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate image of service %s: %w", name, err)
+		}
+		if image == "" {
+			continue
+		}
+		if err := c.registryCredentials(image, spec.Credentials); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		env, err := evaluateEnv(eval, nil, spec.Env)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+		vars, err := envVars(env)
+		if err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		container := corev1.Container{
+			Name:  name,
+			Image: image,
+			Env:   vars,
+		}
+		ports := make(map[string]interface{}, len(spec.Ports))
+		for _, raw := range spec.Ports {
+			port, err := containerPort(raw)
+			if err != nil {
+				return nil, fmt.Errorf("service %s: %w", name, err)
+			}
+			container.Ports = append(container.Ports, port)
+			number := strconv.Itoa(int(port.ContainerPort))
+			ports[number] = number
+		}
+		for _, raw := range spec.Volumes {
+			mount, err := pod.mount(raw)
+			if err != nil {
+				return nil, fmt.Errorf("service %s: %w", name, err)
+			}
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		}
+		if err := applyServiceOptions(&container, spec.Options); err != nil {
+			return nil, fmt.Errorf("service %s: %w", name, err)
+		}
+
+		pod.sidecars = append(pod.sidecars, wfv1.UserContainer{Container: container})
+		context[name] = map[string]interface{}{
+			"id":      name,
+			"network": "",
+			"ports":   ports,
+		}
+		hostnames = append(hostnames, name)
+	}
+	if len(hostnames) > 0 {
+		pod.hostAliases = append(pod.hostAliases, corev1.HostAlias{IP: serviceHost, Hostnames: hostnames})
+	}
+	return context, nil
+}
+
+// serviceTaskName 返回运行服务的 daemon 任务名
+func serviceTaskName(name string) string {
+	return "service-" + name
+}
+
+// serviceParameter 返回 step 模板接收服务 pod IP 的输入参数名
+func serviceParameter(name string) string {
+	return "service-" + name
+}
+
+// serviceTasks 将服务转换为 job DAG 中的 daemon 任务。按 step 生成模板时每个 step 运行在自己的 pod 中，
+// 服务作为 sidecar 会随每个 step 重新启动而丢失状态，因此在 job 开始时由 daemon 任务启动一次，job 结束时停止。
+// Argo 在服务就绪后才将任务标记为 Daemoned，step 任务依赖它们并通过服务 pod 的 IP 解析服务名。
+// 服务与 step 不在同一个 pod 中，只能通过服务名访问，与 job 容器共享的命名卷也无法共享
+func (p *jobPod) serviceTasks(jobName string, base *corev1.Container, timeout int32) ([]wfv1.Template, []wfv1.DAGTask, error) {
+	p.daemons = true
+	shared := make(map[string]bool)
+	for _, mount := range base.VolumeMounts {
+		shared[mount.Name] = true
+	}
+
+	var templates []wfv1.Template
+	var tasks []wfv1.DAGTask
+	used := make(map[string]bool)
+	for _, service := range p.sidecars {
+		daemon := true
+		template := wfv1.Template{
+			Name:      jobName + "-" + serviceTaskName(service.Name),
+			Daemon:    &daemon,
+			Container: service.Container.DeepCopy(),
+		}
+		if timeout > 0 {
+			template.ActiveDeadlineSeconds = activeDeadline(timeout)
+		}
+		for _, mount := range service.VolumeMounts {
+			for _, volume := range p.volumes {
+				if volume.Name != mount.Name {
+					continue
+				}
+				if volume.EmptyDir != nil && shared[volume.Name] {
+					return nil, nil, fmt.Errorf("service %s shares volume %s with the job container, which is not possible when steps run in separate pods", service.Name, mount.MountPath)
+				}
+				template.Volumes = append(template.Volumes, *volume.DeepCopy())
+				used[volume.Name] = true
+			}
+		}
+		templates = append(templates, template)
+		tasks = append(tasks, wfv1.DAGTask{
+			Name:     serviceTaskName(service.Name),
+			Template: template.Name,
+		})
+	}
+
+	// 只有服务挂载的卷不再添加到运行 step 的 pod 中
+	volumes := p.volumes[:0]
+	for _, volume := range p.volumes {
+		if shared[volume.Name] || !used[volume.Name] {
+			volumes = append(volumes, volume)
+		}
+	}
+	p.volumes = volumes
+	return templates, tasks, nil
+}
+
+// serviceInputs 让模板声明接收服务 pod IP 的输入参数，运行 step 的 pod 中服务名解析到对应的 IP
+func (p *jobPod) serviceInputs(template *wfv1.Template) {
+	if p == nil || !p.daemons {
+		return
+	}
+	for _, service := range p.sidecars {
+		param := serviceParameter(service.Name)
+		template.Inputs.Parameters = append(template.Inputs.Parameters, wfv1.Parameter{Name: param})
+		if template.DAG == nil {
+			template.HostAliases = append(template.HostAliases, corev1.HostAlias{
+				IP:        fmt.Sprintf("{{inputs.parameters.%s}}", param),
+				Hostnames: []string{service.Name},
+			})
+		}
+	}
+}
+
+// containerPort 解析 ports 中的一项，格式为 [[ip:]host:]container[/protocol]。
+// pod 中的容器共享网络，不能将容器端口映射到其他主机端口
+func containerPort(raw string) (corev1.ContainerPort, error) {
+	spec, protocol := raw, corev1.ProtocolTCP
+	if idx := strings.LastIndex(spec, "/"); idx != -1 {
+		switch strings.ToLower(spec[idx+1:]) {
+		case "tcp":
+		case "udp":
+			protocol = corev1.ProtocolUDP
+		case "sctp":
+			protocol = corev1.ProtocolSCTP
+		default:
+			return corev1.ContainerPort{}, fmt.Errorf("invalid port %q", raw)
+		}
+		spec = spec[:idx]
+	}
+
+	parts := strings.Split(spec, ":")
+	container := parts[len(parts)-1]
+	number, err := strconv.ParseInt(container, 10, 32)
+	if err != nil || number < 1 || number > 65535 {
+		return corev1.ContainerPort{}, fmt.Errorf("invalid port %q", raw)
+	}
+	if len(parts) > 1 {
+		if host := parts[len(parts)-2]; host != "" && host != container {
+			return corev1.ContainerPort{}, fmt.Errorf("port %q maps to a different host port, containers share the pod network and are reachable on port %s", raw, container)
+		}
+	}
+	return corev1.ContainerPort{ContainerPort: int32(number), Protocol: protocol}, nil
+}
+
+// applyServiceOptions 将服务的 Docker 选项应用到容器，支持 --health-* 和 --entrypoint
+func applyServiceOptions(container *corev1.Container, options string) error {
+	opts, err := parseDockerOptions(options)
+	if err != nil {
+		return err
+	}
+
+	probe := &corev1.Probe{}
+	healthCheck := false
+	for _, opt := range opts {
+		switch opt.flag {
+		case "--entrypoint":
+			container.Command = []string{opt.value}
+		case "--health-cmd":
+			// 与 Docker 一样由 shell 执行
+			probe.Exec = &corev1.ExecAction{Command: []string{"sh", "-c", opt.value}}
+			healthCheck = true
+		case "--health-retries":
+			retries, err := strconv.ParseInt(opt.value, 10, 32)
+			if err != nil || retries < 1 {
+				return fmt.Errorf("invalid %s %q", opt.flag, opt.value)
+			}
+			probe.FailureThreshold = int32(retries)
+		case "--health-interval", "--health-timeout", "--health-start-period":
+			seconds, err := probeSeconds(opt.value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", opt.flag, opt.value, err)
+			}
+			switch opt.flag {
+			case "--health-interval":
+				probe.PeriodSeconds = seconds
+			case "--health-timeout":
+				probe.TimeoutSeconds = seconds
+			default:
+				probe.InitialDelaySeconds = seconds
+			}
+		default:
+			return fmt.Errorf("option %s is not supported", opt.flag)
+		}
+	}
+
+	if healthCheck {
+		container.ReadinessProbe = probe
+	} else if *probe != (corev1.Probe{}) {
+		return fmt.Errorf("health options require --health-cmd")
+	}
+	return nil
+}
+
+// probeSeconds 将 Docker 的时长转换为探针的秒数，不足一秒按一秒计算
+func probeSeconds(value string) (int32, error) {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("duration must be positive")
+	}
+	return int32((duration + time.Second - 1) / time.Second), nil
+}
@@ -0,0 +1,64 @@
+package converter
+
+import (
+	"fmt"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// runDefaults 返回 job 中 run step 的默认 shell 和工作目录，job 的 defaults.run 覆盖 workflow 的 defaults.run
+func (c *WorkflowConverter) runDefaults(job *model.Job) model.RunDefaults {
+	defaults := c.githubWorkflow.Defaults.Run
+	if job.Defaults.Run.Shell != "" {
+		defaults.Shell = job.Defaults.Run.Shell
+	}
+	if job.Defaults.Run.WorkingDirectory != "" {
+		defaults.WorkingDirectory = job.Defaults.Run.WorkingDirectory
+	}
+	return defaults
+}
+
+// shell 返回 run step 使用的 shell，未设置时使用作用域的 defaults.run.shell
+func (s *stepScope) shell(step *model.Step) string {
+	if step.Shell != "" || step.Run == "" {
+		return step.Shell
+	}
+	return s.defaults.Shell
+}
+
+// workingDirectory 返回 run step 的工作目录，未设置时使用作用域的 defaults.run.working-directory
+func (s *stepScope) workingDirectory(step *model.Step) string {
+	if step.WorkingDirectory != "" || step.Run == "" {
+		return step.WorkingDirectory
+	}
+	return s.defaults.WorkingDirectory
+}
+
+// shellSteps 判断 steps 中是否有不能在 job 脚本中执行的 run step，composite action 内部的 step
+// 不继承 defaults.run
+func (c *WorkflowConverter) shellSteps(steps []*model.Step, defaults model.RunDefaults, depth int) (bool, error) {
+	if depth > maxActionDepth {
+		return false, nil
+	}
+	scope := &stepScope{defaults: defaults}
+	for _, step := range steps {
+		if step.Run != "" {
+			if shell := scope.shell(step); shell != "" && shell != "sh" {
+				return true, nil
+			}
+			continue
+		}
+		action, _, err := c.stepAction(step)
+		if err != nil {
+			return false, fmt.Errorf("failed to load action of step %s: %w", step.String(), err)
+		}
+		if action == nil || action.Runs.Using.IsNode() {
+			continue
+		}
+		found, err := c.shellSteps(actionSteps(action), model.RunDefaults{}, depth+1)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
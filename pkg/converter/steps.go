@@ -0,0 +1,495 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	"gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// step 模板模式下 job 的各个 step 运行在不同的 pod 中，通过卷共享工作区。每个 job（matrix 组合）使用独立的卷，
+// 并行的 job 不会争用同一个 ReadWriteOnce 卷
+const (
+	workspaceVolume = "workspace"
+	workspaceDir    = "/workspace"
+	workspaceSize   = "10Gi"
+)
+
+// outputsTaskName 是 step 模板模式下收集 job outputs 的任务名
+const outputsTaskName = "outputs"
+
+// WorkspaceVolume 是 step 模板模式下工作区卷的配置，未设置的字段使用集群默认的存储类、ReadWriteOnce 和 10Gi
+type WorkspaceVolume struct {
+	StorageClass string                            `json:"storageClass,omitempty"`
+	AccessMode   corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+	Size         string                            `json:"size,omitempty"`
+}
+
+// WithWorkspaceVolume 设置工作区卷的存储类、访问模式和容量
+func WithWorkspaceVolume(volume WorkspaceVolume) Option {
+	return func(c *WorkflowConverter) {
+		c.workspaceVolume = volume
+	}
+}
+
+// workspaceClaims 返回按 step 生成模板的 job 使用的工作区卷声明，每个 job 一个
+func (c *WorkflowConverter) workspaceClaims() ([]corev1.PersistentVolumeClaim, error) {
+	config := c.workspaceVolume
+	size := config.Size
+	if size == "" {
+		size = workspaceSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid workspace volume size %q: %w", size, err)
+	}
+	accessMode := config.AccessMode
+	if accessMode == "" {
+		accessMode = corev1.ReadWriteOnce
+	}
+
+	claims := make([]corev1.PersistentVolumeClaim, 0, len(c.workspaceJobs))
+	for _, jobName := range c.workspaceJobs {
+		claim := corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: workspaceVolumeName(jobName),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{accessMode},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: quantity,
+					},
+				},
+			},
+		}
+		if config.StorageClass != "" {
+			claim.Spec.StorageClassName = &config.StorageClass
+		}
+		claims = append(claims, claim)
+	}
+	return claims, nil
+}
+
+// workspaceVolumeName 返回 job 的工作区卷名，卷名必须是不超过 63 个字符的 DNS 标签
+func workspaceVolumeName(jobName string) string {
+	name := strings.Trim(invalidVolumeChars.ReplaceAllString(strings.ToLower(workspaceVolume+"-"+jobName), "-"), "-")
+	if len(name) > 63 {
+		sum := sha256.Sum256([]byte(jobName))
+		name = strings.TrimRight(name[:54], "-") + "-" + hex.EncodeToString(sum[:4])
+	}
+	return name
+}
+
+// invalidVolumeChars 匹配卷名中不允许的字符
+var invalidVolumeChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// workspaceMounts 返回 job 的工作区、step 输出目录和工具缓存挂载，它们是 job 工作区卷中的子目录
+func workspaceMounts(jobName string) []corev1.VolumeMount {
+	volume := workspaceVolumeName(jobName)
+	return []corev1.VolumeMount{
+		{Name: volume, MountPath: workspaceDir, SubPath: "workspace"},
+		{Name: volume, MountPath: stepOutputsDir, SubPath: "steps"},
+		{Name: volume, MountPath: runnerToolCache, SubPath: "toolcache"},
+	}
+}
+
+// stepTaskName 返回 step 在 job DAG 中的任务名
+func stepTaskName(index int) string {
+	return fmt.Sprintf("step-%d", index)
+}
+
+// stepDisplayName 返回 step 在 Argo 界面中显示的名称
+func stepDisplayName(step *model.Step) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	if step.Run != "" {
+		return "Run " + strings.TrimSpace(strings.SplitN(strings.TrimSpace(step.Run), "\n", 2)[0])
+	}
+	return step.String()
+}
+
+// defaultShellScript 按 GitHub 未指定 shell 时的规则执行脚本：bash 存在时使用 bash -e，否则使用 sh -e。
+// 脚本文件路径作为 $0 传入
+const defaultShellScript = `if command -v bash >/dev/null 2>&1; then exec bash -e "$0"; fi; exec sh -e "$0"`
+
+// jobShellScript 与 defaultShellScript 相同，用于执行作为 $1 传入的 job 脚本
+const jobShellScript = `if command -v bash >/dev/null 2>&1; then exec bash -c "$1"; fi; exec sh -c "$1"`
+
+// powershellScript 返回按 GitHub 的模板 <shell> -command ". '{0}'" 执行脚本的命令。PowerShell 只执行扩展名为
+// .ps1 的脚本文件，而 Argo 的脚本文件没有扩展名，因此先复制为 .ps1 文件
+func powershellScript(shell string) string {
+	return `script="$(mktemp -d)/script.ps1" && cp "$0" "$script" && exec ` + shell + ` -command ". '$script'"`
+}
+
+// stepShellCommand 返回 shell 对应的脚本模板命令，Argo 会将脚本文件路径作为最后一个参数传入。
+// 内置 shell 的命令与 GitHub 的模板相同。posix 表示脚本可以通过 shell 语法读取环境变量和 step 输出
+func stepShellCommand(shell string) (command []string, posix bool, err error) {
+	switch shell {
+	case "":
+		return []string{"sh", "-c", defaultShellScript}, true, nil
+	case "sh":
+		return []string{"sh", "-e"}, true, nil
+	case "bash":
+		return []string{"bash", "--noprofile", "--norc", "-eo", "pipefail"}, true, nil
+	case "python":
+		return []string{"python"}, false, nil
+	case "pwsh", "powershell":
+		return []string{"sh", "-c", powershellScript(shell)}, false, nil
+	case "cmd":
+		// cmd 只能在 Windows runner 上运行，step 容器都是 Linux 容器
+		return nil, false, fmt.Errorf("shell cmd is not supported, it requires a Windows runner")
+	}
+
+	// 自定义 shell 形如 "perl {0}"，{0} 只能出现在最后
+	fields := strings.Fields(shell)
+	if len(fields) == 0 {
+		return nil, false, fmt.Errorf("shell %q is not supported", shell)
+	}
+	if len(fields) > 1 && fields[len(fields)-1] == "{0}" {
+		fields = fields[:len(fields)-1]
+	}
+	for _, field := range fields {
+		if strings.Contains(field, "{0}") {
+			return nil, false, fmt.Errorf("shell %q is not supported, {0} must be the last argument", shell)
+		}
+	}
+	base := path.Base(fields[0])
+	return fields, base == "sh" || base == "bash", nil
+}
+
+// shellEnvReference 返回 sh 和 bash 之外的 shell 在脚本中读取环境变量的写法。PowerShell 的 ${env:NAME}
+// 在双引号字符串中同样展开，且展开的取值不会再被解析；python 和自定义 shell 没有这样的写法，返回 nil
+func shellEnvReference(shell string) func(name string) string {
+	switch shell {
+	case "pwsh", "powershell":
+		return func(name string) string { return "${env:" + name + "}" }
+	}
+	return nil
+}
+
+// hasStepConditions 判断 steps 中是否有设置了 if 条件的 step，包括 composite action 内部的 step。
+// job 脚本按顺序执行所有命令，step 的条件需要翻译为任务的 depends/when
+func (c *WorkflowConverter) hasStepConditions(steps []*model.Step, depth int) (bool, error) {
+	if depth > maxActionDepth {
+		return false, nil
+	}
+	for _, step := range steps {
+		if strings.TrimSpace(step.If.Value) != "" {
+			return true, nil
+		}
+		action, _, err := c.stepAction(step)
+		if err != nil {
+			return false, fmt.Errorf("failed to load action of step %s: %w", step.String(), err)
+		}
+		if action == nil || action.Runs.Using.IsNode() {
+			continue
+		}
+		found, err := c.hasStepConditions(actionSteps(action), depth+1)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// convertJobToSteps 将 job 转换为 DAG 模板，每个 step 生成一个脚本模板并按顺序执行，
+// step 的 if 条件翻译为任务的 depends/when
+func (c *WorkflowConverter) convertJobToSteps(jobName string, job *model.Job, scope *stepScope, base *corev1.Container) ([]wfv1.Template, error) {
+	// 服务由 daemon 任务运行一次，所有 step 共享
+	serviceTemplates, serviceTasks, err := scope.pod.serviceTasks(jobName, base, scope.timeout)
+	if err != nil {
+		return nil, err
+	}
+	templates, jobTemplate, previous, err := c.convertStepsToDAG(jobName, jobName, job.Steps, scope, base)
+	if err != nil {
+		return nil, err
+	}
+
+	// job outputs 在所有 step 成功后由单独的任务读取 step 输出并写出
+	if len(job.Outputs) > 0 {
+		env := &scriptEnv{}
+		lines, err := jobOutputScript(job, scope.eval, env)
+		if err != nil {
+			return nil, err
+		}
+		source := strings.Join(append([]string{stepOutputFunction, "mkdir -p " + jobOutputsDir}, lines...), "\n")
+
+		template := wfv1.Template{
+			Name: jobName + "-" + outputsTaskName,
+			Script: &wfv1.ScriptTemplate{
+				Container: stepContainer(base, jobName, []string{"sh", "-e"}, env.vars),
+				Source:    source,
+			},
+		}
+		template.Outputs.Parameters = jobOutputParameters(job)
+		templates = append(templates, template)
+
+		cond, err := c.translateStepCondition(&model.Step{}, previous, scope)
+		if err != nil {
+			return nil, err
+		}
+		jobTemplate.DAG.Tasks = append(jobTemplate.DAG.Tasks, wfv1.DAGTask{
+			Name:     outputsTaskName,
+			Template: template.Name,
+			Depends:  cond.Depends,
+		})
+		jobTemplate.Outputs.Parameters = taskOutputParameters(sortedKeys(job.Outputs), outputsTaskName)
+	}
+
+	// 没有依赖的任务等待服务就绪，其他任务经由它们间接依赖服务，都可以引用服务 pod 的 IP
+	if len(serviceTasks) > 0 {
+		ready := make([]string, 0, len(serviceTasks))
+		for _, task := range serviceTasks {
+			ready = append(ready, task.Name+".Daemoned")
+		}
+		for i := range jobTemplate.DAG.Tasks {
+			if jobTemplate.DAG.Tasks[i].Depends == "" {
+				jobTemplate.DAG.Tasks[i].Depends = strings.Join(ready, " && ")
+			}
+		}
+		jobTemplate.DAG.Tasks = append(serviceTasks, jobTemplate.DAG.Tasks...)
+		templates = append(serviceTemplates, templates...)
+	}
+
+	return append(templates, *jobTemplate), nil
+}
+
+// convertStepsToDAG 将作用域内的 steps 转换为名为 name 的 DAG 模板，返回各 step 的模板、DAG 模板
+// 以及 DAG 中已添加的任务名。node action 的 post 入口与 GitHub 一样在所有 step 之后逆序执行
+func (c *WorkflowConverter) convertStepsToDAG(name, jobName string, steps []*model.Step, scope *stepScope, base *corev1.Container) ([]wfv1.Template, *wfv1.Template, []string, error) {
+	dag := &wfv1.Template{
+		Name: name,
+		DAG:  &wfv1.DAGTemplate{},
+	}
+	var templates []wfv1.Template
+	var previous []string
+	var posts []postTask
+
+	for i, step := range steps {
+		action, dir, err := c.stepAction(step)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert step %s: %w", step.String(), err)
+		}
+
+		taskName := stepTaskName(i)
+		templateName := name + "-" + taskName
+		cond, err := c.translateStepCondition(step, previous, scope)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert step %s: %w", step.String(), err)
+		}
+		seconds, err := scope.stepTimeout(step)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert step %s: %w", step.String(), err)
+		}
+		continued, err := continueOnError(step.RawContinueOnError, scope.eval)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert step %s: %w", step.String(), err)
+		}
+
+		var stepTemplates []wfv1.Template
+		switch {
+		case action != nil && action.Runs.Using.IsNode():
+			var phases map[string]*wfv1.Template
+			phases, err = c.convertNodeStep(templateName, jobName, scope.key(i, step), dir, step, action, scope, base)
+			if err != nil {
+				break
+			}
+			// pre 入口在 main 之前按 step 的条件执行，pre 成功后才执行 main
+			for _, phase := range phases {
+				scope.podTemplate(phase)
+			}
+			if pre := phases[nodePre]; pre != nil {
+				templates = append(templates, *pre)
+				dag.DAG.Tasks = append(dag.DAG.Tasks, wfv1.DAGTask{
+					Name:      taskName + "-" + nodePre,
+					Template:  pre.Name,
+					Depends:   cond.Depends,
+					When:      cond.When,
+					Arguments: scope.taskArguments(seconds, firstTask(dag)),
+				})
+				previous = append(previous, taskName+"-"+nodePre)
+				cond = &jobCondition{Depends: taskName + "-" + nodePre + ".Succeeded"}
+			}
+			if post := phases[nodePost]; post != nil {
+				posts = append(posts, postTask{task: taskName, template: post, condition: action.Runs.PostIf, timeout: seconds})
+			}
+			stepTemplates = []wfv1.Template{*phases[nodeMain]}
+		case action != nil:
+			stepTemplates, err = c.convertCompositeStep(templateName, jobName, scope.key(i, step), step, action, scope, base)
+		default:
+			convert := c.convertStepToTemplate
+			if isDockerStep(step) {
+				convert = c.convertDockerStep
+			}
+			var template *wfv1.Template
+			if template, err = convert(templateName, jobName, scope.key(i, step), step, scope, base); err == nil {
+				scope.podTemplate(template)
+				stepTemplates = []wfv1.Template{*template}
+			}
+		}
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert step %s: %w", step.String(), err)
+		}
+		templates = append(templates, stepTemplates...)
+
+		// 任务传入 step 剩余的运行时间
+		task := wfv1.DAGTask{
+			Name:      taskName,
+			Template:  templateName,
+			Depends:   cond.Depends,
+			When:      cond.When,
+			Arguments: scope.taskArguments(seconds, firstTask(dag)),
+		}
+		// continue-on-error 的 step 失败时不影响 job 的结果和之后的 step，之后的任务的 depends 将它的失败视为成功
+		if continued {
+			scope.continued[taskName] = true
+		}
+		dag.DAG.Tasks = append(dag.DAG.Tasks, task)
+
+		previous = append(previous, taskName)
+		scope.defined[stepKey(i, step)] = true
+		if step.ID != "" {
+			scope.tasks[step.ID] = &stepTask{
+				name:   taskName,
+				key:    scope.key(i, step),
+				script: len(stepTemplates) > 0 && stepTemplates[0].Name == templateName && stepTemplates[0].Script != nil,
+			}
+		}
+	}
+
+	// post 只在 main 执行过时按 post-if 执行
+	for i := len(posts) - 1; i >= 0; i-- {
+		post := posts[i]
+		cond, err := c.translateStepCondition(&model.Step{If: yaml.Node{Value: post.condition}}, previous, scope)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to convert post-if of step %s: %w", post.task, err)
+		}
+		depends := taskResult(post.task, "Succeeded", "Failed", "Errored").expr
+		if cond.Depends != "" {
+			depends = fmt.Sprintf("(%s) && (%s)", depends, cond.Depends)
+		}
+		taskName := post.task + "-" + nodePost
+		templates = append(templates, *post.template)
+		dag.DAG.Tasks = append(dag.DAG.Tasks, wfv1.DAGTask{
+			Name:      taskName,
+			Template:  post.template.Name,
+			Depends:   depends,
+			When:      cond.When,
+			Arguments: scope.taskArguments(post.timeout, firstTask(dag)),
+		})
+		previous = append(previous, taskName)
+	}
+
+	// 之后的 step 和 post 入口的 if 条件引用的输出由 step 的模板写出为输出参数
+	for i := range templates {
+		for _, task := range scope.tasks {
+			if templates[i].Name == name+"-"+task.name && len(task.outputs) > 0 {
+				exposeStepOutputs(&templates[i], task.key, task.outputs)
+			}
+		}
+	}
+
+	// 最后一个 step 设置了 continue-on-error 时没有后续任务吸收它的失败
+	if last := len(previous) - 1; last >= 0 && scope.continued[previous[last]] {
+		task, template := continueTask(previous[last], name+"-"+previous[last])
+		templates = append(templates, template)
+		dag.DAG.Tasks = append(dag.DAG.Tasks, task)
+	}
+
+	return templates, dag, previous, nil
+}
+
+// convertStepToTemplate 将 run step 转换为脚本模板，脚本内容原样保留
+func (c *WorkflowConverter) convertStepToTemplate(name, jobName, key string, step *model.Step, scope *stepScope, base *corev1.Container) (*wfv1.Template, error) {
+	eval := scope.eval
+	command, posix, err := stepShellCommand(scope.shell(step))
+	if err != nil {
+		return nil, err
+	}
+
+	containerEnv, _ := eval.contexts["env"].(map[string]interface{})
+	env := &scriptEnv{}
+	var source string
+	if posix {
+		// step env 在脚本开头导出，可以引用 step 输出
+		exports, stepEnv, err := stepEnvExports(step, eval, env)
+		if err != nil {
+			return nil, err
+		}
+		script, _, err := c.stepScript(step, eval.withContext("env", stepEnv), env)
+		if err != nil {
+			return nil, err
+		}
+
+		lines := []string{runnerFilesScript}
+		if env.readsStepOutputs {
+			lines = append(lines, stepOutputFunction)
+		}
+		source = strings.Join(append(append(lines, exports...), script), "\n")
+	} else {
+		// 其他 shell 的脚本不能引用 step 输出，step env 作为容器环境变量
+		stepEnv, err := evaluateEnv(eval, containerEnv, step.Environment())
+		if err != nil {
+			return nil, err
+		}
+		// 不可信的取值不能直接拼接进脚本，通过环境变量传入
+		shell := scope.shell(step)
+		env.reference = shellEnvReference(shell)
+		if source, err = eval.withContext("env", stepEnv).interpolateForeignScript(step.Run, shell, env); err != nil {
+			return nil, err
+		}
+		containerEnv = stepEnv
+	}
+
+	vars, err := envVars(containerEnv)
+	if err != nil {
+		return nil, err
+	}
+	vars = append(vars, corev1.EnvVar{Name: "GITHUB_OUTPUT", Value: stepOutputFile(key)})
+	vars = append(vars, runnerFileVars()...)
+	container := stepContainer(base, jobName, command, append(vars, env.vars...))
+
+	if workingDirectory := scope.workingDirectory(step); workingDirectory != "" {
+		dir, err := eval.interpolate(workingDirectory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate working-directory: %w", err)
+		}
+		if !path.IsAbs(dir) {
+			dir = path.Join(workspaceDir, dir)
+		}
+		container.WorkingDir = dir
+	}
+
+	return &wfv1.Template{
+		Name: name,
+		Annotations: map[string]string{
+			string(wfv1.TemplateAnnotationDisplayName): stepDisplayName(step),
+		},
+		Script: &wfv1.ScriptTemplate{
+			Container: container,
+			Source:    source,
+		},
+	}, nil
+}
+
+// stepContainer 基于 job 的基础容器生成 step 容器，挂载共享工作区
+func stepContainer(base *corev1.Container, jobName string, command []string, vars []corev1.EnvVar) corev1.Container {
+	container := *base.DeepCopy()
+	container.Command = command
+	container.Args = nil
+	container.WorkingDir = workspaceDir
+	container.Env = mergeEnvVars(container.Env, vars)
+	container.VolumeMounts = append(container.VolumeMounts, workspaceMounts(jobName)...)
+	return container
+}
@@ -0,0 +1,186 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// invalidNameChars 是 Kubernetes 资源名中不允许出现的字符
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// isCallable 判断 workflow 是否由 workflow_call 触发，这类 workflow 转换为 WorkflowTemplate。
+// 转换后的 workflow 中调用它的 job 在转换时展开，不引用 WorkflowTemplate
+func isCallable(wf *model.Workflow) bool {
+	return containsString(wf.On(), "workflow_call")
+}
+
+// RunTemplate 将由 workflow_call 触发的 workflow 转换为 WorkflowTemplate。workflow_call 的 inputs 是带默认值的
+// workflow 参数，同时是入口模板的输入参数，outputs 是入口模板的输出参数。入口模板可以通过 templateRef 调用，
+// 此时 volumeClaimTemplates 等 spec 级别的配置需要由调用方的 workflow 提供
+func (c *WorkflowConverter) RunTemplate() (*wfv1.WorkflowTemplate, error) {
+	if c.githubWorkflow == nil {
+		return nil, fmt.Errorf("GitHub workflow is nil")
+	}
+	if !isCallable(c.githubWorkflow) {
+		return nil, fmt.Errorf("workflow %s is not triggered by workflow_call", c.githubWorkflow.Name)
+	}
+	argoWf, err := c.Run()
+	if err != nil {
+		return nil, err
+	}
+	if err := callInputTemplates(argoWf.Spec.Templates, sortedKeys(c.githubWorkflow.WorkflowCallConfig().Inputs)); err != nil {
+		return nil, err
+	}
+
+	return &wfv1.WorkflowTemplate{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "argoproj.io/v1alpha1",
+			Kind:       "WorkflowTemplate",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        templateName(c.githubWorkflow.Name),
+			Annotations: argoWf.Annotations,
+		},
+		Spec: argoWf.Spec,
+	}, nil
+}
+
+// workflowParameterRef 匹配模板中的 workflow 参数引用，包括 {{workflow.parameters.<name>}} 和表达式中的
+// workflow.parameters.<name>、workflow.parameters['<name>']
+var workflowParameterRef = regexp.MustCompile(`workflow\.parameters(?:\.([-\w]+)|\['([^']+)'\])`)
+
+// callInputTemplates 将模板中对 workflow_call 输入的 workflow 参数引用改为模板的输入参数，并由 DAG 任务
+// 逐层传入，使入口模板不依赖 workflow 参数。提交 WorkflowTemplate 时 spec.arguments 中的参数传给入口模板
+func callInputTemplates(templates []wfv1.Template, names []string) error {
+	declared := make(map[string]bool, len(names))
+	for _, name := range names {
+		declared[name] = true
+	}
+
+	needs := make(map[string]map[string]bool, len(templates))
+	for i := range templates {
+		data, err := json.Marshal(templates[i])
+		if err != nil {
+			return fmt.Errorf("failed to marshal template %s: %w", templates[i].Name, err)
+		}
+		used := make(map[string]bool)
+		rewritten := workflowParameterRef.ReplaceAllStringFunc(string(data), func(ref string) string {
+			m := workflowParameterRef.FindStringSubmatch(ref)
+			if !declared[m[1]+m[2]] {
+				return ref
+			}
+			used[m[1]+m[2]] = true
+			return "inputs" + strings.TrimPrefix(ref, "workflow")
+		})
+		if len(used) == 0 {
+			continue
+		}
+		var template wfv1.Template
+		if err := json.Unmarshal([]byte(rewritten), &template); err != nil {
+			return fmt.Errorf("failed to unmarshal template %s: %w", templates[i].Name, err)
+		}
+		templates[i] = template
+		needs[template.Name] = used
+	}
+
+	// DAG 模板接收子任务需要的输入，直到入口模板
+	for changed := true; changed; {
+		changed = false
+		for i := range templates {
+			if templates[i].DAG == nil {
+				continue
+			}
+			for j := range templates[i].DAG.Tasks {
+				task := &templates[i].DAG.Tasks[j]
+				for _, name := range sortedKeys(needs[task.Template]) {
+					if !hasParameter(task.Arguments.Parameters, name) {
+						task.Arguments.Parameters = append(task.Arguments.Parameters, wfv1.Parameter{
+							Name:  name,
+							Value: wfv1.AnyStringPtr(fmt.Sprintf("{{inputs.parameters.%s}}", name)),
+						})
+					}
+					if needs[templates[i].Name] == nil {
+						needs[templates[i].Name] = make(map[string]bool)
+					}
+					if !needs[templates[i].Name][name] {
+						needs[templates[i].Name][name] = true
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for i := range templates {
+		var params []wfv1.Parameter
+		for _, name := range sortedKeys(needs[templates[i].Name]) {
+			if hasParameter(templates[i].Inputs.Parameters, name) {
+				return fmt.Errorf("input %s conflicts with parameter %s of template %s", name, name, templates[i].Name)
+			}
+			params = append(params, wfv1.Parameter{Name: name})
+		}
+		templates[i].Inputs.Parameters = mergeParameters(templates[i].Inputs.Parameters, params)
+	}
+	return nil
+}
+
+// hasParameter 判断 params 中是否有名为 name 的参数
+func hasParameter(params []wfv1.Parameter, name string) bool {
+	for _, param := range params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// templateName 将 workflow 名称转换为 WorkflowTemplate 的资源名
+func templateName(name string) string {
+	name = strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	if name == "" {
+		return "workflow"
+	}
+	return name
+}
+
+// callParameters 将 workflow_call 的 inputs 声明为 workflow 参数，inputs.<name> 在模板中引用同名参数。
+// 必需的输入没有默认值，提交时必须传入；boolean 类型的输入只能取 true 或 false
+func callParameters(params []wfv1.Parameter, config *model.WorkflowCall) []wfv1.Parameter {
+	index := make(map[string]int, len(params))
+	for i, param := range params {
+		index[param.Name] = i
+	}
+	for _, name := range sortedKeys(config.Inputs) {
+		input := config.Inputs[name]
+		param := wfv1.Parameter{Name: name}
+		switch {
+		case input.Required:
+		case input.Default.Kind == 0:
+			param.Value = wfv1.AnyStringPtr(toString(inputZero(input.Type)))
+		default:
+			param.Value = wfv1.AnyStringPtr(input.Default.Value)
+		}
+		if input.Type == "boolean" {
+			param.Enum = []wfv1.AnyString{"true", "false"}
+		}
+		if input.Description != "" {
+			param.Description = wfv1.AnyStringPtr(input.Description)
+		}
+
+		if i, ok := index[name]; ok {
+			params[i] = param
+		} else {
+			params = append(params, param)
+		}
+	}
+	return params
+}
@@ -0,0 +1,122 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/nektos/act/pkg/model"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// defaultTimeoutMinutes 是 GitHub 中 job 的默认超时时间
+const defaultTimeoutMinutes = 360
+
+// constantValue 在转换时对 name 字段求值，取值必须在转换时确定
+func constantValue(eval *evaluator, name, raw string) (string, error) {
+	value, err := eval.interpolate(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate %s: %w", name, err)
+	}
+	if strings.Contains(value, "{{") {
+		return "", fmt.Errorf("%s %q must be resolvable at conversion time", name, raw)
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// timeoutSeconds 将 timeout-minutes 转换为秒数，未设置时返回 def
+func timeoutSeconds(eval *evaluator, raw string, def int32) (int32, error) {
+	if strings.TrimSpace(raw) == "" {
+		return def, nil
+	}
+	value, err := constantValue(eval, "timeout-minutes", raw)
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.ParseFloat(value, 64)
+	if err != nil || minutes <= 0 || minutes*60 > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid timeout-minutes %q", value)
+	}
+	return int32(math.Ceil(minutes * 60)), nil
+}
+
+// jobTimeout 返回 job 的超时秒数，未设置 timeout-minutes 时与 GitHub 一样为 360 分钟
+func jobTimeout(job *model.Job, eval *evaluator) (int32, error) {
+	return timeoutSeconds(eval, job.TimeoutMinutes, defaultTimeoutMinutes*60)
+}
+
+// deadlineParameter 是 step 模板接收 pod 运行时间上限的输入参数，composite action 的 DAG 模板通过它接收
+// composite step 剩余的运行时间
+const deadlineParameter = "deadline"
+
+// stepTimeout 返回 step 的 timeout-minutes 对应的秒数，未设置时为 0
+func (s *stepScope) stepTimeout(step *model.Step) (int32, error) {
+	return timeoutSeconds(s.eval, step.TimeoutMinutes, 0)
+}
+
+// deadlineArgument 返回 step 任务传给模板的运行时间上限。作用域内的 step 共享作用域的运行时间：第一个任务
+// 得到作用域的全部时间，之后的任务在调度时由 Argo 表达式扣除第一个任务开始后已经过去的时间，结果不超过
+// step 自己的 timeout-minutes，即 seconds。first 是作用域 DAG 中的第一个任务，为空表示当前任务是第一个。
+// 作用域内的任务都依赖第一个任务，可以读取它的开始时间
+func (s *stepScope) deadlineArgument(seconds int32, first string) wfv1.Parameter {
+	budget := fmt.Sprintf("asInt(inputs.parameters.%s)", deadlineParameter)
+	if s.timeout > 0 {
+		budget = strconv.Itoa(int(s.timeout))
+	}
+
+	var value string
+	switch {
+	case first == "" && s.timeout > 0:
+		if seconds == 0 || seconds > s.timeout {
+			seconds = s.timeout
+		}
+		value = strconv.Itoa(int(seconds))
+	case first == "" && seconds == 0:
+		value = fmt.Sprintf("{{inputs.parameters.%s}}", deadlineParameter)
+	case first == "":
+		value = fmt.Sprintf("{{=sprig.min(%d, %s)}}", seconds, budget)
+	default:
+		remaining := fmt.Sprintf("sprig.max(1, %s - (now().Unix() - date(tasks['%s'].startedAt).Unix()))", budget, first)
+		if seconds > 0 {
+			remaining = fmt.Sprintf("sprig.min(%d, %s)", seconds, remaining)
+		}
+		value = "{{=" + remaining + "}}"
+	}
+	return wfv1.Parameter{Name: deadlineParameter, Value: wfv1.AnyStringPtr(value)}
+}
+
+// firstTask 返回 DAG 中的第一个任务名，DAG 中还没有任务时返回空字符串
+func firstTask(dag *wfv1.Template) string {
+	if len(dag.DAG.Tasks) == 0 {
+		return ""
+	}
+	return dag.DAG.Tasks[0].Name
+}
+
+// hasStepTimeouts 判断 job 中是否有 step 设置了 timeout-minutes，
+// 单独的超时需要 step 运行在自己的 pod 中
+func hasStepTimeouts(steps []*model.Step) bool {
+	for _, step := range steps {
+		if strings.TrimSpace(step.TimeoutMinutes) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// activeDeadline 返回模板的 activeDeadlineSeconds
+func activeDeadline(seconds int32) *intstr.IntOrString {
+	deadline := intstr.FromInt32(seconds)
+	return &deadline
+}
+
+// deadlineInput 让模板声明 deadline 输入参数，pod 模板的 activeDeadlineSeconds 取参数的值
+func deadlineInput(template *wfv1.Template) {
+	template.Inputs.Parameters = append(template.Inputs.Parameters, wfv1.Parameter{Name: deadlineParameter})
+	if template.DAG == nil {
+		deadline := intstr.FromString(fmt.Sprintf("{{inputs.parameters.%s}}", deadlineParameter))
+		template.ActiveDeadlineSeconds = &deadline
+	}
+}
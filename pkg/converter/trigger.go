@@ -0,0 +1,205 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nektos/act/pkg/model"
+)
+
+// TriggerEvent 是判断 workflow 是否触发的事件。push 事件的 ref 是推送的引用，pull_request 事件的 ref 是
+// 目标分支；action 是事件的活动类型，pull_request 等按 types 过滤的事件必须提供；files 是变更的文件
+type TriggerEvent struct {
+	EventName string   `json:"event_name"`
+	Ref       string   `json:"ref,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Files     []string `json:"files,omitempty"`
+}
+
+// TriggerResult 是 workflow 是否触发及其原因
+type TriggerResult struct {
+	Triggered bool   `json:"triggered"`
+	Reason    string `json:"reason"`
+}
+
+// EvaluateTrigger 按 GitHub 的规则判断 event 是否触发 workflow，依次检查事件类型、活动类型 types、
+// branches、tags 和 paths 过滤条件，过滤模式的语法与 Sensor 的事件过滤器相同
+func EvaluateTrigger(wf *model.Workflow, event TriggerEvent) (*TriggerResult, error) {
+	filter, ok, err := workflowEventFilter(wf, event.EventName)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return notTriggered("workflow is not triggered by %s, on: %s", event.EventName, strings.Join(wf.On(), ", ")), nil
+	}
+
+	types := filter.Types
+	if len(types) == 0 && event.EventName == "pull_request" {
+		types = defaultPullRequestTypes
+	}
+	// 有 types 过滤时缺少活动类型的事件不匹配，否则会绕过 types 过滤
+	if len(types) > 0 && event.Action == "" {
+		return notTriggered("activity type is empty, on.%s only triggers for types %s", event.EventName, strings.Join(types, ", ")), nil
+	}
+	if len(types) > 0 && !containsString(types, event.Action) {
+		return notTriggered("activity type %s is not in types %s", event.Action, strings.Join(types, ", ")), nil
+	}
+
+	tag := false
+	switch event.EventName {
+	case "push":
+		result, isTag, err := evaluateRefFilters(filter, event.Ref)
+		if result != nil || err != nil {
+			return result, err
+		}
+		tag = isTag
+	case "pull_request":
+		branch := strings.TrimPrefix(event.Ref, "refs/heads/")
+		if result, err := evaluateFilter("branch", branch, filter.Branches, filter.BranchesIgnore); result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	// 推送标签时不检查 paths
+	if !tag {
+		if result, err := evaluatePathFilters(filter, event.Files); result != nil || err != nil {
+			return result, err
+		}
+	}
+	return &TriggerResult{Triggered: true, Reason: fmt.Sprintf("%s matches the filters of on.%s", describeEvent(event), event.EventName)}, nil
+}
+
+// evaluateRefFilters 检查 push 的引用是否满足 branches 和 tags 过滤条件，只设置了其中一类过滤条件时
+// 另一类引用的 push 不会触发。tag 表示推送的是标签
+func evaluateRefFilters(filter eventFilter, ref string) (result *TriggerResult, tag bool, err error) {
+	branchFilters := len(filter.Branches) > 0 || len(filter.BranchesIgnore) > 0
+	tagFilters := len(filter.Tags) > 0 || len(filter.TagsIgnore) > 0
+	if name, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		if branchFilters && !tagFilters {
+			return notTriggered("tag %s is pushed but only branch filters are defined", name), true, nil
+		}
+		result, err := evaluateFilter("tag", name, filter.Tags, filter.TagsIgnore)
+		return result, true, err
+	}
+
+	name := strings.TrimPrefix(ref, "refs/heads/")
+	if tagFilters && !branchFilters {
+		return notTriggered("branch %s is pushed but only tag filters are defined", name), false, nil
+	}
+	result, err = evaluateFilter("branch", name, filter.Branches, filter.BranchesIgnore)
+	return result, false, err
+}
+
+// filterNames 是 evaluateFilter 的 kind 对应的过滤条件名
+var filterNames = map[string]string{"branch": "branches", "tag": "tags"}
+
+// evaluateFilter 检查 value 是否满足 include 或 ignore 过滤条件，满足时返回 nil。与 GitHub 一样，两者不能同时设置
+func evaluateFilter(kind, value string, include, ignore []string) (*TriggerResult, error) {
+	if len(include) > 0 && len(ignore) > 0 {
+		return nil, fmt.Errorf("cannot use both %s and %s-ignore", filterNames[kind], filterNames[kind])
+	}
+	if len(include) > 0 {
+		matcher, err := compilePatterns(include)
+		if err != nil {
+			return nil, err
+		}
+		if !matcher.match(value) {
+			return notTriggered("%s %s does not match %s", kind, value, strings.Join(include, ", ")), nil
+		}
+	}
+	if len(ignore) > 0 {
+		matcher, err := compilePatterns(ignore)
+		if err != nil {
+			return nil, err
+		}
+		if matcher.match(value) {
+			return notTriggered("%s %s is ignored by %s", kind, value, strings.Join(ignore, ", ")), nil
+		}
+	}
+	return nil, nil
+}
+
+// evaluatePathFilters 检查变更的文件是否满足 paths 和 paths-ignore，paths 需要至少一个文件匹配，
+// paths-ignore 只有所有文件都被忽略时才不触发。与 GitHub 一样，两者不能同时设置
+func evaluatePathFilters(filter eventFilter, files []string) (*TriggerResult, error) {
+	if len(filter.Paths) > 0 && len(filter.PathsIgnore) > 0 {
+		return nil, fmt.Errorf("cannot use both paths and paths-ignore")
+	}
+	if len(filter.Paths) > 0 {
+		matcher, err := compilePatterns(filter.Paths)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if matcher.match(file) {
+				return nil, nil
+			}
+		}
+		return notTriggered("no changed file matches paths %s", strings.Join(filter.Paths, ", ")), nil
+	}
+	if len(filter.PathsIgnore) > 0 && len(files) > 0 {
+		matcher, err := compilePatterns(filter.PathsIgnore)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !matcher.match(file) {
+				return nil, nil
+			}
+		}
+		return notTriggered("all changed files are ignored by paths-ignore %s", strings.Join(filter.PathsIgnore, ", ")), nil
+	}
+	return nil, nil
+}
+
+// patternMatcher 是编译后的过滤模式列表
+type patternMatcher []compiledPattern
+
+// compiledPattern 是编译后的过滤模式，negative 表示模式以 ! 开头
+type compiledPattern struct {
+	negative bool
+	re       *regexp.Regexp
+}
+
+// compilePatterns 编译过滤模式，模式无效时返回错误
+func compilePatterns(patterns []string) (patternMatcher, error) {
+	matcher := make(patternMatcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		negative := strings.HasPrefix(pattern, "!")
+		re, err := filterPattern(strings.TrimPrefix(pattern, "!"))
+		if err != nil {
+			return nil, err
+		}
+		compiled, err := regexp.Compile("^" + re + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+		}
+		matcher = append(matcher, compiledPattern{negative: negative, re: compiled})
+	}
+	return matcher, nil
+}
+
+// match 按顺序匹配过滤模式，以 ! 开头的模式排除之前匹配的值，最后一个匹配的模式决定结果
+func (m patternMatcher) match(value string) bool {
+	matched := false
+	for _, pattern := range m {
+		if pattern.re.MatchString(value) {
+			matched = !pattern.negative
+		}
+	}
+	return matched
+}
+
+// notTriggered 返回不触发的结果
+func notTriggered(format string, args ...interface{}) *TriggerResult {
+	return &TriggerResult{Reason: fmt.Sprintf(format, args...)}
+}
+
+// describeEvent 返回事件的描述，用于触发原因
+func describeEvent(event TriggerEvent) string {
+	if event.Ref == "" {
+		return event.EventName
+	}
+	return fmt.Sprintf("%s to %s", event.EventName, event.Ref)
+}
@@ -2,19 +2,82 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
 	// 替换为你的实际 module 名称
 
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
 	"github.com/gin-gonic/gin"
+	"github.com/nektos/act/pkg/model"
+	"github.com/opensourceways/argus-worker/pkg/common"
+	"github.com/opensourceways/argus-worker/pkg/converter"
 	"github.com/opensourceways/argus-worker/pkg/worker"
 )
 
+// ConversionRequest 是 JSON 格式的转换请求，repository 是 workflow 所属的仓库，用于查找 secrets 映射；
+// inputs 是手动触发时传入的 workflow_dispatch 输入，event 是触发 workflow 的事件，用于计算 github 上下文和
+// GITHUB_* 环境变量；files 是仓库中的文件，键为相对仓库根目录的路径，本地 action、本地 reusable workflow
+// 和 hashFiles() 从中读取
+type ConversionRequest struct {
+	Workflow   string                  `json:"workflow"`
+	Repository string                  `json:"repository,omitempty"`
+	Inputs     map[string]interface{}  `json:"inputs,omitempty"`
+	Event      *converter.EventContext `json:"event,omitempty"`
+	Files      map[string]string       `json:"files,omitempty"`
+}
+
+// options 返回请求中的转换选项
+func (r *ConversionRequest) options() []converter.Option {
+	var opts []converter.Option
+	if r.Repository != "" {
+		opts = append(opts, converter.WithRepository(r.Repository))
+	}
+	if r.Inputs != nil {
+		opts = append(opts, converter.WithInputs(r.Inputs))
+	}
+	if r.Event != nil {
+		opts = append(opts, converter.WithEventContext(*r.Event))
+	}
+	if len(r.Files) > 0 {
+		opts = append(opts, converter.WithWorkspaceFiles(r.Files))
+	}
+	return opts
+}
+
+// TriggerRequest 是判断 workflow 是否触发的请求
+type TriggerRequest struct {
+	Workflow string                 `json:"workflow"`
+	Event    converter.TriggerEvent `json:"event"`
+}
+
+// ApprovalRequest 是审批请求，job 为空时处理 workflow 中所有等待审批的 job
+type ApprovalRequest struct {
+	Job     string `json:"job,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ArgoClient 返回操作 Argo Workflow 的客户端，测试时可以替换
+var ArgoClient = func() (versioned.Interface, error) {
+	client, err := common.GetKubeClient("")
+	if err != nil {
+		return nil, err
+	}
+	return client.ArgoClientset, nil
+}
+
+// Config 是转换服务的配置，由 main 在启动时加载，对所有转换请求生效
+var Config = &worker.Config{}
+
 // ConversionJob 定义任务
 type ConversionJob struct {
 	Payload    []byte
+	Options    []converter.Option
 	ResultChan chan ConversionResult
 }
 
@@ -39,7 +102,7 @@ func StartWorkerPool() {
 			log.Printf("Worker %d 启动", workerID)
 			for job := range JobQueue {
 				log.Printf("Worker %d 开始处理任务", workerID)
-				convertedData, err := worker.WorkerRun(job.Payload)
+				convertedData, err := worker.WorkerRun(job.Payload, job.Options...)
 				job.ResultChan <- ConversionResult{
 					Data:  convertedData,
 					Error: err,
@@ -75,9 +138,30 @@ func HandleConversion(c *gin.Context) {
 		return
 	}
 
+	// JSON 请求体中包含 workflow 和输入，其他格式的请求体是 workflow 本身。请求中的选项覆盖服务配置
+	opts := Config.Options()
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		var req ConversionRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("解析请求体失败: %v", err),
+			})
+			return
+		}
+		if req.Workflow == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "workflow 为空",
+			})
+			return
+		}
+		body = []byte(req.Workflow)
+		opts = append(opts, req.options()...)
+	}
+
 	resultChan := make(chan ConversionResult)
 	job := ConversionJob{
 		Payload:    body,
+		Options:    opts,
 		ResultChan: resultChan,
 	}
 
@@ -94,6 +178,13 @@ func HandleConversion(c *gin.Context) {
 	log.Println("等待任务结果...")
 	result := <-resultChan
 
+	if errors.Is(result.Error, converter.ErrInvalidInput) {
+		log.Printf("输入校验失败: %v", result.Error)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("输入无效: %v", result.Error),
+		})
+		return
+	}
 	if result.Error != nil {
 		log.Printf("任务处理失败: %v", result.Error)
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
@@ -102,8 +193,212 @@ func HandleConversion(c *gin.Context) {
 		return
 	}
 
+	// 返回生成的 Argo 资源，多个资源之间以 --- 分隔，可以直接用 kubectl apply 创建
 	log.Println("任务处理成功")
-	c.Data(http.StatusOK, "application/json", []byte(result.Data))
+	c.Data(http.StatusOK, "application/yaml", []byte(result.Data))
+}
+
+// HandleSubmit 转换 workflow 并提交到 namespace 中，workflow 设置了 concurrency 的 cancel-in-progress 时
+// 先终止同组中仍在运行的旧 workflow。提交者通过 Authorization: Bearer <token> 认证，只能提交到配置的
+// namespace 中，workflow 所属的仓库由提交者的配置确定，请求中的仓库与其不同时拒绝提交
+func HandleSubmit(c *gin.Context) {
+	if len(Config.Submitters) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "未配置提交者",
+		})
+		return
+	}
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	submitterName, submitter, ok := Config.Submitter(strings.TrimSpace(token))
+	if !found || !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "提交者认证失败",
+		})
+		return
+	}
+	namespace := c.Param("namespace")
+	if namespace != submitter.Namespace {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("提交者 %s 不能提交到 namespace %s", submitterName, namespace),
+		})
+		return
+	}
+
+	var req ConversionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("解析请求体失败: %v", err),
+		})
+		return
+	}
+	if req.Workflow == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "workflow 为空",
+		})
+		return
+	}
+	// 仓库决定挂载的 Secret，只能使用提交者配置的仓库
+	if (req.Repository != "" && req.Repository != submitter.Repository) ||
+		(req.Event != nil && req.Event.Repository != "" && req.Event.Repository != submitter.Repository) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("提交者 %s 只能提交仓库 %s 的 workflow", submitterName, submitter.Repository),
+		})
+		return
+	}
+	req.Repository = submitter.Repository
+	if req.Event != nil {
+		req.Event.Repository = submitter.Repository
+	}
+
+	source := []byte(req.Workflow)
+	wf, err := model.ReadWorkflow(bytes.NewReader(source), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("解析 GitHub workflow 失败: %v", err),
+		})
+		return
+	}
+	opts := append(append([]converter.Option{converter.WithSource(source)}, Config.Options()...), req.options()...)
+	argoWf, err := converter.NewConverter(wf, opts...).Run()
+	if errors.Is(err, converter.ErrInvalidInput) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("输入无效: %v", err),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("转换 workflow 失败: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("转换失败: %v", err),
+		})
+		return
+	}
+
+	client, err := ArgoClient()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": fmt.Sprintf("连接集群失败: %v", err),
+		})
+		return
+	}
+	created, err := common.SubmitWorkflow(c.Request.Context(), client, namespace, argoWf)
+	if err != nil {
+		log.Printf("提交 workflow 到 %s 失败: %v", namespace, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error": fmt.Sprintf("提交失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"namespace": created.Namespace,
+		"name":      created.Name,
+	})
+}
+
+// HandleTrigger 按 workflow 的 on 过滤条件判断事件是否触发 workflow，并返回原因
+func HandleTrigger(c *gin.Context) {
+	var req TriggerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("解析请求体失败: %v", err),
+		})
+		return
+	}
+	if req.Workflow == "" || req.Event.EventName == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": "workflow 和 event_name 不能为空",
+		})
+		return
+	}
+
+	wf, err := model.ReadWorkflow(strings.NewReader(req.Workflow), false)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("解析 GitHub workflow 失败: %v", err),
+		})
+		return
+	}
+	result, err := converter.EvaluateTrigger(wf, req.Event)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("过滤条件无效: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// HandleApprove 审批通过等待审批的 job，恢复对应的 suspend 节点
+func HandleApprove(c *gin.Context) {
+	handleApproval(c, true)
+}
+
+// HandleReject 拒绝等待审批的 job，停止对应的 suspend 节点，依赖它的 job 不再执行
+func HandleReject(c *gin.Context) {
+	handleApproval(c, false)
+}
+
+// handleApproval 处理审批请求，审批人通过 Authorization: Bearer <token> 认证，并记录在审批节点的 message 中
+func handleApproval(c *gin.Context, approve bool) {
+	if len(Config.Approvers) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "未配置审批人",
+		})
+		return
+	}
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	approver, config, ok := Config.Approver(strings.TrimSpace(token))
+	if !found || !ok {
+		c.Header("WWW-Authenticate", "Bearer")
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "审批人认证失败",
+		})
+		return
+	}
+	namespace, name := c.Param("namespace"), c.Param("name")
+	if !config.Allows(namespace) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": fmt.Sprintf("审批人 %s 不能审批 namespace %s 中的 workflow", approver, namespace),
+		})
+		return
+	}
+
+	var req ApprovalRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("解析请求体失败: %v", err),
+			})
+			return
+		}
+	}
+
+	client, err := ArgoClient()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": fmt.Sprintf("连接集群失败: %v", err),
+		})
+		return
+	}
+	nodes, err := common.ResolveApproval(c.Request.Context(), client, namespace, name, req.Job, approve, approver, req.Message,
+		func(environments []string) bool { return Config.MayApprove(approver, environments) })
+	if err != nil {
+		log.Printf("审批 workflow %s/%s 失败: %v", namespace, name, err)
+		status := http.StatusConflict
+		if errors.Is(err, common.ErrApprovalForbidden) {
+			status = http.StatusForbidden
+		}
+		c.AbortWithStatusJSON(status, gin.H{
+			"error": fmt.Sprintf("审批失败: %v", err),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"approved": approve,
+		"approver": approver,
+		"nodes":    nodes,
+	})
 }
 
 // NewRouter 创建 Gin 路由
@@ -111,6 +406,10 @@ func NewRouter() *gin.Engine {
 	r := gin.Default()
 
 	r.POST("/api/v1/convert", HandleConversion)
+	r.POST("/api/v1/trigger", HandleTrigger)
+	r.POST("/api/v1/workflows/:namespace", HandleSubmit)
+	r.POST("/api/v1/workflows/:namespace/:name/approve", HandleApprove)
+	r.POST("/api/v1/workflows/:namespace/:name/reject", HandleReject)
 
 	return r
 }
@@ -2,10 +2,26 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	wfv1 "github.com/argoproj/argo-workflows/v3/pkg/apis/workflow/v1alpha1"
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned"
+	"github.com/argoproj/argo-workflows/v3/pkg/client/clientset/versioned/fake"
+	"github.com/opensourceways/argus-worker/pkg/common"
+	"github.com/opensourceways/argus-worker/pkg/converter"
+	"github.com/opensourceways/argus-worker/pkg/worker"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // TestNewRouter 测试 NewRouter 函数
@@ -85,3 +101,590 @@ func TestStartWorkerPool(t *testing.T) {
 		t.Errorf("JobQueue capacity = %v, want %v", cap(JobQueue), MaxQueue)
 	}
 }
+
+// TestHandleConversionInvalidInputs 测试 JSON 请求中的输入与 workflow_dispatch 声明不符时返回 400
+func TestHandleConversionInvalidInputs(t *testing.T) {
+	oldJobQueue := JobQueue
+	defer func() {
+		JobQueue = oldJobQueue
+	}()
+	StartWorkerPool()
+
+	router := NewRouter()
+	body := `{"workflow": "name: deploy\non:\n  workflow_dispatch:\n    inputs:\n      dry-run:\n        type: boolean\njobs:\n  deploy:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n", "inputs": {"dry-run": "maybe"}}`
+	req, _ := http.NewRequest("POST", "/api/v1/convert", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("HandleConversion() = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(w.Body.String(), "maybe is not a boolean") {
+		t.Errorf("HandleConversion() = %v, want to contain 'maybe is not a boolean'", w.Body.String())
+	}
+}
+
+// TestHandleConversionEmptyWorkflow 测试 JSON 请求中缺少 workflow
+func TestHandleConversionEmptyWorkflow(t *testing.T) {
+	router := NewRouter()
+	req, _ := http.NewRequest("POST", "/api/v1/convert", strings.NewReader(`{"inputs": {}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("HandleConversion() = %v, want %v", w.Code, http.StatusBadRequest)
+	}
+	if !strings.Contains(w.Body.String(), "workflow 为空") {
+		t.Errorf("HandleConversion() = %v, want to contain 'workflow 为空'", w.Body.String())
+	}
+}
+
+// TestHandleConversionSecrets 测试使用 secrets 的 workflow 按服务配置的映射转换
+func TestHandleConversionSecrets(t *testing.T) {
+	oldJobQueue, oldConfig := JobQueue, Config
+	defer func() {
+		JobQueue, Config = oldJobQueue, oldConfig
+	}()
+	StartWorkerPool()
+	Config = &worker.Config{SecretMapping: map[string]string{"openeuler": "openeuler-secrets"}}
+
+	router := NewRouter()
+	workflow := "name: publish\non: push\njobs:\n  publish:\n    runs-on: ubuntu-latest\n    container: alpine\n    steps:\n      - run: push --token ${{ secrets.TOKEN }} --gh ${{ secrets.GITHUB_TOKEN }}\n"
+	cases := []struct {
+		repository string
+		code       int
+	}{
+		{repository: "openeuler/infra", code: http.StatusOK},
+		{repository: "src-openeuler/kernel", code: http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		body, _ := json.Marshal(ConversionRequest{Workflow: workflow, Repository: tc.repository})
+		req, _ := http.NewRequest("POST", "/api/v1/convert", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("HandleConversion() for %s = %v %v, want %v", tc.repository, w.Code, w.Body.String(), tc.code)
+		}
+		// 转换成功时返回生成的 Workflow
+		if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), "name: openeuler-secrets") {
+			t.Errorf("HandleConversion() for %s = %v, want workflow using openeuler-secrets", tc.repository, w.Body.String())
+		}
+	}
+}
+
+// convertWithConfig 使用给定的服务配置转换 workflow
+func convertWithConfig(t *testing.T, config *worker.Config, workflow string) *httptest.ResponseRecorder {
+	t.Helper()
+	oldJobQueue, oldConfig := JobQueue, Config
+	defer func() {
+		JobQueue, Config = oldJobQueue, oldConfig
+	}()
+	StartWorkerPool()
+	Config = config
+
+	body, _ := json.Marshal(ConversionRequest{Workflow: workflow, Repository: "openeuler/infra"})
+	req, _ := http.NewRequest("POST", "/api/v1/convert", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, req)
+	return w
+}
+
+// TestHandleConversionActionSource 测试远程 composite action 从配置的源码目录读取
+func TestHandleConversionActionSource(t *testing.T) {
+	dir := t.TempDir()
+	action := "name: greet\ninputs:\n  who:\n    default: world\nruns:\n  using: composite\n  steps:\n    - run: echo hello-${{ inputs.who }}\n      shell: sh\n"
+	if err := os.MkdirAll(filepath.Join(dir, "openeuler/actions@v1/greet"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "openeuler/actions@v1/greet/action.yml"), []byte(action), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	workflow := "name: greet\non: push\njobs:\n  greet:\n    runs-on: ubuntu-latest\n    steps:\n      - uses: openeuler/actions/greet@v1\n        with:\n          who: argus\n"
+	w := convertWithConfig(t, &worker.Config{ActionSource: dir}, workflow)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "echo hello-") {
+		t.Errorf("HandleConversion() = %v %v, want workflow running the greet action", w.Code, w.Body.String())
+	}
+}
+
+// TestHandleConversionLocalAction 测试本地 composite action 从请求中的仓库文件读取
+func TestHandleConversionLocalAction(t *testing.T) {
+	oldJobQueue := JobQueue
+	defer func() {
+		JobQueue = oldJobQueue
+	}()
+	StartWorkerPool()
+
+	workflow := "name: greet\non: push\njobs:\n  greet:\n    runs-on: ubuntu-latest\n    steps:\n      - uses: ./.github/actions/greet\n"
+	action := "name: greet\nruns:\n  using: composite\n  steps:\n    - run: echo hello-local\n      shell: sh\n"
+	cases := []struct {
+		files map[string]string
+		code  int
+		want  string
+	}{
+		{files: map[string]string{".github/actions/greet/action.yml": action}, code: http.StatusOK, want: "echo hello-local"},
+		{files: nil, code: http.StatusInternalServerError, want: "local action ./.github/actions/greet is not available"},
+	}
+	for _, tc := range cases {
+		body, _ := json.Marshal(ConversionRequest{Workflow: workflow, Files: tc.files})
+		req, _ := http.NewRequest("POST", "/api/v1/convert", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, req)
+
+		if w.Code != tc.code || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("HandleConversion() = %v %v, want %v with %q", w.Code, w.Body.String(), tc.code, tc.want)
+		}
+	}
+}
+
+// TestHandleConversionLocalReusableWorkflow 测试本地 reusable workflow 从请求中的仓库文件读取
+func TestHandleConversionLocalReusableWorkflow(t *testing.T) {
+	oldJobQueue := JobQueue
+	defer func() {
+		JobQueue = oldJobQueue
+	}()
+	StartWorkerPool()
+
+	workflow := "name: ci\non: push\njobs:\n  build:\n    uses: ./.github/workflows/build.yml\n"
+	called := "name: build\non: workflow_call\njobs:\n  make:\n    runs-on: ubuntu-latest\n    steps:\n      - run: echo hello-reusable\n"
+	cases := []struct {
+		files map[string]string
+		code  int
+		want  string
+	}{
+		{files: map[string]string{".github/workflows/build.yml": called}, code: http.StatusOK, want: "echo hello-reusable"},
+		{files: nil, code: http.StatusInternalServerError, want: "local reusable workflow ./.github/workflows/build.yml is not available"},
+	}
+	for _, tc := range cases {
+		body, _ := json.Marshal(ConversionRequest{Workflow: workflow, Files: tc.files})
+		req, _ := http.NewRequest("POST", "/api/v1/convert", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		NewRouter().ServeHTTP(w, req)
+
+		if w.Code != tc.code || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("HandleConversion() = %v %v, want %v with %q", w.Code, w.Body.String(), tc.code, tc.want)
+		}
+	}
+}
+
+// TestHandleConversionNodeAction 测试远程 node action 使用配置的 Node 镜像和 action 卷
+func TestHandleConversionNodeAction(t *testing.T) {
+	dir := t.TempDir()
+	action := "name: hello\nruns:\n  using: node20\n  main: dist/main.js\n"
+	if err := os.MkdirAll(filepath.Join(dir, "openeuler/hello@v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "openeuler/hello@v1/action.yml"), []byte(action), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &worker.Config{
+		ActionSource: dir,
+		ActionVolume: &corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "argus-actions"}},
+		NodeImage:    "registry.example.com/node:22",
+	}
+	workflow := "name: hello\non: push\njobs:\n  hello:\n    runs-on: ubuntu-latest\n    steps:\n      - uses: openeuler/hello@v1\n"
+	w := convertWithConfig(t, config, workflow)
+	for _, want := range []string{"image: registry.example.com/node:22", "claimName: argus-actions"} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("HandleConversion() = %v %v, want to contain %q", w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+// TestHandleConversionImagePullSecrets 测试配置了 credentials 的 job 容器使用配置的拉取 Secret
+func TestHandleConversionImagePullSecrets(t *testing.T) {
+	workflow := "name: build\non: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    container:\n      image: ghcr.io/openeuler/builder:latest\n      credentials:\n        username: bot\n        password: ${{ secrets.GHCR_TOKEN }}\n    steps:\n      - run: make\n"
+	if w := convertWithConfig(t, &worker.Config{}, workflow); w.Code != http.StatusInternalServerError {
+		t.Errorf("HandleConversion() without pull secrets = %v, want %v", w.Code, http.StatusInternalServerError)
+	}
+
+	config := &worker.Config{
+		SecretMapping:    map[string]string{"openeuler": "openeuler-secrets"},
+		ImagePullSecrets: map[string]string{"ghcr.io": "ghcr-pull"},
+	}
+	w := convertWithConfig(t, config, workflow)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "imagePullSecrets:\n  - name: ghcr-pull") {
+		t.Errorf("HandleConversion() = %v %v, want workflow pulling with ghcr-pull", w.Code, w.Body.String())
+	}
+}
+
+// TestHandleConversionStepTemplates 测试配置了 stepTemplates 时每个 step 生成独立的模板并使用配置的工作区卷
+func TestHandleConversionStepTemplates(t *testing.T) {
+	workflow := "name: ci\non: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n      - run: make test\n"
+	if w := convertWithConfig(t, &worker.Config{}, workflow); strings.Contains(w.Body.String(), "volumeClaimTemplates") {
+		t.Errorf("HandleConversion() without stepTemplates = %v, want job script", w.Body.String())
+	}
+
+	config := &worker.Config{StepTemplates: true, WorkspaceVolume: &converter.WorkspaceVolume{StorageClass: "nfs", Size: "20Gi"}}
+	w := convertWithConfig(t, config, workflow)
+	for _, want := range []string{"name: build-step-1", "name: workspace-build", "storageClassName: nfs", "storage: 20Gi"} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("HandleConversion() = %v %v, want to contain %q", w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+// TestHandleConversionEventSensor 测试配置了 eventSensor 时同时返回 Sensor 和 EventSource
+func TestHandleConversionEventSensor(t *testing.T) {
+	workflow := "name: ci\non:\n  push:\n    branches: [main]\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n"
+	if w := convertWithConfig(t, &worker.Config{}, workflow); strings.Contains(w.Body.String(), "kind: Sensor") {
+		t.Errorf("HandleConversion() without eventSensor = %v, want no Sensor", w.Body.String())
+	}
+
+	secret := corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "github-webhook"}, Key: "secret"}
+	w := convertWithConfig(t, &worker.Config{EventSensor: &worker.EventSensor{ServiceAccount: "argo-events", WebhookSecret: secret}}, workflow)
+	for _, want := range []string{"kind: Sensor", "serviceAccountName: argo-events", "kind: EventSource", "name: github-webhook", "(?i)^openeuler/infra$"} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("HandleConversion() = %v %v, want to contain %q", w.Code, w.Body.String(), want)
+		}
+	}
+
+	// 没有配置 webhook 密钥时不生成任何人都可以触发的 Sensor
+	w = convertWithConfig(t, &worker.Config{EventSensor: &worker.EventSensor{ServiceAccount: "argo-events"}}, workflow)
+	if w.Code == http.StatusOK || !strings.Contains(w.Body.String(), "webhook secret") {
+		t.Errorf("HandleConversion() without webhook secret = %v %v, want error", w.Code, w.Body.String())
+	}
+}
+
+// TestHandleConversionEnvironments 测试配置中需要审批的环境生成审批节点
+func TestHandleConversionEnvironments(t *testing.T) {
+	workflow := "name: release\non: push\njobs:\n  deploy:\n    runs-on: ubuntu-latest\n    environment: production\n    steps:\n      - run: make deploy\n"
+	if w := convertWithConfig(t, &worker.Config{}, workflow); strings.Contains(w.Body.String(), "deploy-approval") {
+		t.Errorf("HandleConversion() without environments = %v, want no approval", w.Body.String())
+	}
+
+	config := &worker.Config{Environments: map[string]converter.Environment{
+		"production": {RequireApproval: true},
+	}}
+	w := convertWithConfig(t, config, workflow)
+	for _, want := range []string{"name: deploy-approval", "suspend: {}"} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("HandleConversion() = %v %v, want to contain %q", w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+// TestHandleConversionConcurrencySemaphores 测试配置中的 concurrency 组转换为 ConfigMap 信号量
+func TestHandleConversionConcurrencySemaphores(t *testing.T) {
+	workflow := "name: ci\non: push\nconcurrency: npu\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n"
+	if w := convertWithConfig(t, &worker.Config{}, workflow); !strings.Contains(w.Body.String(), "mutexes:") {
+		t.Errorf("HandleConversion() without concurrencySemaphores = %v, want mutex", w.Body.String())
+	}
+
+	config := &worker.Config{ConcurrencySemaphores: &worker.ConcurrencySemaphores{ConfigMap: "argus-semaphores", Groups: []string{"npu"}}}
+	w := convertWithConfig(t, config, workflow)
+	for _, want := range []string{"semaphores:", "name: argus-semaphores", "key: npu"} {
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("HandleConversion() = %v %v, want to contain %q", w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+// TestHandleTrigger 测试按 workflow 的过滤条件判断事件是否触发
+func TestHandleTrigger(t *testing.T) {
+	router := NewRouter()
+	body := `{"workflow": "name: ci\non:\n  push:\n    branches: [main]\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n", "event": {"event_name": "push", "ref": "refs/heads/dev"}}`
+	req, _ := http.NewRequest("POST", "/api/v1/trigger", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("HandleTrigger() = %v, want %v", w.Code, http.StatusOK)
+	}
+	if !strings.Contains(w.Body.String(), `"triggered":false`) || !strings.Contains(w.Body.String(), "branch dev does not match main") {
+		t.Errorf("HandleTrigger() = %v, want not triggered for branch dev", w.Body.String())
+	}
+}
+
+// TestHandleSubmit 测试提交 workflow 时终止同一 concurrency 组中仍在运行的旧 workflow
+func TestHandleSubmit(t *testing.T) {
+	oldArgoClient := ArgoClient
+	defer func() {
+		ArgoClient = oldArgoClient
+	}()
+	group := "openeuler/infra/ci-refs/heads/main"
+	sum := sha256.Sum256([]byte(group))
+	running := &wfv1.Workflow{ObjectMeta: metav1.ObjectMeta{
+		Name:      "ci-old",
+		Namespace: "ci",
+		Labels:    map[string]string{common.ConcurrencyGroupLabel: hex.EncodeToString(sum[:16])},
+	}}
+	client := fake.NewSimpleClientset(running)
+	ArgoClient = func() (versioned.Interface, error) {
+		return client, nil
+	}
+	oldConfig := Config
+	defer func() {
+		Config = oldConfig
+	}()
+	token := sha256.Sum256([]byte("infra-token"))
+	Config = &worker.Config{Submitters: map[string]worker.Submitter{
+		"infra": {Token: hex.EncodeToString(token[:]), Repository: "openeuler/infra", Namespace: "ci"},
+	}}
+
+	workflow := "name: ci\non: push\nconcurrency:\n  group: ci-${{ github.ref }}\n  cancel-in-progress: true\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n"
+	body, _ := json.Marshal(ConversionRequest{
+		Workflow: workflow,
+		Event:    &converter.EventContext{EventName: "push", Payload: map[string]interface{}{"ref": "refs/heads/main"}},
+	})
+	req, _ := http.NewRequest("POST", "/api/v1/workflows/ci", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer infra-token")
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("HandleSubmit() = %v %v, want %v", w.Code, w.Body.String(), http.StatusCreated)
+	}
+	old, err := client.ArgoprojV1alpha1().Workflows("ci").Get(context.TODO(), "ci-old", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if old.Spec.Shutdown != wfv1.ShutdownStrategyTerminate {
+		t.Errorf("old workflow shutdown = %q, want %q", old.Spec.Shutdown, wfv1.ShutdownStrategyTerminate)
+	}
+}
+
+// TestHandleSubmitAuthorization 测试提交 workflow 需要提交者认证，仓库和 namespace 由提交者的配置确定
+func TestHandleSubmitAuthorization(t *testing.T) {
+	oldArgoClient := ArgoClient
+	defer func() {
+		ArgoClient = oldArgoClient
+	}()
+	client := fake.NewSimpleClientset()
+	ArgoClient = func() (versioned.Interface, error) {
+		return client, nil
+	}
+	oldConfig := Config
+	defer func() {
+		Config = oldConfig
+	}()
+	router := NewRouter()
+	workflow := "name: ci\non: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n        env:\n          TOKEN: ${{ secrets.TOKEN }}\n"
+	submit := func(namespace, auth string, request ConversionRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(request)
+		req, _ := http.NewRequest("POST", "/api/v1/workflows/"+namespace, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 没有配置提交者时拒绝所有提交
+	Config = &worker.Config{}
+	if w := submit("ci", "Bearer infra-token", ConversionRequest{Workflow: workflow}); w.Code != http.StatusForbidden {
+		t.Errorf("HandleSubmit() without submitters = %v, want %v", w.Code, http.StatusForbidden)
+	}
+
+	token := sha256.Sum256([]byte("infra-token"))
+	Config = &worker.Config{
+		SecretMapping: map[string]string{"openeuler/infra": "infra-secrets", "openeuler": "openeuler-secrets"},
+		Submitters: map[string]worker.Submitter{
+			"infra": {Token: hex.EncodeToString(token[:]), Repository: "openeuler/infra", Namespace: "ci"},
+		},
+	}
+	for _, auth := range []string{"", "infra-token", "Bearer other-token"} {
+		if w := submit("ci", auth, ConversionRequest{Workflow: workflow}); w.Code != http.StatusUnauthorized {
+			t.Errorf("HandleSubmit() with Authorization %q = %v, want %v", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+	if w := submit("kube-system", "Bearer infra-token", ConversionRequest{Workflow: workflow}); w.Code != http.StatusForbidden {
+		t.Errorf("HandleSubmit() to another namespace = %v, want %v", w.Code, http.StatusForbidden)
+	}
+	for _, request := range []ConversionRequest{
+		{Workflow: workflow, Repository: "openeuler/kernel"},
+		{Workflow: workflow, Event: &converter.EventContext{EventName: "push", Repository: "openeuler/kernel"}},
+	} {
+		if w := submit("ci", "Bearer infra-token", request); w.Code != http.StatusForbidden {
+			t.Errorf("HandleSubmit() for another repository = %v, want %v", w.Code, http.StatusForbidden)
+		}
+	}
+	if items, _ := client.ArgoprojV1alpha1().Workflows("").List(context.TODO(), metav1.ListOptions{}); len(items.Items) != 0 {
+		t.Fatalf("rejected submissions created %d workflows", len(items.Items))
+	}
+
+	// 未指定仓库时使用提交者的仓库查找 secrets 映射
+	w := submit("ci", "Bearer infra-token", ConversionRequest{Workflow: workflow})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("HandleSubmit() = %v %v, want %v", w.Code, w.Body.String(), http.StatusCreated)
+	}
+	items, err := client.ArgoprojV1alpha1().Workflows("ci").List(context.TODO(), metav1.ListOptions{})
+	if err != nil || len(items.Items) != 1 {
+		t.Fatalf("List() = %v, %v, want one workflow", items, err)
+	}
+	data, _ := json.Marshal(items.Items[0].Spec)
+	if !strings.Contains(string(data), "infra-secrets") {
+		t.Errorf("submitted workflow does not use infra-secrets: %s", data)
+	}
+}
+
+// convertWithDefaultKubeconfig 将默认 kubeconfig 指向不可连接的集群，然后转换 runs-on 需要查询集群的 workflow，
+// runs-on 的查询使用另一个不存在的 kubeconfig
+func convertWithDefaultKubeconfig(t *testing.T) {
+	t.Helper()
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	content := "apiVersion: v1\nclusters:\n- cluster:\n    server: https://127.0.0.1:1\n  name: test\ncontexts:\n- context:\n    cluster: test\n    user: test\n  name: test\ncurrent-context: test\nkind: Config\nusers:\n- name: test\n  user:\n    token: test-token\n"
+	if err := os.WriteFile(kubeconfig, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", kubeconfig)
+	common.Reset()
+	t.Cleanup(common.Reset)
+	convertWithConfig(t, &worker.Config{}, "name: ci\non: push\njobs:\n  build:\n    runs-on: ubuntu-latest\n    steps:\n      - run: make\n")
+}
+
+// TestArgoClientAfterConversion 测试转换时按其他 kubeconfig 查询集群失败后，Argo 客户端仍按默认配置创建
+func TestArgoClientAfterConversion(t *testing.T) {
+	convertWithDefaultKubeconfig(t)
+
+	client, err := ArgoClient()
+	if err != nil {
+		t.Fatalf("ArgoClient() error = %v", err)
+	}
+	if host := client.ArgoprojV1alpha1().RESTClient().Get().URL().Host; host != "127.0.0.1:1" {
+		t.Errorf("ArgoClient() host = %q, want 127.0.0.1:1", host)
+	}
+}
+
+// TestHandleApproveAfterConversion 测试转换之后审批请求使用默认 kubeconfig 的集群，而不是因为客户端初始化失败返回 503
+func TestHandleApproveAfterConversion(t *testing.T) {
+	convertWithDefaultKubeconfig(t)
+	oldConfig := Config
+	defer func() {
+		Config = oldConfig
+	}()
+	sum := sha256.Sum256([]byte("alice-token"))
+	Config = &worker.Config{Approvers: map[string]worker.Approver{"alice": {Token: hex.EncodeToString(sum[:]), Namespaces: []string{"ci"}}}}
+
+	req, _ := http.NewRequest("POST", "/api/v1/workflows/ci/release/approve", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	NewRouter().ServeHTTP(w, req)
+	// 集群不可连接，读取 workflow 失败
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "failed to get workflow release") {
+		t.Errorf("HandleApprove() = %v %v, want 409 from the cluster", w.Code, w.Body.String())
+	}
+}
+
+// TestHandleApprove 测试审批通过等待审批的 job
+func TestHandleApprove(t *testing.T) {
+	oldArgoClient := ArgoClient
+	defer func() {
+		ArgoClient = oldArgoClient
+	}()
+	client := fake.NewSimpleClientset(&wfv1.Workflow{
+		ObjectMeta: metav1.ObjectMeta{Name: "release", Namespace: "ci"},
+		Status: wfv1.WorkflowStatus{
+			Nodes: wfv1.Nodes{
+				"release-1": {
+					ID:          "release-1",
+					DisplayName: "deploy-approval",
+					Type:        wfv1.NodeTypeSuspend,
+					Phase:       wfv1.NodeRunning,
+					Inputs: &wfv1.Inputs{
+						Parameters: []wfv1.Parameter{{Name: common.ApprovalEnvironmentsParameter, Value: wfv1.AnyStringPtr(`["Production"]`)}},
+					},
+				},
+			},
+		},
+	})
+	ArgoClient = func() (versioned.Interface, error) {
+		return client, nil
+	}
+	oldConfig := Config
+	defer func() {
+		Config = oldConfig
+	}()
+	router := NewRouter()
+
+	// 没有配置审批人时拒绝所有审批请求
+	Config = &worker.Config{}
+	req, _ := http.NewRequest("POST", "/api/v1/workflows/ci/release/approve", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("HandleApprove() without approvers = %v, want %v", w.Code, http.StatusForbidden)
+	}
+
+	alice, bob := sha256.Sum256([]byte("alice-token")), sha256.Sum256([]byte("bob-token"))
+	Config = &worker.Config{
+		Approvers: map[string]worker.Approver{
+			"alice": {Token: hex.EncodeToString(alice[:]), Namespaces: []string{"ci"}},
+			"bob":   {Token: hex.EncodeToString(bob[:]), Namespaces: []string{"ci"}},
+			"carol": {Token: "unused", Namespaces: []string{"ci"}},
+		},
+		Environments: map[string]converter.Environment{"production": {RequireApproval: true, Approvers: []string{"alice"}}},
+	}
+	for _, auth := range []string{"", "alice-token", "Bearer carol-token"} {
+		req, _ = http.NewRequest("POST", "/api/v1/workflows/ci/release/approve", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("HandleApprove() with Authorization %q = %v, want %v", auth, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// 审批人只能审批配置的 namespace 中的 workflow
+	req, _ = http.NewRequest("POST", "/api/v1/workflows/prod/release/approve", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("HandleApprove() in namespace prod = %v, want %v", w.Code, http.StatusForbidden)
+	}
+
+	// 环境配置了审批人时其他审批人不能审批部署到该环境的 job
+	req, _ = http.NewRequest("POST", "/api/v1/workflows/ci/release/approve", nil)
+	req.Header.Set("Authorization", "Bearer bob-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("HandleApprove() by bob = %v %v, want %v", w.Code, w.Body.String(), http.StatusForbidden)
+	}
+
+	req, _ = http.NewRequest("POST", "/api/v1/workflows/ci/release/approve", strings.NewReader(`{"job": "deploy", "message": "lgtm"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "deploy-approval") || !strings.Contains(w.Body.String(), `"approver":"alice"`) {
+		t.Errorf("HandleApprove() = %v %v, want 200 with deploy-approval approved by alice", w.Code, w.Body.String())
+	}
+	wf, err := client.ArgoprojV1alpha1().Workflows("ci").Get(context.TODO(), "release", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if message := wf.Status.Nodes["release-1"].Message; message != "approved by alice: lgtm" {
+		t.Errorf("deploy-approval message = %q, want approved by alice: lgtm", message)
+	}
+
+	// 已经审批的 job 不能再次拒绝
+	req, _ = http.NewRequest("POST", "/api/v1/workflows/ci/release/reject", nil)
+	req.Header.Set("Authorization", "Bearer alice-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("HandleReject() = %v, want %v", w.Code, http.StatusConflict)
+	}
+}
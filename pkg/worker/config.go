@@ -0,0 +1,202 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/opensourceways/argus-worker/pkg/converter"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigEnv 是配置文件路径的环境变量，配置文件通常由 ConfigMap 挂载到容器中
+const ConfigEnv = "ARGUS_WORKER_CONFIG"
+
+// Config 是转换服务的配置，对所有转换请求生效
+type Config struct {
+	// SecretMapping 是仓库（owner/repo）或组织（owner）到 Kubernetes Secret 名称的映射
+	SecretMapping map[string]string `json:"secretMapping,omitempty"`
+	// ImagePullSecrets 是镜像仓库地址到 docker-registry 类型 Secret 名称的映射，Docker Hub 的地址为 docker.io
+	ImagePullSecrets map[string]string `json:"imagePullSecrets,omitempty"`
+	// ActionSource 是远程 action 和 reusable workflow 的源码目录，目录结构为 owner/repo@ref/path
+	ActionSource string `json:"actionSource,omitempty"`
+	// ActionVolume 是包含 ActionSource 中 action 源码的卷，远程 node action 运行时挂载到 step 容器中
+	ActionVolume *corev1.VolumeSource `json:"actionVolume,omitempty"`
+	// NodeImage 是运行 JavaScript action 的 Node 镜像
+	NodeImage string `json:"nodeImage,omitempty"`
+	// StepTemplates 为 true 时每个 step 生成独立的模板，各 step 通过 job 的工作区卷共享工作区
+	StepTemplates bool `json:"stepTemplates,omitempty"`
+	// WorkspaceVolume 是按 step 生成模板的 job 使用的工作区卷的配置
+	WorkspaceVolume *converter.WorkspaceVolume `json:"workspaceVolume,omitempty"`
+	// RunnerArch 是 runs-on 中没有架构标签时 RUNNER_ARCH 的取值，默认为 X64
+	RunnerArch string `json:"runnerArch,omitempty"`
+	// Environments 是部署环境的配置，键为环境名，需要审批的环境中的 job 在审批通过后执行
+	Environments map[string]converter.Environment `json:"environments,omitempty"`
+	// Approvers 是审批人名称到审批配置的映射，只有审批人可以审批等待审批的 job，
+	// 环境配置了 approvers 时只有其中的审批人可以审批部署到该环境的 job
+	Approvers map[string]Approver `json:"approvers,omitempty"`
+	// Submitters 是提交者名称到提交配置的映射，只有提交者可以提交 workflow，提交的仓库和 namespace 由配置确定
+	Submitters map[string]Submitter `json:"submitters,omitempty"`
+	// EventSensor 不为空时 push 和 pull_request 触发的 workflow 同时生成 Argo Events 的 Sensor 和 EventSource
+	EventSensor *EventSensor `json:"eventSensor,omitempty"`
+	// ConcurrencySemaphores 不为空时其中的 concurrency 组转换为 ConfigMap 信号量，其他组转换为互斥锁
+	ConcurrencySemaphores *ConcurrencySemaphores `json:"concurrencySemaphores,omitempty"`
+}
+
+// Approver 是审批人的配置，审批人只能审批 Namespaces 中的 workflow
+type Approver struct {
+	// Token 是审批人 Bearer token 的 SHA-256 摘要（十六进制）
+	Token      string   `json:"token"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// Submitter 是提交者的配置，提交者提交的 workflow 使用 Repository 的 secrets，只能提交到 Namespace 中
+type Submitter struct {
+	// Token 是提交者 Bearer token 的 SHA-256 摘要（十六进制）
+	Token      string `json:"token"`
+	Repository string `json:"repository"`
+	Namespace  string `json:"namespace"`
+}
+
+// EventSensor 是生成 Sensor 的配置
+type EventSensor struct {
+	// ServiceAccount 是 Sensor 提交 Workflow 使用的 ServiceAccount，为空时使用默认的 ServiceAccount
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+	// WebhookSecret 是 GitHub webhook 密钥所在的 Secret 和键，需要与仓库 webhook 配置的密钥相同
+	WebhookSecret corev1.SecretKeySelector `json:"webhookSecret"`
+}
+
+// ConcurrencySemaphores 是允许多个 workflow 同时运行的 concurrency 组的配置
+type ConcurrencySemaphores struct {
+	// ConfigMap 是信号量所在的 ConfigMap，以组名为键，值为同时运行的上限
+	ConfigMap string   `json:"configMap"`
+	Groups    []string `json:"groups"`
+}
+
+// LoadConfig 读取 YAML 或 JSON 格式的配置文件，path 为空时返回空配置
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Options 返回配置对应的转换选项
+func (c *Config) Options() []converter.Option {
+	var opts []converter.Option
+	if len(c.SecretMapping) > 0 {
+		opts = append(opts, converter.WithSecretMapping(c.SecretMapping))
+	}
+	if len(c.ImagePullSecrets) > 0 {
+		opts = append(opts, converter.WithImagePullSecrets(c.ImagePullSecrets))
+	}
+	if c.ActionSource != "" {
+		opts = append(opts, converter.WithActionSource(os.DirFS(c.ActionSource)))
+	}
+	if c.ActionVolume != nil {
+		opts = append(opts, converter.WithActionVolume(*c.ActionVolume))
+	}
+	if c.NodeImage != "" {
+		opts = append(opts, converter.WithNodeImage(c.NodeImage))
+	}
+	if c.StepTemplates {
+		opts = append(opts, converter.WithStepTemplates())
+	}
+	if c.WorkspaceVolume != nil {
+		opts = append(opts, converter.WithWorkspaceVolume(*c.WorkspaceVolume))
+	}
+	if c.RunnerArch != "" {
+		opts = append(opts, converter.WithRunnerArch(c.RunnerArch))
+	}
+	if len(c.Environments) > 0 {
+		opts = append(opts, converter.WithEnvironments(c.Environments))
+	}
+	if c.EventSensor != nil {
+		opts = append(opts, converter.WithEventSensor(c.EventSensor.ServiceAccount, c.EventSensor.WebhookSecret))
+	}
+	if c.ConcurrencySemaphores != nil {
+		opts = append(opts, converter.WithConcurrencySemaphores(c.ConcurrencySemaphores.ConfigMap, c.ConcurrencySemaphores.Groups))
+	}
+	return opts
+}
+
+// Approver 返回 token 对应的审批人及其配置，token 不属于任何审批人时 ok 为 false
+func (c *Config) Approver(token string) (name string, approver Approver, ok bool) {
+	for _, candidate := range sortedNames(c.Approvers) {
+		if tokenMatches(token, c.Approvers[candidate].Token) {
+			name, approver, ok = candidate, c.Approvers[candidate], true
+		}
+	}
+	return name, approver, ok
+}
+
+// Allows 判断审批人能否审批 namespace 中的 workflow
+func (a Approver) Allows(namespace string) bool {
+	for _, candidate := range a.Namespaces {
+		if candidate == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// MayApprove 判断审批人能否审批部署到 environments 中所有环境的 job，环境名不区分大小写
+func (c *Config) MayApprove(approver string, environments []string) bool {
+	for _, environment := range environments {
+		for name, config := range c.Environments {
+			if !strings.EqualFold(name, environment) || len(config.Approvers) == 0 {
+				continue
+			}
+			allowed := false
+			for _, candidate := range config.Approvers {
+				allowed = allowed || candidate == approver
+			}
+			if !allowed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Submitter 返回 token 对应的提交者及其配置，token 不属于任何提交者时 ok 为 false
+func (c *Config) Submitter(token string) (name string, submitter Submitter, ok bool) {
+	for _, candidate := range sortedNames(c.Submitters) {
+		if tokenMatches(token, c.Submitters[candidate].Token) {
+			name, submitter, ok = candidate, c.Submitters[candidate], true
+		}
+	}
+	return name, submitter, ok
+}
+
+// tokenMatches 以固定时间比较 token 的 SHA-256 摘要与配置的摘要，token 为空时不匹配
+func tokenMatches(token, digest string) bool {
+	if token == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(digest)), []byte(hex.EncodeToString(sum[:]))) == 1
+}
+
+// sortedNames 返回按名称排序的键
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -6,18 +6,18 @@ import (
 )
 
 // ConvertWorkflow 转换 GitHub Actions 工作流为 Argo Workflow
-func ConvertWorkflow(yamlData []byte) (string, error) {
-	return converter.ConvertWorkflow(yamlData)
+func ConvertWorkflow(yamlData []byte, opts ...converter.Option) (string, error) {
+	return converter.ConvertWorkflow(yamlData, opts...)
 }
 
-func WorkerRun(yamlData []byte) (string, error) {
+func WorkerRun(yamlData []byte, opts ...converter.Option) (string, error) {
 	var data map[string]interface{}
 	err := yaml.Unmarshal(yamlData, &data)
 	if err != nil {
 		return "", err
 	}
 
-	convertedData, err := ConvertWorkflow(yamlData)
+	convertedData, err := ConvertWorkflow(yamlData, opts...)
 	if err != nil {
 		return "", err
 	}